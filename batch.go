@@ -0,0 +1,104 @@
+package markov
+
+import "sort"
+
+// BatchRelater is optionally implemented by a WriteChain that can relate
+// several children to a parent faster than calling Relate for each. Batch
+// uses it to commit, and Feed writes to chains that implement it in batches.
+type BatchRelater interface {
+	// RelateLinks increases the number of times each child occurs after
+	// parent by the link's Count.
+	RelateLinks(parent int, links []LinkCount) error
+}
+
+// Batch groups writes to a WriteChain. Values are added to the chain
+// immediately, but link counts are kept in memory until Commit writes them,
+// grouped by parent. Relating the same values repeatedly in a batch only
+// updates the chain once.
+//
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	chain WriteChain
+
+	// links are the uncommitted links of each parent, in the order they
+	// were first related.
+	links map[int][]LinkCount
+
+	// index maps a parent and child to the child's index in links.
+	index map[[2]int]int
+}
+
+// NewBatch returns an empty Batch that writes to chain.
+func NewBatch(chain WriteChain) *Batch {
+	return &Batch{
+		chain: chain,
+		links: make(map[int][]LinkCount),
+		index: make(map[[2]int]int),
+	}
+}
+
+// Add inserts a value into the chain, if it doesn't exist, and returns it's
+// ID.
+func (b *Batch) Add(value interface{}) (int, error) {
+	return b.chain.Add(value)
+}
+
+// Relate increases the number of times child occurs after parent when the
+// batch is committed.
+func (b *Batch) Relate(parent, child int, delta int) error {
+	key := [2]int{parent, child}
+
+	i, ok := b.index[key]
+	if !ok {
+		i = len(b.links[parent])
+		b.links[parent] = append(b.links[parent], LinkCount{ID: child})
+		b.index[key] = i
+	}
+
+	b.links[parent][i].Count += delta
+
+	return nil
+}
+
+// Len returns the number of uncommitted links.
+func (b *Batch) Len() int {
+	return len(b.index)
+}
+
+// Commit writes the links to the chain. Parents are written in order of
+// their IDs.
+//
+// The batch is empty when Commit returns, even if it fails. If it fails, some
+// of the links may have been written.
+func (b *Batch) Commit() error {
+	links := b.links
+	b.links = make(map[int][]LinkCount)
+	b.index = make(map[[2]int]int)
+
+	parents := make([]int, 0, len(links))
+	for parent := range links {
+		parents = append(parents, parent)
+	}
+	sort.Ints(parents)
+
+	br, batched := b.chain.(BatchRelater)
+
+	for _, parent := range parents {
+		if batched {
+			err := br.RelateLinks(parent, links[parent])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, link := range links[parent] {
+			err := b.chain.Relate(parent, link.ID, link.Count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
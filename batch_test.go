@@ -0,0 +1,115 @@
+package markov
+
+import "testing"
+
+func TestBatch(t *testing.T) {
+	chain := NewMemoryChain(0)
+	batch := NewBatch(chain)
+
+	a, _ := batch.Add("a")
+	b, _ := batch.Add("b")
+	c, _ := batch.Add("c")
+
+	batch.Relate(a, b, 1)
+	batch.Relate(a, c, 1)
+	batch.Relate(a, b, 2)
+	batch.Relate(b, a, 1)
+
+	if batch.Len() != 3 {
+		t.Errorf("got len %d, want 3", batch.Len())
+	}
+
+	// Nothing is related until Commit.
+	counts, _ := LinkCounts(chain, a)
+	if len(counts) != 0 {
+		t.Errorf("got %v before Commit, want no links", counts)
+	}
+
+	err := batch.Commit()
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if batch.Len() != 0 {
+		t.Errorf("got len %d after Commit, want 0", batch.Len())
+	}
+
+	counts, _ = LinkCounts(chain, a)
+	expected := []LinkCount{{ID: b, Count: 3}, {ID: c, Count: 1}}
+	if len(counts) != len(expected) {
+		t.Fatalf("got %v, want %v", counts, expected)
+	}
+
+	for i := range expected {
+		if counts[i] != expected[i] {
+			t.Errorf("got %v, want %v", counts[i], expected[i])
+		}
+	}
+}
+
+func TestBatchDiskChain(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	chain, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	// Feed uses a batch for a DiskChainWriter.
+	testWriteChain(t, chain)
+	testReadChain(t, chain)
+
+	expected := NewMemoryChain(0)
+	testWriteChain(t, expected)
+
+	assertSameLinks(t, chain, expected)
+	assertSameLinks(t, expected, chain)
+}
+
+func TestBatchLargeFanOut(t *testing.T) {
+	// Enough children to need several list buckets.
+	const fanOut = linkListItemsPerBucket*3 + 10
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	chain, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	parent, _ := chain.Add(-1)
+	children := make([]int, fanOut)
+	for i := range children {
+		children[i], _ = chain.Add(i)
+	}
+
+	// The first commit adds the links, the second updates them.
+	for round := 1; round <= 2; round++ {
+		batch := NewBatch(chain)
+		for i, child := range children {
+			batch.Relate(parent, child, i+1)
+		}
+
+		err = batch.Commit()
+		if err != nil {
+			t.Fatalf("round %d: Commit failed: %v", round, err)
+		}
+	}
+
+	counts, err := LinkCounts(chain, parent)
+	if err != nil {
+		t.Fatalf("LinkCounts failed: %v", err)
+	}
+
+	if len(counts) != fanOut {
+		t.Fatalf("got %d links, want %d", len(counts), fanOut)
+	}
+
+	for i, count := range counts {
+		if count.ID != children[i] || count.Count != 2*(i+1) {
+			t.Errorf("link %d: got %v, want {%d %d}", i, count, children[i], 2*(i+1))
+		}
+	}
+}
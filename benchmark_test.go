@@ -39,6 +39,29 @@ func BenchmarkBuildDuplicateDisk(b *testing.B) {
 	Feed(chain, normalDistGenerator(b.N, 10))
 }
 
+func BenchmarkWriteParallel(b *testing.B) {
+	benchmarkWriteParallel(b, NewMemoryChain(0))
+}
+
+func BenchmarkWriteParallelSharded(b *testing.B) {
+	benchmarkWriteParallel(b, NewShardedChain(0))
+}
+
+// benchmarkWriteParallel adds and relates values from every CPU at once, as
+// Feed does with multiple channels.
+func benchmarkWriteParallel(b *testing.B, chain WriteChain) {
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+
+		last, _ := chain.Add(0)
+		for pb.Next() {
+			id, _ := chain.Add(int(rng.NormFloat64() * 1000))
+			chain.Relate(last, id, 1)
+			last = id
+		}
+	})
+}
+
 func BenchmarkRandomWalk(b *testing.B) {
 	chain := NewMemoryChain(b.N)
 	Feed(chain, normalDistGenerator(b.N, b.N/4))
@@ -51,6 +74,96 @@ func BenchmarkRandomWalk(b *testing.B) {
 	}
 }
 
+func BenchmarkRandomWalkDisk(b *testing.B) {
+	benchmarkRandomWalkDisk(b, -1)
+}
+
+func BenchmarkRandomWalkDiskCached(b *testing.B) {
+	benchmarkRandomWalkDisk(b, 0)
+}
+
+func benchmarkRandomWalkDisk(b *testing.B, cacheSize int) {
+	f, cleanup := tempFile(b)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		b.Fatalf("error: %v", err)
+	}
+
+	// A narrow distribution, so a few values are visited most often.
+	err = Feed(writer, normalDistGenerator(100000, 1000))
+	if err != nil {
+		b.Fatalf("error: %v", err)
+	}
+
+	chain, err := ReadDiskChainWithOptions(f, &DiskChainOptions{CacheSize: cacheSize})
+	if err != nil {
+		b.Fatalf("error: %v", err)
+	}
+	walker := RandomWalker(chain, 0)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		walker.Next()
+	}
+}
+
+// hubLinks returns links to n items with Zipf-distributed probabilities, as
+// the links from a common word would have.
+func hubLinks(n int) []Link {
+	links := make([]Link, n)
+	var total float64
+	for i := range links {
+		links[i] = Link{ID: i, Probability: 1 / float64(i+1)}
+		total += links[i].Probability
+	}
+
+	// Shuffle, so the most likely links aren't first.
+	rand.Shuffle(n, func(i, j int) { links[i], links[j] = links[j], links[i] })
+
+	for i := range links {
+		links[i].Probability /= total
+	}
+
+	return links
+}
+
+func BenchmarkSampleLinear(b *testing.B) {
+	links := hubLinks(5000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := rand.Float64()
+		var passed float64
+		for _, link := range links {
+			passed += link.Probability
+			if passed > r {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkSampleAlias(b *testing.B) {
+	sampler := NewSampler(hubLinks(5000))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sampler.Sample(rand.Float64())
+	}
+}
+
+func BenchmarkNewSampler(b *testing.B) {
+	links := hubLinks(5000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		NewSampler(links)
+	}
+}
+
 func normalDistGenerator(count, stddev int) <-chan interface{} {
 	numbers := make(chan interface{})
 
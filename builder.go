@@ -8,6 +8,10 @@ import "sync"
 //
 // If the WriteChain returns an error Feed returns it immediately, leaving
 // unread values on the channels.
+//
+// If the WriteChain implements BatchRelater (e.g. DiskChainWriter), links are
+// written in batches with Batch. Links may not be visible to readers until
+// Feed returns.
 func Feed(wc WriteChain, channels ...<-chan interface{}) error {
 	var wg sync.WaitGroup
 	wg.Add(len(channels))
@@ -32,7 +36,17 @@ func Feed(wc WriteChain, channels ...<-chan interface{}) error {
 	return nil
 }
 
+// feedBatchSize is the number of links Feed relates in a batch before
+// committing it.
+const feedBatchSize = 1 << 16
+
 func feedOne(cancel chan struct{}, wc WriteChain, values <-chan interface{}) error {
+	var batch *Batch
+	if _, ok := wc.(BatchRelater); ok {
+		batch = NewBatch(wc)
+		wc = batch
+	}
+
 	var next int
 	var err error
 
@@ -44,10 +58,10 @@ func feedOne(cancel chan struct{}, wc WriteChain, values <-chan interface{}) err
 	for {
 		select {
 		case <-cancel:
-			return nil
+			return commit(batch)
 		case val, ok := <-values:
 			if !ok {
-				return nil
+				return commit(batch)
 			}
 
 			next, err = wc.Add(val)
@@ -60,7 +74,22 @@ func feedOne(cancel chan struct{}, wc WriteChain, values <-chan interface{}) err
 				return err
 			}
 
+			if batch != nil && batch.Len() >= feedBatchSize {
+				err = batch.Commit()
+				if err != nil {
+					return err
+				}
+			}
+
 			last = next
 		}
 	}
 }
+
+// commit commits batch, if it isn't nil.
+func commit(batch *Batch) error {
+	if batch == nil {
+		return nil
+	}
+	return batch.Commit()
+}
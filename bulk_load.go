@@ -0,0 +1,616 @@
+package markov
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pboyd/markov/internal/disk"
+)
+
+var (
+	errNotEmpty     = errors.New("markov: chain isn't empty")
+	errUnknownOrder = errors.New("markov: unknown record order")
+)
+
+// bulkLoadChunkSize is the number of values encoded at a time by each
+// BulkLoad worker.
+const bulkLoadChunkSize = 1024
+
+// BulkLoadOptions are the options for DiskChainWriter.BulkLoad.
+type BulkLoadOptions struct {
+	// Workers is the number of goroutines that read values from the
+	// source chain and encode them. If it's 0 or less, GOMAXPROCS is used.
+	Workers int
+
+	// Progress, if it isn't nil, is called as values are written with
+	// the number written so far and the total number of values. Calls
+	// are not concurrent.
+	Progress func(written, total int)
+
+	// Order is the order the records are written in.
+	Order RecordOrder
+
+	// Headroom is unused space left in each value's list of links, as a
+	// fraction of the number of links, so links can be added later
+	// without allocating more buckets. For example, 0.25 leaves room for
+	// a quarter more links, rounded up. Headroom is ignored for compact
+	// records.
+	//
+	// When the list fills up, more buckets are added with the same
+	// capacity as the first, so a small bucket makes every link added
+	// later cost more. With any Headroom, each list has room for at least
+	// twice as many links as it has, and at least 8 (up to the 128 links
+	// in a bucket made by Add). That's a trade-off: small lists still
+	// take much less space than lists made by Add, but a value that gains
+	// many links after loading has them spread over many small buckets.
+	// Without Headroom, buckets fit the links exactly and links added
+	// later are stored inefficiently.
+	Headroom float64
+}
+
+// RecordOrder is the order that BulkLoad and CompactDiskChain write records
+// in. Reading values that are close together in the file is faster, since
+// they're more likely to be in the same disk block or the same block of a
+// compressed file. The first value is always written first, so ID 0 still
+// refers to it.
+type RecordOrder int
+
+const (
+	// SourceOrder writes records in the order of the source chain.
+	SourceOrder RecordOrder = iota
+
+	// BreadthFirstOrder writes records in breadth-first order from the
+	// first value, following the most frequent links first, so values
+	// are close to the values that come before them. Values that can't be
+	// reached from the first are written after, in the same way.
+	BreadthFirstOrder
+
+	// FrequencyOrder writes the records of the values that occur most
+	// often (those with the highest total count of links to them) first,
+	// so the most used records are together.
+	FrequencyOrder
+)
+
+// BulkLoad copies src into the chain, which must be empty.
+//
+// The file is written sequentially in one pass. Each value's links are
+// stored in a bucket that fits them exactly (or compactly, if Compact is
+// set), so without Headroom the result is the same as an optimized copy.
+// Values are read from src and encoded by multiple goroutines, so src must be
+// safe for concurrent reads.
+//
+// Returns an error if the chain already has values. If BulkLoad fails, the
+// chain is left empty.
+func (c *DiskChainWriter) BulkLoad(src Chain, opts *BulkLoadOptions) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+
+	if opts == nil {
+		opts = &BulkLoadOptions{}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	c.fileMutex.Lock()
+	defer c.fileMutex.Unlock()
+
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	if len(c.index) > 0 {
+		return errNotEmpty
+	}
+
+	start, err := c.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	l := &bulkLoader{
+		c:        c,
+		src:      src,
+		compact:  c.Compact && c.version >= disk.Version4,
+		itemSize: c.linkListItemSize(),
+		workers:  workers,
+		progress: opts.Progress,
+		order:    opts.Order,
+		headroom: opts.Headroom,
+	}
+
+	err = l.load(start)
+	if err != nil {
+		// Remove anything that was written, if possible.
+		if t, ok := c.file.(interface{ Truncate(int64) error }); ok {
+			t.Truncate(start)
+		}
+		return err
+	}
+
+	for i, value := range l.values {
+		c.index[value] = l.offsets[i]
+	}
+
+	return nil
+}
+
+// bulkLoader holds the state of a BulkLoad. Values are referred to by their
+// index in values.
+type bulkLoader struct {
+	c        *DiskChainWriter
+	src      Chain
+	compact  bool
+	itemSize int
+	workers  int
+	progress func(written, total int)
+	order    RecordOrder
+	headroom float64
+
+	values    []interface{}
+	valueBufs [][]byte
+	srcIDs    []int
+
+	// offsets are the destination IDs of the values.
+	offsets []int64
+
+	// recordsEnd is the offset after the last record, where the other
+	// sections start.
+	recordsEnd int64
+
+	// srcIndex maps source IDs to indexes.
+	srcIndex map[int]int
+}
+
+func (l *bulkLoader) load(start int64) error {
+	walker := IterativeWalker(l.src)
+	for {
+		value, err := walker.Next()
+		if err != nil {
+			if err == ErrBrokenChain {
+				break
+			}
+
+			return err
+		}
+
+		l.values = append(l.values, value)
+	}
+
+	if len(l.values) == 0 {
+		return nil
+	}
+
+	err := l.layout(start)
+	if err != nil {
+		return err
+	}
+
+	return l.write()
+}
+
+// layout finds the source ID and record size of each value, puts the values
+// in order, and finds the offset of each record. Records are written one
+// after another, followed by any list buckets that don't fit in the records
+// and compact link data.
+func (l *bulkLoader) layout(start int64) error {
+	n := len(l.values)
+	l.valueBufs = make([][]byte, n)
+	l.srcIDs = make([]int, n)
+	sizes := make([]int, n)
+
+	v := l.c.version
+	err := l.parallel(n, func(i int) error {
+		srcID, err := l.src.Find(l.values[i])
+		if err != nil {
+			return err
+		}
+
+		valueBuf, err := marshalValue(l.values[i])
+		if err != nil {
+			return err
+		}
+
+		if l.compact {
+			sizes[i] = disk.CompactRecordSize(v, len(valueBuf))
+		} else {
+			links, err := linkCounts(l.src, srcID)
+			if err != nil {
+				return err
+			}
+
+			sizes[i] = disk.RecordSize(v, len(valueBuf), l.itemSize, l.capacity(len(links)))
+		}
+
+		l.srcIDs[i] = srcID
+		l.valueBufs[i] = valueBuf
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.buildSrcIndex()
+
+	if l.order != SourceOrder {
+		err = l.sort(sizes)
+		if err != nil {
+			return err
+		}
+	}
+
+	l.offsets = make([]int64, n)
+
+	offset := start
+	for i, size := range sizes {
+		l.offsets[i] = offset
+		offset += int64(size)
+	}
+	l.recordsEnd = offset
+
+	return nil
+}
+
+func (l *bulkLoader) buildSrcIndex() {
+	l.srcIndex = make(map[int]int, len(l.srcIDs))
+	for i, id := range l.srcIDs {
+		l.srcIndex[id] = i
+	}
+}
+
+// minListCapacity is the smallest list capacity left by BulkLoad with
+// headroom.
+const minListCapacity = 8
+
+// capacity returns the capacity of a list with n links. Buckets added when a
+// list fills up have the same capacity as the first, so with headroom lists
+// have room for at least twice their links, between minListCapacity and the
+// capacity of lists made by Add. See BulkLoadOptions.Headroom.
+func (l *bulkLoader) capacity(n int) int {
+	if l.headroom <= 0 {
+		return n
+	}
+
+	floor := 2 * n
+	if floor < minListCapacity {
+		floor = minListCapacity
+	}
+	if floor > linkListItemsPerBucket {
+		floor = linkListItemsPerBucket
+	}
+
+	c := n + int(math.Ceil(float64(n)*l.headroom))
+	if c < floor {
+		c = floor
+	}
+	return c
+}
+
+// sort puts the values, and their sizes, in the load's order.
+func (l *bulkLoader) sort(sizes []int) error {
+	var (
+		order []int
+		err   error
+	)
+
+	switch l.order {
+	case BreadthFirstOrder:
+		order, err = l.breadthFirstOrder()
+	case FrequencyOrder:
+		order, err = l.frequencyOrder()
+	default:
+		return errUnknownOrder
+	}
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(order))
+	valueBufs := make([][]byte, len(order))
+	srcIDs := make([]int, len(order))
+	oldSizes := append([]int(nil), sizes...)
+
+	for i, from := range order {
+		values[i] = l.values[from]
+		valueBufs[i] = l.valueBufs[from]
+		srcIDs[i] = l.srcIDs[from]
+		sizes[i] = oldSizes[from]
+	}
+
+	l.values = values
+	l.valueBufs = valueBufs
+	l.srcIDs = srcIDs
+	l.buildSrcIndex()
+
+	return nil
+}
+
+// breadthFirstOrder returns the indexes of the values in breadth-first order.
+func (l *bulkLoader) breadthFirstOrder() ([]int, error) {
+	n := len(l.values)
+	order := make([]int, 0, n)
+	seen := make([]bool, n)
+
+	for root := 0; root < n; root++ {
+		if seen[root] {
+			continue
+		}
+
+		seen[root] = true
+		order = append(order, root)
+
+		for next := len(order) - 1; next < len(order); next++ {
+			links, err := linkCounts(l.src, l.srcIDs[order[next]])
+			if err != nil {
+				return nil, err
+			}
+
+			sort.SliceStable(links, func(a, b int) bool {
+				return links[a].Count > links[b].Count
+			})
+
+			for _, link := range links {
+				i, ok := l.srcIndex[link.ID]
+				if !ok {
+					return nil, ErrNotFound
+				}
+
+				if !seen[i] {
+					seen[i] = true
+					order = append(order, i)
+				}
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// frequencyOrder returns the indexes of the values, after the first, from
+// the highest total count of links to them to the lowest.
+func (l *bulkLoader) frequencyOrder() ([]int, error) {
+	n := len(l.values)
+	totals := make([]int64, n)
+
+	err := l.parallel(n, func(i int) error {
+		links, err := linkCounts(l.src, l.srcIDs[i])
+		if err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			j, ok := l.srcIndex[link.ID]
+			if !ok {
+				return ErrNotFound
+			}
+
+			atomic.AddInt64(&totals[j], int64(link.Count))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+
+	rest := order[1:]
+	sort.SliceStable(rest, func(a, b int) bool {
+		return totals[rest[a]] > totals[rest[b]]
+	})
+
+	return order, nil
+}
+
+// parallel calls f for each index from 0 to n-1, split between the workers.
+// It returns the first error.
+func (l *bulkLoader) parallel(n int, f func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+		firstErr error
+	)
+
+	per := (n + l.workers - 1) / l.workers
+	for from := 0; from < n; from += per {
+		to := from + per
+		if to > n {
+			to = n
+		}
+
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+
+			for i := from; i < to; i++ {
+				err := f(i)
+				if err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMutex.Unlock()
+					return
+				}
+			}
+		}(from, to)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+type encodedChunk struct {
+	records []*disk.EncodedRecord
+	err     error
+}
+
+// write encodes the records in chunks, in parallel, and writes them in order.
+func (l *bulkLoader) write() error {
+	n := len(l.values)
+	chunks := (n + bulkLoadChunkSize - 1) / bulkLoadChunkSize
+
+	results := make([]chan encodedChunk, chunks)
+	for i := range results {
+		results[i] = make(chan encodedChunk, 1)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Limit the number of chunks encoded ahead of the writer.
+	pending := make(chan struct{}, 2*l.workers)
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+
+		for i := 0; i < chunks; i++ {
+			select {
+			case pending <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < l.workers; w++ {
+		go func() {
+			for i := range jobs {
+				records, err := l.encodeChunk(i)
+				results[i] <- encodedChunk{records: records, err: err}
+			}
+		}()
+	}
+
+	records := bufio.NewWriterSize(&offsetWriter{w: l.c.file, offset: l.offsets[0]}, 1<<20)
+	data := bufio.NewWriterSize(&offsetWriter{w: l.c.file, offset: l.recordsEnd}, 1<<20)
+	dataOffset := l.recordsEnd
+
+	written := 0
+	for i := range results {
+		chunk := <-results[i]
+		<-pending
+
+		if chunk.err != nil {
+			return chunk.err
+		}
+
+		for _, r := range chunk.records {
+			r.SetDataOffset(dataOffset)
+			dataOffset += int64(len(r.Data))
+
+			_, err := records.Write(r.Record)
+			if err != nil {
+				return err
+			}
+
+			_, err = data.Write(r.Data)
+			if err != nil {
+				return err
+			}
+		}
+
+		written += len(chunk.records)
+		if l.progress != nil {
+			l.progress(written, n)
+		}
+	}
+
+	err := records.Flush()
+	if err != nil {
+		return err
+	}
+
+	return data.Flush()
+}
+
+// encodeChunk encodes the records in a chunk.
+func (l *bulkLoader) encodeChunk(chunk int) ([]*disk.EncodedRecord, error) {
+	from := chunk * bulkLoadChunkSize
+	to := from + bulkLoadChunkSize
+	if to > len(l.values) {
+		to = len(l.values)
+	}
+
+	records := make([]*disk.EncodedRecord, 0, to-from)
+	for i := from; i < to; i++ {
+		r, err := l.encode(i)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// encode encodes the record for a value, with it's links mapped to
+// destination IDs.
+func (l *bulkLoader) encode(i int) (*disk.EncodedRecord, error) {
+	links, err := linkCounts(l.src, l.srcIDs[i])
+	if err != nil {
+		return nil, err
+	}
+
+	maxCount := l.c.maxLinkCount()
+
+	for j, link := range links {
+		index, ok := l.srcIndex[link.ID]
+		if !ok {
+			return nil, ErrNotFound
+		}
+
+		if uint64(link.Count) > maxCount {
+			return nil, ErrCountOverflow
+		}
+
+		links[j].ID = int(l.offsets[index])
+	}
+
+	if l.compact {
+		return disk.EncodeCompactRecord(l.c.version, l.valueBufs[i], encodeLinks(links))
+	}
+
+	elements := make([]byte, len(links)*l.itemSize)
+	for j, link := range links {
+		buf := elements[j*l.itemSize:]
+		binary.BigEndian.PutUint64(buf, uint64(link.ID))
+		l.c.updateLinkCount(buf, uint64(link.Count))
+	}
+
+	return disk.EncodeRecord(l.c.version, l.valueBufs[i], l.itemSize, elements, l.capacity(len(links)))
+}
+
+// offsetWriter writes sequentially to a WriterAt, starting at offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,319 @@
+package markov
+
+import (
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBulkLoad(t *testing.T) {
+	// Enough values for several chunks, from a chain with gaps in it's
+	// IDs.
+	src := NewShardedChain(3)
+	err := Feed(src, normalDistGenerator(5000, 2000))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	values := 0
+	walker := IterativeWalker(src)
+	for {
+		_, err := walker.Next()
+		if err != nil {
+			break
+		}
+		values++
+	}
+
+	for _, compact := range []bool{false, true} {
+		f, cleanup := tempFile(t)
+		defer cleanup()
+
+		dest, err := NewDiskChainWriter(f)
+		if err != nil {
+			t.Fatalf("NewDiskChainWriter failed: %v", err)
+		}
+		dest.Compact = compact
+
+		last := 0
+		err = dest.BulkLoad(src, &BulkLoadOptions{
+			Workers: 3,
+			Progress: func(written, total int) {
+				if written <= last || total != values {
+					t.Errorf("compact=%v: got progress %d/%d after %d, want %d total", compact, written, total, last, values)
+				}
+				last = written
+			},
+		})
+		if err != nil {
+			t.Fatalf("compact=%v: BulkLoad failed: %v", compact, err)
+		}
+
+		if last != values {
+			t.Errorf("compact=%v: last progress was %d, want %d", compact, last, values)
+		}
+
+		reader, err := ReadDiskChain(f)
+		if err != nil {
+			t.Fatalf("compact=%v: ReadDiskChain failed: %v", compact, err)
+		}
+
+		assertSameLinks(t, reader, src)
+		assertSameLinks(t, src, reader)
+	}
+}
+
+func TestBulkLoadNotEmpty(t *testing.T) {
+	src := NewMemoryChain(0)
+	testWriteChain(t, src)
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	dest, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	_, err = dest.Add("x")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	err = dest.BulkLoad(src, nil)
+	if err != errNotEmpty {
+		t.Errorf("got error %v, want %v", err, errNotEmpty)
+	}
+}
+
+func TestBulkLoadOrder(t *testing.T) {
+	src := NewMemoryChain(0)
+
+	ids := map[string]int{}
+	for _, v := range []string{"a", "b", "c", "d", "e", "x", "y"} {
+		id, err := src.Add(v)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		ids[v] = id
+	}
+
+	links := []struct {
+		parent, child string
+		count         int
+	}{
+		{"a", "b", 1},
+		{"a", "c", 5},
+		{"b", "e", 1},
+		{"c", "d", 2},
+		{"d", "c", 3},
+		{"x", "y", 1},
+	}
+	for _, l := range links {
+		err := src.Relate(ids[l.parent], ids[l.child], l.count)
+		if err != nil {
+			t.Fatalf("Relate failed: %v", err)
+		}
+	}
+
+	cases := []struct {
+		order    RecordOrder
+		expected []string
+	}{
+		{SourceOrder, []string{"a", "b", "c", "d", "e", "x", "y"}},
+		{BreadthFirstOrder, []string{"a", "c", "b", "d", "e", "x", "y"}},
+		{FrequencyOrder, []string{"a", "c", "d", "b", "e", "y", "x"}},
+	}
+
+	for _, tc := range cases {
+		f, cleanup := tempFile(t)
+		defer cleanup()
+
+		dest, err := NewDiskChainWriter(f)
+		if err != nil {
+			t.Fatalf("NewDiskChainWriter failed: %v", err)
+		}
+
+		err = dest.BulkLoad(src, &BulkLoadOptions{Order: tc.order})
+		if err != nil {
+			t.Fatalf("order %d: BulkLoad failed: %v", tc.order, err)
+		}
+
+		var actual []string
+		walker := IterativeWalker(dest)
+		for {
+			value, err := walker.Next()
+			if err != nil {
+				break
+			}
+			actual = append(actual, value.(string))
+		}
+
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("order %d: got %v, want %v", tc.order, actual, tc.expected)
+		}
+
+		assertSameLinks(t, dest, src)
+		assertSameLinks(t, src, dest)
+	}
+}
+
+func TestDiskChainCopyFromExisting(t *testing.T) {
+	src := NewMemoryChain(0)
+	testWriteChain(t, src)
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	dest, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	// The first copy fills the empty chain, the second adds to the same
+	// values and should double every count.
+	for i := 0; i < 2; i++ {
+		err = dest.CopyFrom(src)
+		if err != nil {
+			t.Fatalf("%d: CopyFrom failed: %v", i, err)
+		}
+	}
+
+	doubled := NewMemoryChain(0)
+	testWriteChain(t, doubled)
+	testWriteChain(t, doubled)
+
+	assertSameLinks(t, dest, doubled)
+	assertSameLinks(t, doubled, dest)
+}
+
+func TestDiskChainCopyFromSequential(t *testing.T) {
+	src := NewMemoryChain(0)
+	err := Feed(src, normalDistGenerator(5000, 2000))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	dest, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	seq := &sequentialChain{IterativeChain: src}
+	err = dest.CopyFrom(seq)
+	if err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+
+	if seq.overlapped() {
+		t.Error("CopyFrom read the source chain from more than one goroutine")
+	}
+
+	assertSameLinks(t, dest, src)
+	assertSameLinks(t, src, dest)
+}
+
+// sequentialChain wraps a chain and records whether it's read by more than one
+// goroutine at once.
+type sequentialChain struct {
+	IterativeChain
+	reading int32
+	overlap int32
+}
+
+func (c *sequentialChain) Get(id int) (interface{}, error) {
+	defer c.enter()()
+	return c.IterativeChain.Get(id)
+}
+
+func (c *sequentialChain) Links(id int) ([]Link, error) {
+	defer c.enter()()
+	return c.IterativeChain.Links(id)
+}
+
+func (c *sequentialChain) Find(value interface{}) (int, error) {
+	defer c.enter()()
+	return c.IterativeChain.Find(value)
+}
+
+func (c *sequentialChain) Next(id int) (int, error) {
+	defer c.enter()()
+	return c.IterativeChain.Next(id)
+}
+
+func (c *sequentialChain) linkCounts(id int) (linkCountSlice, error) {
+	defer c.enter()()
+	return linkCounts(c.IterativeChain, id)
+}
+
+func (c *sequentialChain) enter() func() {
+	if atomic.AddInt32(&c.reading, 1) > 1 {
+		atomic.StoreInt32(&c.overlap, 1)
+	}
+	// Give other goroutines a chance to overlap.
+	runtime.Gosched()
+	return func() { atomic.AddInt32(&c.reading, -1) }
+}
+
+func (c *sequentialChain) overlapped() bool {
+	return atomic.LoadInt32(&c.overlap) != 0
+}
+
+// assertSameLinks checks that every value in actual is in expected, with the
+// same link counts.
+func assertSameLinks(t *testing.T, actual, expected Chain) {
+	t.Helper()
+
+	walker := IterativeWalker(actual)
+	for {
+		value, err := walker.Next()
+		if err != nil {
+			if err == ErrBrokenChain {
+				return
+			}
+			t.Fatalf("Next failed: %v", err)
+		}
+
+		actualLinks := linkCountsByValue(t, actual, value)
+		expectedLinks := linkCountsByValue(t, expected, value)
+
+		if len(actualLinks) != len(expectedLinks) {
+			t.Fatalf("%v: got %d links, want %d", value, len(actualLinks), len(expectedLinks))
+		}
+
+		for child, count := range expectedLinks {
+			if actualLinks[child] != count {
+				t.Errorf("%v -> %v: got count %d, want %d", value, child, actualLinks[child], count)
+			}
+		}
+	}
+}
+
+func linkCountsByValue(t *testing.T, chain Chain, value interface{}) map[interface{}]int {
+	t.Helper()
+
+	id, err := chain.Find(value)
+	if err != nil {
+		t.Fatalf("Find(%v) failed: %v", value, err)
+	}
+
+	counts, err := linkCounts(chain, id)
+	if err != nil {
+		t.Fatalf("linkCounts(%v) failed: %v", value, err)
+	}
+
+	byValue := make(map[interface{}]int, len(counts))
+	for _, count := range counts {
+		child, err := chain.Get(count.ID)
+		if err != nil {
+			t.Fatalf("Get(%d) failed: %v", count.ID, err)
+		}
+		byValue[child] = count.Count
+	}
+
+	return byValue
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/pboyd/markov"
+	"github.com/pboyd/markov/tokenize"
+)
+
+var buildCommand = &command{
+	name:  "build",
+	args:  "[file...]",
+	short: "build a chain from text",
+	long: `
+Build reads text from the files, or STDIN, and builds a chain of the tokens.
+
+-tokens selects how the text is split:
+
+	word		words, numbers and punctuation (the default)
+	whitespace	anything between white space
+	rune		each character
+	grapheme	each character, with combining marks
+	sentence	sentences
+	line		lines
+	regexp		matches of -pattern, which can't span lines
+
+Punctuation is dropped from word tokens by default. -punct keeps it ("keep")
+or splits it from the start and end of tokens ("split").
+
+With -n greater than 1, the chain is built from N-grams (bigrams, trigrams,
+etc.) and each N-gram is stored as a tuple of tokens (see markov.Tuple).
+
+As an example:
+
+	markov build -chain out.mkv -n 2 -fold book.txt
+`,
+	run: runBuild,
+}
+
+var splitFuncs = map[string]bufio.SplitFunc{
+	"word":       tokenize.ScanWords,
+	"whitespace": bufio.ScanWords,
+	"rune":       bufio.ScanRunes,
+	"grapheme":   tokenize.ScanGraphemes,
+	"sentence":   tokenize.ScanSentences,
+	"line":       bufio.ScanLines,
+}
+
+func runBuild(fs *flag.FlagSet, args []string) error {
+	var output outputFlags
+	output.register(fs)
+	n := fs.Int("n", 1, "ngram size")
+	tokens := fs.String("tokens", "word", "how to split the text: word, whitespace, rune, grapheme, sentence, line or regexp")
+	pattern := fs.String("pattern", "", "regular expression matching each token, with -tokens regexp")
+	fold := fs.Bool("fold", false, "convert tokens to lower case")
+	punct := fs.String("punct", "", "what to do with punctuation: keep, split or drop (default drop for word tokens, otherwise keep)")
+	normalize := fs.String("normalize", "none", "Unicode normalization form: none, nfc or nfd")
+	fs.Parse(args)
+
+	err := requireChain(output.path)
+	if err != nil {
+		return err
+	}
+
+	if *n < 1 {
+		return usageErrorf("-n must be at least 1")
+	}
+
+	tokenizer := &tokenize.Tokenizer{FoldCase: *fold}
+
+	if *tokens == "regexp" {
+		if *pattern == "" {
+			return usageErrorf("-pattern is required with -tokens regexp")
+		}
+
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			return usageErrorf("invalid pattern: %v", err)
+		}
+		tokenizer.Split = tokenize.ScanRegexp(re)
+	} else {
+		if *pattern != "" {
+			return usageErrorf("-pattern requires -tokens regexp")
+		}
+
+		split, ok := splitFuncs[*tokens]
+		if !ok {
+			return usageErrorf("unknown -tokens %q", *tokens)
+		}
+		tokenizer.Split = split
+	}
+
+	if *punct == "" {
+		*punct = "keep"
+		if *tokens == "word" {
+			*punct = "drop"
+		}
+	}
+
+	tokenizer.Punctuation, err = tokenize.ParsePunctuation(*punct)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	tokenizer.Form, err = tokenize.ParseForm(*normalize)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	streams := make([]*tokenize.Tokens, len(sources))
+	values := make([]<-chan interface{}, len(sources))
+	for i, source := range sources {
+		r, err := openInput(source)
+		if err != nil {
+			return err
+		}
+
+		streams[i] = tokenizer.Tokenize(r)
+		values[i] = streams[i].C
+
+		if *n > 1 {
+			values[i] = joinWords(values[i], *n)
+		}
+	}
+
+	return output.write(func(chain markov.WriteChain) error {
+		err := markov.Feed(chain, values...)
+		if err != nil {
+			return fmt.Errorf("error building chain: %v", err)
+		}
+
+		for i, stream := range streams {
+			if err := stream.Err(); err != nil {
+				return fmt.Errorf("error reading %s: %v", sources[i], err)
+			}
+		}
+		return nil
+	})
+}
+
+// openInput opens a file for reading, or STDIN if path is "-".
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(path)
+}
+
+// joinWords groups each run of n tokens into a tuple.
+func joinWords(words <-chan interface{}, n int) <-chan interface{} {
+	ngrams := make(chan interface{})
+
+	go func() {
+		defer close(ngrams)
+
+		ngram := make([]interface{}, 0, n)
+
+		for word := range words {
+			if len(ngram) < n {
+				ngram = append(ngram, word)
+
+				if len(ngram) < n {
+					continue
+				}
+			} else {
+				copy(ngram[0:], ngram[1:])
+				ngram[n-1] = word
+			}
+			ngrams <- markov.Tuple(ngram...)
+		}
+	}()
+	return ngrams
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pboyd/markov"
+)
+
+// outputFlags are the flags for commands that write a chain file.
+type outputFlags struct {
+	path   string
+	update bool
+	onDisk bool
+	wait   bool
+}
+
+func (o *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.path, "chain", "", "path to the output chain file")
+	fs.BoolVar(&o.update, "update", false, "update the chain file instead of overwriting it")
+	fs.BoolVar(&o.onDisk, "disk", false, "write the chain directly to disk instead of building it in memory first")
+	fs.BoolVar(&o.wait, "wait", false, "wait for other processes using the chain file (such as markov serve) instead of failing")
+}
+
+// write opens the chain file and calls build to add to it.
+func (o *outputFlags) write(build func(markov.WriteChain) error) error {
+	mode := markov.CreateMode
+	if o.update {
+		mode = markov.UpdateMode
+	}
+
+	if !o.wait {
+		mode |= markov.NoWait
+	}
+
+	diskChain, err := markov.OpenDiskChainFile(o.path, mode)
+	if err == markov.ErrLocked {
+		return lockedError(o.path)
+	}
+	if err != nil {
+		return err
+	}
+	defer diskChain.Close()
+
+	if o.onDisk {
+		return build(diskChain)
+	}
+
+	memoryChain := markov.NewMemoryChain(0)
+	err = build(memoryChain)
+	if err != nil {
+		return err
+	}
+
+	// A new file is empty, so it can be bulk loaded. MemoryChain is safe
+	// to read from the bulk loader's goroutines.
+	if o.update {
+		err = markov.Copy(diskChain, memoryChain)
+	} else {
+		err = diskChain.BulkLoad(memoryChain, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying chain to disk: %v", err)
+	}
+
+	return nil
+}
+
+// lockedError is the error for a chain file that's in use. Chains being served
+// stay open until the server exits, so that's the most likely reason.
+func lockedError(path string) error {
+	return fmt.Errorf("%s is in use by another process, such as \"markov serve\" (use -wait to wait for it)", path)
+}
+
+// findValue finds the ID of a value given on the command line. If the string
+// isn't in the chain it's split into words and looked up as a tuple, so "a b"
+// finds the N-gram ("a", "b").
+func findValue(chain markov.Chain, value string) (int, error) {
+	id, err := chain.Find(value)
+	if err != markov.ErrNotFound {
+		return id, err
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return 0, markov.ErrNotFound
+	}
+
+	words := make([]interface{}, len(fields))
+	for i, f := range fields {
+		words[i] = f
+	}
+
+	return chain.Find(markov.Tuple(words...))
+}
+
+// format returns tuples as space-separated values, and other values as
+// strings.
+func format(value interface{}) string {
+	return strings.Join(tokens(value), " ")
+}
+
+// tokens returns the values in a tuple as strings, or a value that isn't a
+// tuple as a single string.
+func tokens(value interface{}) []string {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Array {
+		return []string{fmt.Sprint(value)}
+	}
+
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+
+	return parts
+}
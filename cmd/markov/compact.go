@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pboyd/markov"
+)
+
+var compactCommand = &command{
+	name:  "compact",
+	short: "rewrite a chain to reclaim space after updates",
+	long: `
+Compact rewrites a chain without the unused space that builds up as it's
+updated.
+
+Links between values are stored in buckets, and when a value's bucket fills
+up a new one is added at the end of the file. After many updates a value's
+links can be spread across the file, with space reserved in each bucket that
+may never be used. Compact copies each value's links into a single bucket,
+with room left for new links (-headroom, as a fraction of the number of
+links). Buckets added later are the same size as the first, so each bucket
+has room for at least twice as many links as it holds, and at least 8, up to
+128. Unlike "markov optimize" (with or without -compact), the compacted chain
+can still be updated efficiently. With -headroom 0 buckets fit the links
+exactly, which is smaller but makes updates slow.
+
+-order sets the order values are written in:
+
+	bfs		breadth-first from the first value, following the most
+			frequent links first (the default)
+	frequency	the most frequent values first
+	source		the order of the input
+
+Values that are read together are close together in the file in bfs order,
+which makes walks faster.
+
+Without -out, the chain is compacted in place: it's written to a temporary
+file which replaces the original. Compact fails if another process has the
+chain open (or waits for it, with -wait), and other processes wait for it to
+finish. Those that were waiting then open the compacted chain.
+
+Compressed and optimized chains can be compacted, and the output is always
+in the current file format.
+`,
+	run: runCompact,
+}
+
+func runCompact(fs *flag.FlagSet, args []string) error {
+	input := fs.String("chain", "", "path to the chain file")
+	output := fs.String("out", "", "path to the output chain file (default: replace the input)")
+	order := fs.String("order", "bfs", "record order: bfs, frequency or source")
+	headroom := fs.Float64("headroom", markov.DefaultCompactHeadroom, "room for new links, as a fraction of the number of links (0 for none)")
+	wait := fs.Bool("wait", false, "wait for other processes using the chain file (such as markov serve) instead of failing")
+	fs.Parse(args)
+
+	err := requireChain(*input)
+	if err != nil {
+		return err
+	}
+
+	opts := &markov.CompactOptions{
+		Headroom: *headroom,
+	}
+
+	switch *order {
+	case "bfs":
+		opts.Order = markov.BreadthFirstOrder
+	case "frequency":
+		opts.Order = markov.FrequencyOrder
+	case "source":
+		opts.Order = markov.SourceOrder
+	default:
+		return usageErrorf("unknown -order %q", *order)
+	}
+
+	if *headroom < 0 {
+		return usageErrorf("-headroom can't be negative")
+	}
+
+	if *output != "" {
+		err = requireDifferentOutput(*input, *output)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 0 is the default for CompactOptions, and negative is none.
+	if *headroom == 0 {
+		opts.Headroom = -1
+	}
+
+	inPlace := *output == ""
+
+	inChain, err := openCompactInput(*input, inPlace, *wait)
+	if err == markov.ErrLocked {
+		return lockedError(*input)
+	}
+	if err != nil {
+		return err
+	}
+	defer inChain.Close()
+
+	var outFile *os.File
+	if inPlace {
+		outFile, err = os.CreateTemp(filepath.Dir(*input), ".markov-compact-*")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %v", err)
+		}
+		defer os.Remove(outFile.Name())
+	} else {
+		outFile, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+	}
+	defer outFile.Close()
+
+	err = markov.CompactDiskChain(outFile, inChain.File(), opts)
+	if err != nil {
+		return fmt.Errorf("error compacting chain: %v", err)
+	}
+
+	if !inPlace {
+		return nil
+	}
+
+	info, err := inChain.File().Stat()
+	if err != nil {
+		return err
+	}
+
+	err = outFile.Chmod(info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = outFile.Sync()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(outFile.Name(), *input)
+}
+
+// openCompactInput opens the chain to compact. When it's compacted in place
+// it's opened for writing, so no other process can use it until it's been
+// replaced. Processes waiting for it then open the replacement.
+func openCompactInput(path string, inPlace, wait bool) (*markov.DiskChainFile, error) {
+	noWait := markov.NoWait
+	if wait {
+		noWait = 0
+	}
+
+	if !inPlace {
+		return markov.OpenDiskChainFile(path, markov.ReadMode|noWait)
+	}
+
+	// UpdateMode would create a missing file.
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := markov.OpenDiskChainFile(path, markov.UpdateMode|noWait)
+	if err != markov.ErrReadOnly {
+		return chain, err
+	}
+
+	// Compressed and optimized chains can't be opened for writing, but
+	// nothing else can write to them either.
+	return markov.OpenDiskChainFile(path, markov.ReadMode|noWait)
+}
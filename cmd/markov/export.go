@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pboyd/markov"
+)
+
+var exportCommand = &command{
+	name:  "export",
+	short: "write a chain in another format",
+	long: `
+Export writes a chain file to STDOUT in another format.
+
+Supported formats:
+
+	json	an array of [state, {next: count}] pairs, compatible with
+		markovify (see markov.EncodeJSON)
+	dot	a Graphviz graph with edges labeled by probability
+	graphml	a GraphML graph with counts and probabilities
+	csv	an edge list of from,to,count,probability
+	mtx	a Matrix Market transition matrix of probabilities (or counts
+		with -counts). Row and column N is the Nth value in the chain.
+
+The graph formats (dot, graphml and csv) can be limited with -threshold and
+-max-nodes.
+
+As an example:
+
+	markov export -chain in.mkv -format dot -max-nodes 50 | dot -Tsvg > chain.svg
+`,
+	run: runExport,
+}
+
+func runExport(fs *flag.FlagSet, args []string) error {
+	source := fs.String("chain", "", "path to the chain file")
+	format := fs.String("format", "json", "output format (json, dot, graphml, csv or mtx)")
+	threshold := fs.Float64("threshold", 0, "omit links with a lower probability (graph formats only)")
+	maxNodes := fs.Int("max-nodes", 0, "maximum number of values to output, 0 for no limit (graph formats only)")
+	counts := fs.Bool("counts", false, "write counts instead of probabilities (mtx only)")
+	fs.Parse(args)
+
+	err := requireChain(*source)
+	if err != nil {
+		return err
+	}
+
+	chain, err := markov.OpenDiskChainFile(*source, markov.ReadMode)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	opts := &markov.GraphOptions{
+		MinProbability: *threshold,
+		MaxNodes:       *maxNodes,
+	}
+
+	switch *format {
+	case "json":
+		err = markov.EncodeJSON(out, chain)
+	case "dot":
+		err = markov.EncodeDOT(out, chain, opts)
+	case "graphml":
+		err = markov.EncodeGraphML(out, chain, opts)
+	case "csv":
+		err = markov.EncodeCSV(out, chain, opts)
+	case "mtx":
+		err = writeMatrix(out, chain, *counts)
+	default:
+		return usageErrorf("unknown format %q", *format)
+	}
+
+	if err == nil {
+		err = out.Flush()
+	}
+
+	if err != nil {
+		return fmt.Errorf("error exporting chain: %v", err)
+	}
+
+	return nil
+}
+
+func writeMatrix(w io.Writer, chain markov.Chain, counts bool) error {
+	kind := markov.Probabilities
+	if counts {
+		kind = markov.Counts
+	}
+
+	m, err := markov.TransitionMatrix(chain, kind)
+	if err != nil {
+		return err
+	}
+
+	return m.WriteMatrixMarket(w)
+}
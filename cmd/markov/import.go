@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/pboyd/markov"
+)
+
+var importCommand = &command{
+	name:  "import",
+	args:  "[file...]",
+	short: "build a chain from JSON",
+	long: `
+Import builds a chain from JSON, as written by "markov export". JSON is read
+from the files, or STDIN.
+
+With -format markovify, the input is a model saved by markovify (with
+Chain.to_json or Text.to_json). Words are always imported as strings, and
+states of more than one word as tuples, linked to the state that follows
+them, like a chain built with "markov build -n".
+
+As an example:
+
+	markov import -chain out.mkv chain.json
+	markov import -chain out.mkv -format markovify model.json
+`,
+	run: runImport,
+}
+
+func runImport(fs *flag.FlagSet, args []string) error {
+	var output outputFlags
+	output.register(fs)
+	format := fs.String("format", "json", "input format: json or markovify")
+	fs.Parse(args)
+
+	err := requireChain(output.path)
+	if err != nil {
+		return err
+	}
+
+	var decode func(io.Reader, markov.WriteChain) error
+	switch *format {
+	case "json":
+		decode = markov.DecodeJSON
+	case "markovify":
+		decode = markov.DecodeMarkovifyJSON
+	default:
+		return usageErrorf("unknown format %q", *format)
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	return output.write(func(chain markov.WriteChain) error {
+		for _, source := range sources {
+			err := importFile(chain, source, decode)
+			if err != nil {
+				return fmt.Errorf("error importing %s: %v", source, err)
+			}
+		}
+		return nil
+	})
+}
+
+func importFile(chain markov.WriteChain, path string, decode func(io.Reader, markov.WriteChain) error) error {
+	r, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return decode(bufio.NewReader(r), chain)
+}
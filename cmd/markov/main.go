@@ -0,0 +1,176 @@
+// markov builds Markov chain files, generates from them, and inspects them.
+//
+// Usage:
+//
+//	markov <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	build     build a chain from text
+//	import    build a chain from JSON
+//	export    write a chain in another format
+//	walk      generate values from a chain
+//	optimize  rewrite a chain for faster reads
+//	compact   rewrite a chain to reclaim space after updates
+//	stat      print statistics about a chain
+//	serve     serve chains over HTTP
+//	repl      explore a chain interactively
+//
+// Every command takes the path to the chain file with -chain. Run
+// "markov <command> -h" for the details of each command.
+//
+// As an example:
+//
+//	markov build -chain words.mkv book.txt
+//	markov walk -chain words.mkv -count 50
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name string
+
+	// args describes the arguments after the flags, if any.
+	args string
+
+	short string
+
+	// long is the description printed by -h.
+	long string
+
+	run func(fs *flag.FlagSet, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		buildCommand,
+		importCommand,
+		exportCommand,
+		walkCommand,
+		optimizeCommand,
+		compactCommand,
+		statCommand,
+		serveCommand,
+		replCommand,
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(os.Args) > 2 {
+			if cmd := findCommand(os.Args[2]); cmd != nil {
+				newFlagSet(cmd).Usage()
+				return
+			}
+		}
+		usage()
+		return
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "markov: unknown command %q\n", name)
+		usage()
+		os.Exit(1)
+	}
+
+	fs := newFlagSet(cmd)
+	err := cmd.run(fs, os.Args[2:])
+	if err != nil {
+		var ue *usageError
+		if errors.As(err, &ue) {
+			fmt.Fprintf(os.Stderr, "markov %s: %v\n", cmd.name, err)
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "markov %s: %v\n", cmd.name, err)
+		os.Exit(2)
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, "usage: markov <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprint(os.Stderr, "\nRun \"markov <command> -h\" for help with a command.\n")
+}
+
+// newFlagSet creates the FlagSet for a command. It exits after printing the
+// usage for -h, or when the flags can't be parsed.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: markov %s [flags]", cmd.name)
+		if cmd.args != "" {
+			fmt.Fprintf(fs.Output(), " %s", cmd.args)
+		}
+		fmt.Fprintf(fs.Output(), "\n\n%s\n\nFlags:\n", strings.TrimSpace(cmd.long))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// usageError is an error in a command's flags or arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// requireChain returns a usageError if the -chain flag wasn't given.
+func requireChain(path string) error {
+	if path == "" {
+		return usageErrorf("-chain is required")
+	}
+	return nil
+}
+
+// requireDifferentOutput returns a usageError if output is the same file as
+// input. Creating the output would truncate the input before it's read.
+func requireDifferentOutput(input, output string) error {
+	inInfo, err := os.Stat(input)
+	if err != nil {
+		return nil
+	}
+
+	outInfo, err := os.Stat(output)
+	if err != nil {
+		return nil
+	}
+
+	if os.SameFile(inInfo, outInfo) {
+		return usageErrorf("-out can't be the same file as -chain")
+	}
+	return nil
+}
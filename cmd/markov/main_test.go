@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pboyd/markov"
+)
+
+// testText has no dead ends, the last word follows the first.
+const testText = "the cat sat on the mat the dog sat on the cat"
+
+// runCommand runs a command with the given STDIN and returns what it wrote to
+// STDOUT.
+func runCommand(t *testing.T, cmd *command, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	inPath := filepath.Join(dir, "stdin")
+	err := os.WriteFile(inPath, []byte(stdin), 0666)
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	in, err := os.Open(inPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer out.Close()
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, out
+	defer func() {
+		os.Stdin, os.Stdout = oldStdin, oldStdout
+	}()
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	runErr := cmd.run(fs, args)
+
+	output, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	return string(output), runErr
+}
+
+// buildChain builds a chain file from text and returns its path.
+func buildChain(t *testing.T, text string, args ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mkv")
+
+	args = append([]string{"-chain", path}, args...)
+	_, err := runCommand(t, buildCommand, text, args...)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	return path
+}
+
+// readLinks returns the count of each transition between the words of text
+// in a chain file, as "parent -> child".
+func readLinks(t *testing.T, path, text string) map[string]int {
+	t.Helper()
+
+	file, err := markov.OpenDiskChainFile(path, markov.ReadMode)
+	if err != nil {
+		t.Fatalf("OpenDiskChainFile failed: %v", err)
+	}
+	defer file.Close()
+
+	links := map[string]int{}
+	for _, word := range strings.Fields(text) {
+		id, err := file.Find(word)
+		if err != nil {
+			t.Fatalf("Find(%q) failed: %v", word, err)
+		}
+
+		counts, err := markov.LinkCounts(file, id)
+		if err != nil {
+			t.Fatalf("LinkCounts failed: %v", err)
+		}
+
+		for _, lc := range counts {
+			child, err := file.Get(lc.ID)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			links[word+" -> "+format(child)] = lc.Count
+		}
+	}
+
+	return links
+}
+
+func assertSameLinks(t *testing.T, got, want map[string]int) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("got %d links, want %d", len(got), len(want))
+	}
+
+	for link, count := range want {
+		if got[link] != count {
+			t.Errorf("%s: got count %d, want %d", link, got[link], count)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	for _, cmd := range commands {
+		if cmd.name == "" || cmd.short == "" || strings.TrimSpace(cmd.long) == "" {
+			t.Errorf("%q: got empty name or help text", cmd.name)
+		}
+
+		if findCommand(cmd.name) != cmd {
+			t.Errorf("%s: findCommand returned a different command", cmd.name)
+		}
+
+		var buf bytes.Buffer
+		fs := newFlagSet(cmd)
+		fs.SetOutput(&buf)
+		fs.Usage()
+
+		want := "usage: markov " + cmd.name + " [flags]"
+		if !strings.HasPrefix(buf.String(), want) {
+			t.Errorf("%s: got usage %q, want it to start with %q", cmd.name, buf.String(), want)
+		}
+	}
+
+	if findCommand("nope") != nil {
+		t.Errorf("found an unknown command")
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	chain := buildChain(t, testText)
+
+	cases := []struct {
+		cmd  *command
+		args []string
+	}{
+		{buildCommand, nil},
+		{buildCommand, []string{"-chain", "x.mkv", "-n", "0"}},
+		{buildCommand, []string{"-chain", "x.mkv", "-tokens", "regexp"}},
+		{buildCommand, []string{"-chain", "x.mkv", "-tokens", "regexp", "-pattern", "("}},
+		{buildCommand, []string{"-chain", "x.mkv", "-pattern", "a"}},
+		{buildCommand, []string{"-chain", "x.mkv", "-tokens", "nope"}},
+		{buildCommand, []string{"-chain", "x.mkv", "-punct", "nope"}},
+		{buildCommand, []string{"-chain", "x.mkv", "-normalize", "nope"}},
+		{importCommand, nil},
+		{importCommand, []string{"-chain", "x.mkv", "-format", "nope"}},
+		{exportCommand, nil},
+		{exportCommand, []string{"-chain", chain, "-format", "nope"}},
+		{walkCommand, nil},
+		{walkCommand, []string{"-chain", chain, "-seed", "1", "-delimiter", `\q`}},
+		{walkCommand, []string{"-chain", chain, "-seed", "1", "-format", "nope"}},
+		{optimizeCommand, nil},
+		{optimizeCommand, []string{"-chain", chain}},
+		{optimizeCommand, []string{"-chain", chain, "-out", chain}},
+		{compactCommand, nil},
+		{compactCommand, []string{"-chain", chain, "-order", "nope"}},
+		{compactCommand, []string{"-chain", chain, "-headroom", "-1"}},
+		{compactCommand, []string{"-chain", chain, "-out", chain}},
+		{statCommand, nil},
+		{serveCommand, nil},
+		{replCommand, nil},
+	}
+
+	for _, c := range cases {
+		_, err := runCommand(t, c.cmd, "", c.args...)
+
+		var ue *usageError
+		if !errors.As(err, &ue) {
+			t.Errorf("%s %v: got error %v, want a usage error", c.cmd.name, c.args, err)
+		}
+	}
+}
+
+func TestBuildWalk(t *testing.T) {
+	chain := buildChain(t, testText)
+
+	args := []string{"-chain", chain, "-seed", "1", "-count", "20", "-start", "the"}
+
+	first, err := runCommand(t, walkCommand, "", args...)
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	words := strings.Fields(first)
+	if len(words) != 21 {
+		t.Fatalf("got %d values, want 21", len(words))
+	}
+
+	if words[0] != "the" {
+		t.Errorf("got first value %q, want %q", words[0], "the")
+	}
+
+	links := readLinks(t, chain, testText)
+	for i := 1; i < len(words); i++ {
+		link := words[i-1] + " -> " + words[i]
+		if links[link] == 0 {
+			t.Errorf("got transition %q, which isn't in the chain", link)
+		}
+	}
+
+	second, err := runCommand(t, walkCommand, "", args...)
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	if second != first {
+		t.Errorf("got %q with the same seed, want %q", second, first)
+	}
+
+	text, err := runCommand(t, walkCommand, "", "-chain", chain, "-seed", "1", "-count", "3", "-start", "the", "-format", "text")
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	if !strings.HasPrefix(text, "The ") {
+		t.Errorf("got text %q, want it to start with %q", text, "The ")
+	}
+
+	_, err = runCommand(t, walkCommand, "", "-chain", chain, "-seed", "1", "-start", "nope")
+	if err == nil {
+		t.Errorf("walk from a missing value succeeded, want an error")
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	chain := buildChain(t, "The cat, the CAT.", "-fold")
+	assertSameLinks(t, readLinks(t, chain, "the cat"), map[string]int{
+		"the -> cat": 2,
+		"cat -> the": 1,
+	})
+
+	chain = buildChain(t, "a b c a b", "-n", "2")
+	out, err := runCommand(t, walkCommand, "", "-chain", chain, "-seed", "1", "-count", "1", "-start", "a b")
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	if want := "a b b c \n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestBuildUpdate(t *testing.T) {
+	chain := buildChain(t, "a b a")
+
+	_, err := runCommand(t, buildCommand, "a c a", "-chain", chain, "-update")
+	if err != nil {
+		t.Fatalf("build -update failed: %v", err)
+	}
+
+	assertSameLinks(t, readLinks(t, chain, "a b c"), map[string]int{
+		"a -> b": 1,
+		"b -> a": 1,
+		"a -> c": 1,
+		"c -> a": 1,
+	})
+
+	// Without -update the file is replaced.
+	_, err = runCommand(t, buildCommand, "a c a", "-chain", chain, "-disk")
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	assertSameLinks(t, readLinks(t, chain, "a c"), map[string]int{
+		"a -> c": 1,
+		"c -> a": 1,
+	})
+}
+
+func TestBuildLocked(t *testing.T) {
+	chain := buildChain(t, "a b a")
+
+	// A served chain stays open, so writers fail unless they're told to wait.
+	reader, err := markov.OpenDiskChainFile(chain, markov.ReadMode)
+	if err != nil {
+		t.Fatalf("OpenDiskChainFile failed: %v", err)
+	}
+
+	_, err = runCommand(t, buildCommand, "a c a", "-chain", chain, "-update")
+	if err == nil || !strings.Contains(err.Error(), "markov serve") {
+		t.Errorf("build -update of a chain in use: got error %v, want one naming markov serve", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		reader.Close()
+	}()
+
+	_, err = runCommand(t, buildCommand, "a c a", "-chain", chain, "-update", "-wait")
+	if err != nil {
+		t.Fatalf("build -update -wait failed: %v", err)
+	}
+
+	assertSameLinks(t, readLinks(t, chain, "a b c"), map[string]int{
+		"a -> b": 1,
+		"b -> a": 1,
+		"a -> c": 1,
+		"c -> a": 1,
+	})
+}
+
+func TestImportExport(t *testing.T) {
+	chain := buildChain(t, testText)
+	want := readLinks(t, chain, testText)
+
+	exported, err := runCommand(t, exportCommand, "", "-chain", chain)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	imported := filepath.Join(t.TempDir(), "imported.mkv")
+	_, err = runCommand(t, importCommand, exported, "-chain", imported)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	assertSameLinks(t, readLinks(t, imported, testText), want)
+
+	for _, format := range []string{"dot", "graphml", "csv", "mtx"} {
+		out, err := runCommand(t, exportCommand, "", "-chain", chain, "-format", format)
+		if err != nil {
+			t.Errorf("export -format %s failed: %v", format, err)
+			continue
+		}
+
+		if out == "" {
+			t.Errorf("export -format %s: got no output", format)
+		}
+	}
+}
+
+func TestOptimizeCompact(t *testing.T) {
+	chain := buildChain(t, testText)
+	want := readLinks(t, chain, testText)
+	dir := t.TempDir()
+
+	for _, args := range [][]string{nil, {"-compact"}, {"-compress"}} {
+		out := filepath.Join(dir, "optimized.mkv")
+
+		_, err := runCommand(t, optimizeCommand, "", append([]string{"-chain", chain, "-out", out}, args...)...)
+		if err != nil {
+			t.Fatalf("optimize %v failed: %v", args, err)
+		}
+
+		assertSameLinks(t, readLinks(t, out, testText), want)
+	}
+
+	for _, order := range []string{"bfs", "frequency", "source"} {
+		out := filepath.Join(dir, "compacted.mkv")
+
+		_, err := runCommand(t, compactCommand, "", "-chain", chain, "-out", out, "-order", order)
+		if err != nil {
+			t.Fatalf("compact -order %s failed: %v", order, err)
+		}
+
+		assertSameLinks(t, readLinks(t, out, testText), want)
+	}
+
+	_, err := runCommand(t, compactCommand, "", "-chain", chain, "-headroom", "0")
+	if err != nil {
+		t.Fatalf("compact in place failed: %v", err)
+	}
+
+	assertSameLinks(t, readLinks(t, chain, testText), want)
+}
+
+func TestCompactInPlace(t *testing.T) {
+	chain := buildChain(t, testText)
+	want := readLinks(t, chain, testText)
+
+	// In place, compact needs the chain to itself.
+	reader, err := markov.OpenDiskChainFile(chain, markov.ReadMode)
+	if err != nil {
+		t.Fatalf("OpenDiskChainFile failed: %v", err)
+	}
+
+	_, err = runCommand(t, compactCommand, "", "-chain", chain)
+	if err == nil || !strings.Contains(err.Error(), "markov serve") {
+		t.Errorf("compact in place of a chain in use: got error %v, want one naming markov serve", err)
+	}
+	reader.Close()
+
+	_, err = runCommand(t, compactCommand, "", "-chain", chain+".missing")
+	if !os.IsNotExist(err) {
+		t.Errorf("compact of a missing file: got error %v, want not exist", err)
+	}
+
+	// Compressed chains can't be opened for writing, but can still be
+	// compacted in place.
+	compressed := chain + ".gz"
+	_, err = runCommand(t, optimizeCommand, "", "-chain", chain, "-out", compressed, "-compress")
+	if err != nil {
+		t.Fatalf("optimize failed: %v", err)
+	}
+
+	_, err = runCommand(t, compactCommand, "", "-chain", compressed)
+	if err != nil {
+		t.Fatalf("compact in place failed: %v", err)
+	}
+
+	assertSameLinks(t, readLinks(t, compressed, testText), want)
+
+	_, err = runCommand(t, buildCommand, "a b", "-chain", compressed, "-update")
+	if err != nil {
+		t.Errorf("build -update of the compacted chain failed: %v", err)
+	}
+}
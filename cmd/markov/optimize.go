@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pboyd/markov"
+)
+
+var optimizeCommand = &command{
+	name:  "optimize",
+	short: "rewrite a chain for faster reads",
+	long: `
+Optimize copies a chain to a new file that's optimized for reading.
+
+Links between values are stored in one or more buckets. The buckets typically
+contain unused space where new links are added. Optimize copies each value's
+links into a single, correctly-sized, bucket. This reduces the file size and
+I/O operations on subsequent reads.
+
+This comes at the expense of future writes. A new link added to an
+"optimized" chain will go into new bucket, and therefore be slower. To
+reclaim space in a chain that will still be updated, use "markov compact".
+
+The output is always written in the current file format, so optimize also
+upgrades chain files written by older versions (e.g. to store link counts
+larger than 32 bits). Link counts are copied exactly.
+
+With -compact, links are stored in a variable-length encoding instead of
+buckets. Compact files are smaller still, but links can't be added to the
+existing values at all.
+
+With -compress, the output is split into blocks which are compressed
+individually. Compressed files are read-only.
+`,
+	run: runOptimize,
+}
+
+func runOptimize(fs *flag.FlagSet, args []string) error {
+	input := fs.String("chain", "", "path to the input chain file")
+	output := fs.String("out", "", "path to the output chain file")
+	compact := fs.Bool("compact", false, "write links in a compact, read-only encoding")
+	compress := fs.Bool("compress", false, "compress the output file")
+	fs.Parse(args)
+
+	err := requireChain(*input)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return usageErrorf("-out is required")
+	}
+
+	err = requireDifferentOutput(*input, *output)
+	if err != nil {
+		return err
+	}
+
+	inChain, err := markov.OpenDiskChainFile(*input, markov.ReadMode)
+	if err != nil {
+		return err
+	}
+	defer inChain.Close()
+
+	outFile, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	chainFile := outFile
+	if *compress {
+		chainFile, err = os.CreateTemp(filepath.Dir(*output), ".markov-optimize-*")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %v", err)
+		}
+		defer os.Remove(chainFile.Name())
+		defer chainFile.Close()
+	}
+
+	outChain, err := markov.NewDiskChainWriter(chainFile)
+	if err != nil {
+		return fmt.Errorf("error creating output %s: %v", *output, err)
+	}
+	outChain.Compact = *compact
+
+	err = outChain.BulkLoad(inChain, nil)
+	if err != nil {
+		return fmt.Errorf("error copying chain: %v", err)
+	}
+
+	if *compress {
+		err = markov.CompressDiskChain(outFile, chainFile)
+		if err != nil {
+			return fmt.Errorf("error compressing chain: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pboyd/markov"
+)
+
+var replCommand = &command{
+	name:  "repl",
+	short: "explore a chain interactively",
+	long: `
+Repl opens a chain file and runs commands to explore it.
+
+Commands:
+
+	links <value>		list the values that follow a value
+	walk [start] [n]	generate n values (default 20) after start, or
+				after a random value
+	seed [n]		show or set the random seed
+	score <values...>	show the probability of a sequence
+	find <value>		show the ID of a value, or values that start
+				with it
+	random			show a random value
+	path <from> <to>	show the most likely path between two values
+	stats			show statistics about the chain
+	help			list the commands
+	quit			exit
+
+Arguments are separated by spaces. Values that contain spaces (such as the
+N-grams written by "markov build -n 2") can be quoted, e.g. links "of the".
+
+On a terminal, the up and down arrows move through the command history and
+tab completes commands and values. The history is saved to -history.
+`,
+	run: runRepl,
+}
+
+func runRepl(fs *flag.FlagSet, args []string) error {
+	home, _ := os.UserHomeDir()
+	defaultHistory := ""
+	if home != "" {
+		defaultHistory = filepath.Join(home, ".markov_history")
+	}
+
+	source := fs.String("chain", "", "path to the chain file")
+	seed := fs.Int64("seed", 0, "random seed")
+	historyPath := fs.String("history", defaultHistory, "path to the history file, or empty to disable")
+	fs.Parse(args)
+
+	err := requireChain(*source)
+	if err != nil {
+		return err
+	}
+
+	file, err := markov.OpenDiskChainFile(*source, markov.ReadMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r, err := newREPL(file.DiskChain(nil), os.Stdout)
+	if err != nil {
+		return fmt.Errorf("unable to read chain: %v", err)
+	}
+
+	if *seed != 0 {
+		r.setSeed(*seed)
+	}
+
+	editor := newLineEditor(os.Stdin, os.Stdout, "> ")
+	editor.complete = r.complete
+	if *historyPath != "" {
+		editor.history = readHistory(*historyPath)
+	}
+
+	for {
+		line, err := editor.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("error reading input: %v", err)
+			}
+			return nil
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if *historyPath != "" {
+			appendHistory(*historyPath, line)
+		}
+
+		if !r.run(line) {
+			return nil
+		}
+	}
+}
+
+// readHistory returns the lines in the history file.
+func readHistory(path string) []string {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer fh.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+	}
+
+	return history
+}
+
+// appendHistory adds a line to the history file. Errors are ignored, the
+// history is a convenience.
+func appendHistory(path, line string) {
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	fmt.Fprintln(fh, line)
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pboyd/markov"
+)
+
+// maxMatches is the number of values listed by find and tab completion.
+const maxMatches = 50
+
+type replCmd struct {
+	usage string
+	run   func(r *repl, args []string) error
+}
+
+var replCommands map[string]replCmd
+
+func init() {
+	replCommands = map[string]replCmd{
+		"links":  {"links <value>", (*repl).links},
+		"walk":   {"walk [start] [n]", (*repl).walk},
+		"seed":   {"seed [n]", (*repl).seed},
+		"score":  {"score <values...>", (*repl).score},
+		"find":   {"find <value>", (*repl).find},
+		"random": {"random", (*repl).random},
+		"path":   {"path <from> <to>", (*repl).path},
+		"stats":  {"stats", (*repl).stats},
+		"help":   {"help", (*repl).help},
+	}
+}
+
+type repl struct {
+	chain *markov.DiskChain
+	out   io.Writer
+
+	// names holds every value in the chain, formatted and sorted, for
+	// completion. values holds the values in the chain's order.
+	names  []string
+	values []interface{}
+
+	rng        *rand.Rand
+	randomSeed int64
+}
+
+func newREPL(chain *markov.DiskChain, out io.Writer) (*repl, error) {
+	r := &repl{
+		chain: chain,
+		out:   out,
+	}
+	r.setSeed(time.Now().UnixNano())
+
+	walker := markov.IterativeWalker(chain)
+	for {
+		value, err := walker.Next()
+		if err != nil {
+			if err == markov.ErrBrokenChain {
+				break
+			}
+			return nil, err
+		}
+
+		r.values = append(r.values, value)
+		r.names = append(r.names, format(value))
+	}
+
+	sort.Strings(r.names)
+
+	return r, nil
+}
+
+// run runs a command line. It returns false if the REPL should exit.
+func (r *repl) run(line string) bool {
+	args, err := splitArgs(line)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return true
+	}
+
+	name := args[0]
+	if name == "quit" || name == "exit" {
+		return false
+	}
+
+	cmd, ok := replCommands[name]
+	if !ok {
+		fmt.Fprintf(r.out, "unknown command %q, try \"help\"\n", name)
+		return true
+	}
+
+	err = cmd.run(r, args[1:])
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+	}
+
+	return true
+}
+
+var (
+	errUsage = errors.New("wrong number of arguments")
+	errEmpty = errors.New("the chain is empty")
+)
+
+func (r *repl) help(args []string) error {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(r.out, "  %s\n", replCommands[name].usage)
+	}
+	fmt.Fprintln(r.out, "  quit")
+
+	return nil
+}
+
+func (r *repl) links(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	id, err := r.findValue(args[0])
+	if err != nil {
+		return err
+	}
+
+	counts, err := markov.LinkCounts(r.chain, id)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+
+	var total float64
+	for _, lc := range counts {
+		total += float64(lc.Count)
+	}
+
+	w := tabwriter.NewWriter(r.out, 0, 8, 2, ' ', 0)
+	for _, lc := range counts {
+		value, err := r.chain.Get(lc.ID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "  %s\t%d\t%.4f\n", format(value), lc.Count, float64(lc.Count)/total)
+	}
+
+	if len(counts) == 0 {
+		fmt.Fprintln(w, "  (no links)")
+	}
+
+	return w.Flush()
+}
+
+func (r *repl) walk(args []string) error {
+	count := 20
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[len(args)-1]); err == nil {
+			count = n
+			args = args[:len(args)-1]
+		}
+	}
+
+	if len(args) > 1 {
+		return errUsage
+	}
+
+	var id int
+	var parts []string
+	if len(args) == 1 {
+		var err error
+		id, err = r.findValue(args[0])
+		if err != nil {
+			return err
+		}
+		parts = append(parts, args[0])
+	} else {
+		if len(r.values) == 0 {
+			return errEmpty
+		}
+
+		value := r.values[r.rng.Intn(len(r.values))]
+		var err error
+		id, err = r.chain.Find(value)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, format(value))
+	}
+
+	walker := markov.RandomWalkerWithRand(r.chain, id, r.rng)
+	for i := 0; i < count; i++ {
+		value, err := walker.Next()
+		if err != nil {
+			if err == markov.ErrBrokenChain {
+				parts = append(parts, "(end)")
+				break
+			}
+			return err
+		}
+
+		parts = append(parts, format(value))
+	}
+
+	fmt.Fprintln(r.out, strings.Join(parts, " "))
+	return nil
+}
+
+func (r *repl) setSeed(seed int64) {
+	r.randomSeed = seed
+	r.rng = rand.New(rand.NewSource(seed))
+}
+
+func (r *repl) seed(args []string) error {
+	switch len(args) {
+	case 0:
+	case 1:
+		seed, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q", args[0])
+		}
+		r.setSeed(seed)
+	default:
+		return errUsage
+	}
+
+	fmt.Fprintf(r.out, "seed %d\n", r.randomSeed)
+	return nil
+}
+
+func (r *repl) score(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := r.findValue(arg)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	w := tabwriter.NewWriter(r.out, 0, 8, 2, ' ', 0)
+
+	var logProb float64
+	for i := 0; i < len(ids)-1; i++ {
+		p, err := r.probability(ids[i], ids[i+1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "  %s -> %s\t%.4f\n", args[i], args[i+1], p)
+		logProb += math.Log(p)
+	}
+
+	fmt.Fprintf(w, "  total\t%.4g\t(log %.4f)\n", math.Exp(logProb), logProb)
+
+	return w.Flush()
+}
+
+// probability returns the probability that child follows parent.
+func (r *repl) probability(parent, child int) (float64, error) {
+	links, err := r.chain.Links(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, l := range links {
+		if l.ID == child {
+			return l.Probability, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (r *repl) find(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	id, err := r.findValue(args[0])
+	if err == nil {
+		fmt.Fprintf(r.out, "  %s: ID %d\n", args[0], id)
+		return nil
+	}
+
+	matches := r.matches(args[0])
+	if len(matches) == 0 {
+		return err
+	}
+
+	fmt.Fprintf(r.out, "  %s not found, values starting with it:\n", args[0])
+	r.printMatches(matches)
+	return nil
+}
+
+func (r *repl) random(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	if len(r.values) == 0 {
+		return errEmpty
+	}
+
+	fmt.Fprintln(r.out, format(r.values[r.rng.Intn(len(r.values))]))
+	return nil
+}
+
+func (r *repl) path(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	from, err := r.findValue(args[0])
+	if err != nil {
+		return err
+	}
+
+	to, err := r.findValue(args[1])
+	if err != nil {
+		return err
+	}
+
+	ids, p, err := mostLikelyPath(r.chain, from, to)
+	if err != nil {
+		return err
+	}
+
+	if ids == nil {
+		fmt.Fprintln(r.out, "  (no path)")
+		return nil
+	}
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		value, err := r.chain.Get(id)
+		if err != nil {
+			return err
+		}
+		parts[i] = format(value)
+	}
+
+	fmt.Fprintf(r.out, "  %s\n  probability %.4g\n", strings.Join(parts, " -> "), p)
+	return nil
+}
+
+// mostLikelyPath finds the path from one value to another with the highest
+// probability. It returns nil if there's no path.
+func mostLikelyPath(chain markov.Chain, from, to int) ([]int, float64, error) {
+	// This is Dijkstra's algorithm where the cost of each link is the
+	// negative log of its probability. The start isn't marked as visited,
+	// so a path from a value back to itself can be found.
+	cost := map[int]float64{}
+	prev := map[int]int{}
+	done := map[int]bool{}
+	queue := &pathQueue{}
+
+	expand := func(id int, base float64) error {
+		links, err := chain.Links(id)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range links {
+			if l.ID == from && from != to {
+				continue
+			}
+
+			c := base - math.Log(l.Probability)
+			if existing, ok := cost[l.ID]; ok && existing <= c {
+				continue
+			}
+
+			cost[l.ID] = c
+			prev[l.ID] = id
+			heap.Push(queue, pathItem{id: l.ID, cost: c})
+		}
+
+		return nil
+	}
+
+	err := expand(from, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(pathItem)
+		if done[item.id] {
+			continue
+		}
+		done[item.id] = true
+
+		if item.id == to {
+			break
+		}
+
+		err = expand(item.id, item.cost)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if !done[to] {
+		return nil, 0, nil
+	}
+
+	ids := []int{to}
+	for id := prev[to]; ; id = prev[id] {
+		ids = append(ids, id)
+		if id == from {
+			break
+		}
+	}
+
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+
+	return ids, math.Exp(-cost[to]), nil
+}
+
+type pathItem struct {
+	id   int
+	cost float64
+}
+
+// pathQueue is a priority queue of pathItems with the lowest cost first.
+type pathQueue []pathItem
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathItem)) }
+
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+func (r *repl) stats(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	var transitions, deadEnds, maxDegree int
+	for _, value := range r.values {
+		id, err := r.chain.Find(value)
+		if err != nil {
+			return err
+		}
+
+		counts, err := markov.LinkCounts(r.chain, id)
+		if err != nil {
+			return err
+		}
+
+		if len(counts) == 0 {
+			deadEnds++
+		}
+		if len(counts) > maxDegree {
+			maxDegree = len(counts)
+		}
+
+		for _, lc := range counts {
+			transitions += lc.Count
+		}
+	}
+
+	usage, err := r.chain.Usage()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(r.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "  values\t%d\n", len(r.values))
+	fmt.Fprintf(w, "  transitions\t%d\n", transitions)
+	fmt.Fprintf(w, "  dead ends\t%d\n", deadEnds)
+	fmt.Fprintf(w, "  max out-degree\t%d\n", maxDegree)
+	fmt.Fprintf(w, "  file version\t%d\n", usage.Version)
+	fmt.Fprintf(w, "  file size\t%d\n", usage.Size())
+	fmt.Fprintf(w, "  slack\t%d\n", usage.Slack)
+
+	return w.Flush()
+}
+
+// findValue finds the ID of a value, see the findValue function.
+func (r *repl) findValue(value string) (int, error) {
+	id, err := findValue(r.chain, value)
+	if err == markov.ErrNotFound {
+		return 0, fmt.Errorf("%q not found", value)
+	}
+
+	return id, err
+}
+
+// matches returns the names that start with prefix.
+func (r *repl) matches(prefix string) []string {
+	i := sort.SearchStrings(r.names, prefix)
+
+	var matches []string
+	for ; i < len(r.names) && strings.HasPrefix(r.names[i], prefix); i++ {
+		if len(matches) == 0 || matches[len(matches)-1] != r.names[i] {
+			matches = append(matches, r.names[i])
+		}
+	}
+
+	return matches
+}
+
+func (r *repl) printMatches(matches []string) {
+	for i, m := range matches {
+		if i == maxMatches {
+			fmt.Fprintf(r.out, "  (%d more)\n", len(matches)-i)
+			break
+		}
+		fmt.Fprintf(r.out, "  %s\n", m)
+	}
+}
+
+// complete returns the completions for the argument ending at the end of
+// line, and the position in line where it starts.
+func (r *repl) complete(line string) (int, []string) {
+	start, quoted, first := lastArg(line)
+	prefix := line[start:]
+
+	var candidates []string
+	if first {
+		for name := range replCommands {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name+" ")
+			}
+		}
+		sort.Strings(candidates)
+		return start, candidates
+	}
+
+	if prefix == "" {
+		// Too many to be useful.
+		return start, nil
+	}
+
+	matches := r.matches(prefix)
+
+	// Values with spaces need quotes, and so does the argument if any of
+	// them match.
+	if !quoted {
+		for _, m := range matches {
+			if strings.ContainsAny(m, " \"") {
+				quoted = true
+				break
+			}
+		}
+		if quoted {
+			for _, m := range matches {
+				candidates = append(candidates, `"`+m+`" `)
+			}
+			return start, candidates
+		}
+	}
+
+	for _, m := range matches {
+		if quoted {
+			candidates = append(candidates, m+`" `)
+		} else {
+			candidates = append(candidates, m+" ")
+		}
+	}
+
+	return start, candidates
+}
+
+// lastArg returns the start of the last argument in line, whether it's
+// quoted, and whether it's the first argument. The start is after the
+// opening quote.
+func lastArg(line string) (start int, quoted bool, first bool) {
+	args := 0
+	inArg := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted:
+			if c == '"' {
+				quoted = false
+			}
+		case c == ' ':
+			inArg = false
+		default:
+			if !inArg {
+				inArg = true
+				args++
+				start = i
+			}
+			if c == '"' {
+				quoted = true
+				start = i + 1
+			}
+		}
+	}
+
+	if !inArg && !quoted {
+		return len(line), false, args == 0
+	}
+
+	return start, quoted, args <= 1
+}
+
+// splitArgs splits a line into space-separated arguments. Double quotes group
+// words into one argument.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, quoted := false, false
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case c == ' ' && !quoted:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
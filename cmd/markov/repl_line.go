@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// lineEditor reads lines with history and tab completion when the input is a
+// terminal. Otherwise it reads lines without a prompt.
+type lineEditor struct {
+	in     *os.File
+	reader *bufio.Reader
+	out    io.Writer
+	prompt string
+
+	history []string
+
+	// complete returns completions for the text before the cursor. The
+	// completions replace the text from start.
+	complete func(line string) (start int, candidates []string)
+
+	buf []rune
+	pos int
+}
+
+func newLineEditor(in *os.File, out io.Writer, prompt string) *lineEditor {
+	return &lineEditor{
+		in:     in,
+		reader: bufio.NewReader(in),
+		out:    out,
+		prompt: prompt,
+	}
+}
+
+// ReadLine reads a line. It returns io.EOF at the end of the input, or when
+// Ctrl-D is pressed on an empty line.
+func (e *lineEditor) ReadLine() (string, error) {
+	restore, err := makeRaw(int(e.in.Fd()))
+	if err != nil {
+		// Not a terminal.
+		line, err := e.reader.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	defer restore()
+
+	line, err := e.edit()
+	if err == nil && line != "" {
+		e.history = append(e.history, line)
+	}
+
+	return line, err
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+func (e *lineEditor) edit() (string, error) {
+	e.buf = e.buf[:0]
+	e.pos = 0
+
+	// histIndex is the history entry being edited. len(e.history) is the
+	// new line, which is saved in pending while browsing the history.
+	histIndex := len(e.history)
+	var pending []rune
+
+	setLine := func(line []rune) {
+		e.buf = append(e.buf[:0], line...)
+		e.pos = len(e.buf)
+	}
+
+	history := func(index int) {
+		if index < 0 || index > len(e.history) {
+			return
+		}
+
+		if histIndex == len(e.history) {
+			pending = append(pending[:0], e.buf...)
+		}
+
+		histIndex = index
+		if index == len(e.history) {
+			setLine(pending)
+		} else {
+			setLine([]rune(e.history[index]))
+		}
+	}
+
+	e.redraw()
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.buf), nil
+
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", nil
+
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos)
+
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.delete(e.pos)
+			}
+
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.left()
+		case keyCtrlF:
+			e.right()
+		case keyCtrlP:
+			history(histIndex - 1)
+		case keyCtrlN:
+			history(histIndex + 1)
+
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+
+		case keyCtrlU:
+			e.buf = append(e.buf[:0], e.buf[e.pos:]...)
+			e.pos = 0
+
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+
+		case keyTab:
+			e.completeLine()
+
+		case keyEscape:
+			err = e.escape(func(dir int) { history(histIndex + dir) })
+			if err != nil {
+				return "", err
+			}
+
+		default:
+			if r < ' ' {
+				continue
+			}
+			e.insert(string(r))
+		}
+
+		e.redraw()
+	}
+}
+
+// escape handles an escape sequence. Arrow keys move the cursor, or call
+// history with -1 for up and 1 for down.
+func (e *lineEditor) escape(history func(dir int)) error {
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return err
+	}
+	if r != '[' && r != 'O' {
+		return nil
+	}
+
+	r, _, err = e.reader.ReadRune()
+	if err != nil {
+		return err
+	}
+
+	switch r {
+	case 'A':
+		history(-1)
+	case 'B':
+		history(1)
+	case 'C':
+		e.right()
+	case 'D':
+		e.left()
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	case '3':
+		// Delete is "\x1b[3~".
+		r, _, err = e.reader.ReadRune()
+		if err != nil {
+			return err
+		}
+		if r == '~' {
+			e.delete(e.pos)
+		}
+	}
+
+	return nil
+}
+
+func (e *lineEditor) left() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *lineEditor) right() {
+	if e.pos < len(e.buf) {
+		e.pos++
+	}
+}
+
+func (e *lineEditor) insert(s string) {
+	runes := []rune(s)
+	e.buf = append(e.buf[:e.pos], append(runes, e.buf[e.pos:]...)...)
+	e.pos += len(runes)
+}
+
+func (e *lineEditor) delete(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+// completeLine completes the text before the cursor. A single completion is
+// inserted. With several, their common prefix is inserted, or if there's
+// nothing to insert, they're listed.
+func (e *lineEditor) completeLine() {
+	if e.complete == nil {
+		return
+	}
+
+	before := string(e.buf[:e.pos])
+	start, candidates := e.complete(before)
+	if len(candidates) == 0 {
+		return
+	}
+
+	replacement := candidates[0]
+	if len(candidates) > 1 {
+		replacement = commonPrefix(candidates)
+	}
+
+	if len(replacement) > len(before)-start {
+		after := string(e.buf[e.pos:])
+		e.buf = []rune(before[:start] + replacement)
+		e.pos = len(e.buf)
+		e.buf = append(e.buf, []rune(after)...)
+		return
+	}
+
+	fmt.Fprint(e.out, "\r\n")
+	for i, c := range candidates {
+		if i == maxMatches {
+			fmt.Fprintf(e.out, "(%d more)\r\n", len(candidates)-i)
+			break
+		}
+		fmt.Fprintf(e.out, "%s\r\n", strings.Trim(c, `" `))
+	}
+}
+
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func (e *lineEditor) redraw() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pboyd/markov"
+)
+
+// replLines runs the repl with script as STDIN and returns its output lines
+// with the columns separated by a single space.
+func replLines(t *testing.T, script string, args ...string) []string {
+	t.Helper()
+
+	out, err := runCommand(t, replCommand, script, args...)
+	if err != nil {
+		t.Fatalf("repl failed: %v", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	return lines
+}
+
+func TestREPL(t *testing.T) {
+	chain := buildChain(t, testText)
+	history := filepath.Join(t.TempDir(), "history")
+
+	script := strings.Join([]string{
+		"links the",
+		"find cat",
+		"find ca",
+		"score on the cat",
+		"path dog mat",
+		"stats",
+		"",
+		"seed 5",
+		"nope",
+		"links",
+		"links nope",
+		`links "the`,
+		"quit",
+		"stats",
+	}, "\n")
+
+	lines := replLines(t, script, "-chain", chain, "-seed", "1", "-history", history)
+
+	want := []string{
+		"cat 2 0.5000",
+		"mat 1 0.2500",
+		"dog 1 0.2500",
+		"cat: ID",
+		"ca not found, values starting with it:",
+		"cat",
+		"on -> the 1.0000",
+		"the -> cat 0.5000",
+		"total 0.5 (log -0.6931)",
+		"dog -> sat -> on -> the -> mat",
+		"probability 0.25",
+		"values 6",
+		"transitions 11",
+		"dead ends 0",
+		"max out-degree 3",
+		"file version",
+		"file size",
+		"slack",
+		"seed 5",
+		`unknown command "nope", try "help"`,
+		"error: wrong number of arguments",
+		`error: "nope" not found`,
+		"error: unterminated quote",
+	}
+
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), strings.Join(lines, "\n"))
+	}
+
+	for i := range want {
+		if !strings.HasPrefix(lines[i], want[i]) {
+			t.Errorf("line %d: got %q, want %q", i, lines[i], want[i])
+		}
+	}
+
+	// Blank lines aren't saved, and nothing is read after quit.
+	saved, err := os.ReadFile(history)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	wantHistory := strings.Replace(script, "\n\n", "\n", 1)
+	wantHistory = strings.TrimSuffix(wantHistory, "stats")
+	if string(saved) != wantHistory {
+		t.Errorf("got history %q, want %q", saved, wantHistory)
+	}
+}
+
+func TestREPLWalk(t *testing.T) {
+	chain := buildChain(t, testText)
+	script := "walk the 5\nwalk 3\nrandom\nseed\n"
+
+	first := replLines(t, script, "-chain", chain, "-seed", "1", "-history", "")
+	if len(first) != 4 {
+		t.Fatalf("got %d lines, want 4:\n%s", len(first), strings.Join(first, "\n"))
+	}
+
+	words := strings.Fields(first[0])
+	if len(words) != 6 || words[0] != "the" {
+		t.Errorf("got walk %q, want 6 values starting with \"the\"", first[0])
+	}
+
+	if n := len(strings.Fields(first[1])); n != 4 {
+		t.Errorf("got %d values from a random start, want 4", n)
+	}
+
+	if first[3] != "seed 1" {
+		t.Errorf("got %q, want %q", first[3], "seed 1")
+	}
+
+	second := replLines(t, script, "-chain", chain, "-seed", "1", "-history", "")
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("got %q with the same seed, want %q", second, first)
+	}
+}
+
+func TestREPLComplete(t *testing.T) {
+	chain := buildChain(t, "the cat sat on the cattle", "-n", "2")
+
+	file, err := markov.OpenDiskChainFile(chain, markov.ReadMode)
+	if err != nil {
+		t.Fatalf("OpenDiskChainFile failed: %v", err)
+	}
+	defer file.Close()
+
+	r, err := newREPL(file.DiskChain(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("newREPL failed: %v", err)
+	}
+
+	// Every command completes an empty line.
+	if _, got := r.complete(""); len(got) != len(replCommands) {
+		t.Errorf("got %d completions for an empty line, want %d", len(got), len(replCommands))
+	}
+
+	cases := []struct {
+		line  string
+		start int
+		want  []string
+	}{
+		{"s", 0, []string{"score ", "seed ", "stats "}},
+		{"links ", 6, nil},
+		{"links the", 6, []string{`"the cat" `, `"the cattle" `}},
+		{`links "the ca`, 7, []string{`the cat" `, `the cattle" `}},
+		{"links nope", 6, nil},
+	}
+
+	for _, c := range cases {
+		start, got := r.complete(c.line)
+		if start != c.start || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %d %q, want %d %q", c.line, start, got, c.start, c.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"links the", []string{"links", "the"}},
+		{"  walk   the  5 ", []string{"walk", "the", "5"}},
+		{`links "of the"`, []string{"links", "of the"}},
+		{`find ""`, []string{"find", ""}},
+		{`score "a b""c"`, []string{"score", "a bc"}},
+	}
+
+	for _, c := range cases {
+		got, err := splitArgs(c.line)
+		if err != nil {
+			t.Errorf("%q: got error %v", c.line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.line, got, c.want)
+		}
+	}
+
+	_, err := splitArgs(`links "the`)
+	if err == nil {
+		t.Errorf("got no error for an unterminated quote")
+	}
+}
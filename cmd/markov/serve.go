@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var serveCommand = &command{
+	name:  "serve",
+	short: "serve chains over HTTP",
+	long: `
+Serve serves chain files over HTTP.
+
+Each chain is given with -chain, optionally prefixed by a name (e.g.
+"-chain words=words.mkv"). Without a name, the file name is used without its
+extension. Files may be DiskChain files or MemoryChain snapshots. With
+-memory, DiskChain files are copied into memory when they're loaded.
+
+Files are checked for changes every -reload interval and reloaded once they've
+stopped changing. Requests that are in progress finish with the old chain.
+Replacing the file with a rename is safer than writing over it.
+
+DiskChain files stay open while they're served (unless -memory is given), so
+commands that write to them ("markov build", "markov import" and "markov
+compact" without -out) fail until the server exits, or wait for it with -wait.
+To update a chain that's being served, write a new file and rename it over the
+old one. If a file is being written when it's checked, the server keeps the
+old chain and tries again at the next check.
+
+Every endpoint takes a "chain" parameter with the name of the chain. It may be
+omitted when only one chain is loaded. Responses are JSON.
+
+	GET /generate	generate a sequence. Parameters: start (value to start
+			with), count (maximum number of values, default 100),
+			seed (random seed), delimiter (inserted between values
+			in "text", default a space) and stop (stop after this
+			value)
+	POST /score	score a sequence. The body is an object with a
+			"sequence" array. The response has the probability of
+			the sequence and lists transitions that aren't in the
+			chain.
+	GET /links	list the values that follow a value. Parameters: value
+	GET /health	list the loaded chains
+	POST /feed	add sequences to the chain (with -feed). See
+			markov.FeedHandler for the request format. Only chains
+			in memory can be updated.
+
+Sequences added with /feed are kept in memory only. They're lost when the
+chain file is reloaded or the server exits. When more than -feed-concurrent
+requests arrive at once, the rest are rejected with 503 Service Unavailable
+and should be retried.
+
+Values are given as strings. When a string isn't in the chain it's split into
+words and looked up as a tuple, so "a b" finds the N-gram ("a", "b").
+
+As an example:
+
+	markov serve -addr :8080 -chain words.mkv
+	curl 'localhost:8080/generate?count=20&start=the'
+`,
+	run: runServe,
+}
+
+type serveOptions struct {
+	inMemory       bool
+	maxCount       int
+	feed           bool
+	feedConcurrent int
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	var paths stringList
+	var opts serveOptions
+
+	fs.Var(&paths, "chain", "`[name=]path` to a chain file, may be repeated")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	reload := fs.Duration("reload", 5*time.Second, "how often to check chain files for changes, 0 to disable")
+	fs.BoolVar(&opts.inMemory, "memory", false, "copy chain files into memory")
+	fs.IntVar(&opts.maxCount, "max-count", 10000, "maximum number of values to generate per request")
+	fs.BoolVar(&opts.feed, "feed", false, "allow sequences to be added with POST /feed")
+	fs.IntVar(&opts.feedConcurrent, "feed-concurrent", 4, "maximum number of /feed requests to handle at once")
+	fs.Parse(args)
+
+	if len(paths) == 0 {
+		return usageErrorf("-chain is required")
+	}
+
+	chains := newChainSet(&opts)
+	defer chains.Close()
+
+	for _, path := range paths {
+		err := chains.Load(path)
+		if err != nil {
+			return fmt.Errorf("error loading %s: %v", path, err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: newServer(chains, &opts),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if *reload > 0 {
+		go chains.Watch(ctx, *reload, func(cf *chainFile, err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error reloading %s: %v\n", cf.path, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "reloaded %s\n", cf.path)
+		})
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		timeout, cancelTimeout := context.WithTimeout(ctx, 30*time.Second)
+		defer cancelTimeout()
+
+		err := srv.Shutdown(timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error shutting down: %v\n", err)
+		}
+		close(shutdown)
+	}()
+
+	err := srv.ListenAndServe()
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	<-shutdown
+	return nil
+}
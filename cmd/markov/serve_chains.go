@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pboyd/markov"
+)
+
+// snapshotMagic is the start of a MemoryChain snapshot.
+const snapshotMagic = "MKM"
+
+// chainFile is a chain loaded from a file.
+type chainFile struct {
+	name string
+	path string
+
+	// mu is read-locked while the chain is in use, and locked to replace
+	// it.
+	mu      sync.RWMutex
+	chain   markov.Chain
+	closer  io.Closer
+	modTime time.Time
+	size    int64
+	loaded  time.Time
+
+	// lastModTime and lastSize are from the last time the file was
+	// checked for changes.
+	lastModTime time.Time
+	lastSize    int64
+
+	// feed adds sequences to the chain, when it can be written.
+	feed *markov.FeedHandler
+}
+
+// chainSet holds the chains being served.
+type chainSet struct {
+	opts *serveOptions
+
+	mu     sync.RWMutex
+	chains map[string]*chainFile
+}
+
+func newChainSet(opts *serveOptions) *chainSet {
+	return &chainSet{
+		opts:   opts,
+		chains: map[string]*chainFile{},
+	}
+}
+
+// Load loads a chain file. arg is the path to the file, optionally prefixed by
+// a name and "=".
+func (cs *chainSet) Load(arg string) error {
+	name, path := arg, arg
+	if i := strings.Index(arg, "="); i >= 0 {
+		name, path = arg[:i], arg[i+1:]
+	} else {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, ok := cs.chains[name]; ok {
+		return fmt.Errorf("duplicate chain name %q", name)
+	}
+
+	cf := &chainFile{
+		name: name,
+		path: path,
+	}
+	cf.feed = &markov.FeedHandler{
+		Chain:         writableChain{cf},
+		Lock:          &cf.mu,
+		MaxConcurrent: cs.opts.feedConcurrent,
+	}
+
+	err := cf.load(cs.opts.inMemory)
+	if err != nil {
+		return err
+	}
+
+	cs.chains[name] = cf
+	return nil
+}
+
+// Get returns a chain by name. If name is empty and there's only one chain,
+// it's returned.
+func (cs *chainSet) Get(name string) (*chainFile, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if name == "" {
+		if len(cs.chains) == 1 {
+			for _, cf := range cs.chains {
+				return cf, nil
+			}
+		}
+		return nil, errors.New("chain parameter is required")
+	}
+
+	cf, ok := cs.chains[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown chain %q", name)
+	}
+
+	return cf, nil
+}
+
+// List returns every chain, sorted by name.
+func (cs *chainSet) List() []*chainFile {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	list := make([]*chainFile, 0, len(cs.chains))
+	for _, cf := range cs.chains {
+		list = append(list, cf)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+
+	return list
+}
+
+// Watch checks the chain files for changes every interval and reloads them
+// until ctx is done. reloaded is called after each reload attempt.
+func (cs *chainSet) Watch(ctx context.Context, interval time.Duration, reloaded func(*chainFile, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, cf := range cs.List() {
+			changed, err := cf.changed()
+			if err != nil || !changed {
+				// The file may be missing while it's being
+				// replaced. Try again next time.
+				continue
+			}
+
+			reloaded(cf, cf.load(cs.opts.inMemory))
+		}
+	}
+}
+
+// Close closes every chain file.
+func (cs *chainSet) Close() {
+	for _, cf := range cs.List() {
+		cf.mu.Lock()
+		if cf.closer != nil {
+			cf.closer.Close()
+		}
+		cf.mu.Unlock()
+	}
+}
+
+// writable returns true if the chain can be updated. Only chains in memory
+// can be.
+func (cf *chainFile) writable() bool {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+
+	_, ok := cf.chain.(*markov.MemoryChain)
+	return ok
+}
+
+// writableChain writes to the current chain of a chainFile. The chainFile
+// must be locked.
+type writableChain struct {
+	cf *chainFile
+}
+
+func (wc writableChain) Add(value interface{}) (int, error) {
+	chain, ok := wc.cf.chain.(*markov.MemoryChain)
+	if !ok {
+		return 0, markov.ErrReadOnly
+	}
+	return chain.Add(value)
+}
+
+func (wc writableChain) Relate(parent, child int, delta int) error {
+	chain, ok := wc.cf.chain.(*markov.MemoryChain)
+	if !ok {
+		return markov.ErrReadOnly
+	}
+	return chain.Relate(parent, child, delta)
+}
+
+// changed returns true if the file has been modified since it was loaded. To
+// avoid loading a partially written file, it only returns true once the file
+// is unchanged since the previous call.
+func (cf *chainFile) changed() (bool, error) {
+	info, err := os.Stat(cf.path)
+	if err != nil {
+		return false, err
+	}
+
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	settled := info.ModTime().Equal(cf.lastModTime) && info.Size() == cf.lastSize
+	cf.lastModTime = info.ModTime()
+	cf.lastSize = info.Size()
+
+	if !settled {
+		return false, nil
+	}
+
+	return !info.ModTime().Equal(cf.modTime) || info.Size() != cf.size, nil
+}
+
+// load reads the chain from the file and replaces the current chain. The
+// current chain is kept if there's an error.
+func (cf *chainFile) load(inMemory bool) error {
+	info, err := os.Stat(cf.path)
+	if err != nil {
+		return err
+	}
+
+	chain, closer, err := readChain(cf.path, inMemory)
+	if err != nil {
+		return err
+	}
+
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if cf.closer != nil {
+		cf.closer.Close()
+	}
+
+	cf.chain = chain
+	cf.closer = closer
+	cf.modTime = info.ModTime()
+	cf.size = info.Size()
+	cf.lastModTime = cf.modTime
+	cf.lastSize = cf.size
+	cf.loaded = time.Now()
+
+	return nil
+}
+
+// readChain reads a DiskChain file or a MemoryChain snapshot. DiskChain files
+// are copied into memory if inMemory is true, otherwise the returned Closer
+// must be closed when the chain is no longer needed.
+func readChain(path string, inMemory bool) (markov.Chain, io.Closer, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	magic := make([]byte, len(snapshotMagic))
+	_, err = fh.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		fh.Close()
+		return nil, nil, err
+	}
+
+	if bytes.Equal(magic, []byte(snapshotMagic)) {
+		defer fh.Close()
+
+		chain := markov.NewMemoryChain(0)
+		_, err = chain.ReadFrom(fh)
+		if err != nil {
+			return nil, nil, err
+		}
+		return chain, nil, nil
+	}
+	fh.Close()
+
+	// Don't wait for a file that's being written, it'll be reloaded
+	// once it's done.
+	diskChain, err := markov.OpenDiskChainFile(path, markov.ReadMode|markov.NoWait)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !inMemory {
+		return diskChain.DiskChain(nil), diskChain, nil
+	}
+	defer diskChain.Close()
+
+	chain := markov.NewMemoryChain(0)
+	err = markov.Copy(chain, diskChain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return chain, nil, nil
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pboyd/markov"
+)
+
+type server struct {
+	chains *chainSet
+	opts   *serveOptions
+	mux    *http.ServeMux
+}
+
+func newServer(chains *chainSet, opts *serveOptions) *server {
+	s := &server{
+		chains: chains,
+		opts:   opts,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/generate", s.handleGenerate)
+	s.mux.HandleFunc("/score", s.handleScore)
+	s.mux.HandleFunc("/links", s.handleLinks)
+	s.mux.HandleFunc("/health", s.handleHealth)
+	if opts.feed {
+		s.mux.HandleFunc("/feed", s.handleFeed)
+	}
+
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with an HTTP status code.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{
+		status: http.StatusBadRequest,
+		err:    fmt.Errorf(format, args...),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// withChain calls fn with the chain named in the request. The chain won't be
+// reloaded until fn returns.
+func (s *server) withChain(w http.ResponseWriter, r *http.Request, method string, fn func(markov.Chain) (interface{}, error)) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, &httpError{
+			status: http.StatusMethodNotAllowed,
+			err:    fmt.Errorf("method %s not allowed", r.Method),
+		})
+		return
+	}
+
+	cf, err := s.chains.Get(r.URL.Query().Get("chain"))
+	if err != nil {
+		writeError(w, &httpError{status: http.StatusNotFound, err: err})
+		return
+	}
+
+	cf.mu.RLock()
+	resp, err := fn(cf.chain)
+	cf.mu.RUnlock()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type generateResponse struct {
+	Seed   int64         `json:"seed"`
+	Values []interface{} `json:"values"`
+	Text   string        `json:"text"`
+}
+
+func (s *server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	s.withChain(w, r, http.MethodGet, func(chain markov.Chain) (interface{}, error) {
+		return generate(chain, r, s.opts.maxCount)
+	})
+}
+
+func generate(chain markov.Chain, r *http.Request, maxCount int) (*generateResponse, error) {
+	count := 100
+	if c := r.FormValue("count"); c != "" {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count < 0 {
+			return nil, badRequest("invalid count %q", c)
+		}
+	}
+	if count > maxCount {
+		return nil, badRequest("count must be at most %d", maxCount)
+	}
+
+	resp := &generateResponse{
+		Seed:   time.Now().UnixNano(),
+		Values: []interface{}{},
+	}
+	if seed := r.FormValue("seed"); seed != "" {
+		var err error
+		resp.Seed, err = strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return nil, badRequest("invalid seed %q", seed)
+		}
+	}
+	rng := rand.New(rand.NewSource(resp.Seed))
+
+	delimiter := " "
+	if d, ok := r.Form["delimiter"]; ok {
+		delimiter = d[0]
+	}
+
+	stop := r.FormValue("stop")
+
+	id := 0
+	var parts []string
+	if start := r.FormValue("start"); start != "" {
+		var err error
+		id, err = lookup(chain, start)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := chain.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		resp.Values = append(resp.Values, value)
+		parts = append(parts, start)
+	}
+
+	walker := markov.RandomWalkerWithRand(chain, id, rng)
+	for len(resp.Values) < count {
+		value, err := walker.Next()
+		if err != nil {
+			if err == markov.ErrBrokenChain {
+				break
+			}
+			return nil, err
+		}
+
+		text := format(value)
+		resp.Values = append(resp.Values, value)
+		parts = append(parts, text)
+
+		if stop != "" && text == stop {
+			break
+		}
+	}
+
+	resp.Text = strings.Join(parts, delimiter)
+	return resp, nil
+}
+
+type scoreRequest struct {
+	Sequence []string `json:"sequence"`
+}
+
+type scoreResponse struct {
+	Transitions int     `json:"transitions"`
+	Probability float64 `json:"probability"`
+
+	// LogProbability is the natural log of Probability. It's nil when
+	// Probability is 0.
+	LogProbability *float64 `json:"log_probability"`
+
+	// Missing has the index of the first value of each transition that's
+	// not in the chain.
+	Missing []int `json:"missing"`
+}
+
+func (s *server) handleScore(w http.ResponseWriter, r *http.Request) {
+	s.withChain(w, r, http.MethodPost, func(chain markov.Chain) (interface{}, error) {
+		var req scoreRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			return nil, badRequest("invalid request body: %v", err)
+		}
+
+		return score(chain, req.Sequence)
+	})
+}
+
+func score(chain markov.Chain, sequence []string) (*scoreResponse, error) {
+	if len(sequence) < 2 {
+		return nil, badRequest("sequence must have at least 2 values")
+	}
+
+	resp := &scoreResponse{
+		Transitions: len(sequence) - 1,
+		Missing:     []int{},
+	}
+
+	ids := make([]int, len(sequence))
+	for i, value := range sequence {
+		id, err := lookup(chain, value)
+		if err != nil {
+			var he *httpError
+			if !errors.As(err, &he) {
+				return nil, err
+			}
+			id = -1
+		}
+		ids[i] = id
+	}
+
+	var logProb float64
+	for i := 0; i < len(ids)-1; i++ {
+		p, err := probability(chain, ids[i], ids[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		if p == 0 {
+			resp.Missing = append(resp.Missing, i)
+			continue
+		}
+
+		logProb += math.Log(p)
+	}
+
+	if len(resp.Missing) == 0 {
+		resp.Probability = math.Exp(logProb)
+		resp.LogProbability = &logProb
+	}
+
+	return resp, nil
+}
+
+// probability returns the probability that child follows parent. IDs less
+// than 0 are values that aren't in the chain.
+func probability(chain markov.Chain, parent, child int) (float64, error) {
+	if parent < 0 || child < 0 {
+		return 0, nil
+	}
+
+	links, err := chain.Links(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, l := range links {
+		if l.ID == child {
+			return l.Probability, nil
+		}
+	}
+
+	return 0, nil
+}
+
+type linkResponse struct {
+	Value       interface{} `json:"value"`
+	Count       int         `json:"count"`
+	Probability float64     `json:"probability"`
+}
+
+type linksResponse struct {
+	Value interface{}    `json:"value"`
+	Links []linkResponse `json:"links"`
+}
+
+func (s *server) handleLinks(w http.ResponseWriter, r *http.Request) {
+	s.withChain(w, r, http.MethodGet, func(chain markov.Chain) (interface{}, error) {
+		value := r.FormValue("value")
+		if value == "" {
+			return nil, badRequest("value parameter is required")
+		}
+
+		id, err := lookup(chain, value)
+		if err != nil {
+			return nil, err
+		}
+
+		return links(chain, id)
+	})
+}
+
+func links(chain markov.Chain, id int) (*linksResponse, error) {
+	value, err := chain.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := markov.LinkCounts(chain, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var total float64
+	for _, lc := range counts {
+		total += float64(lc.Count)
+	}
+
+	resp := &linksResponse{
+		Value: value,
+		Links: make([]linkResponse, len(counts)),
+	}
+
+	for i, lc := range counts {
+		child, err := chain.Get(lc.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Links[i] = linkResponse{
+			Value:       child,
+			Count:       lc.Count,
+			Probability: float64(lc.Count) / total,
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	cf, err := s.chains.Get(r.URL.Query().Get("chain"))
+	if err != nil {
+		writeError(w, &httpError{status: http.StatusNotFound, err: err})
+		return
+	}
+
+	if !cf.writable() {
+		writeError(w, &httpError{
+			status: http.StatusConflict,
+			err:    fmt.Errorf("chain %q is read-only, load it with -memory to update it", cf.name),
+		})
+		return
+	}
+
+	cf.feed.ServeHTTP(w, r)
+}
+
+type chainStatus struct {
+	Name   string    `json:"name"`
+	Path   string    `json:"path"`
+	Loaded time.Time `json:"loaded"`
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Status string        `json:"status"`
+		Chains []chainStatus `json:"chains"`
+	}{
+		Status: "ok",
+	}
+
+	for _, cf := range s.chains.List() {
+		cf.mu.RLock()
+		status.Chains = append(status.Chains, chainStatus{
+			Name:   cf.name,
+			Path:   cf.path,
+			Loaded: cf.loaded,
+		})
+		cf.mu.RUnlock()
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// lookup finds the ID of a value, see findValue. Values that aren't found are
+// reported with 404 Not Found.
+func lookup(chain markov.Chain, value string) (int, error) {
+	id, err := findValue(chain, value)
+	if err == markov.ErrNotFound {
+		return 0, &httpError{
+			status: http.StatusNotFound,
+			err:    fmt.Errorf("value %q not found", value),
+		}
+	}
+
+	return id, err
+}
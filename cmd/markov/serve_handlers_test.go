@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves the chain files, given as for chainSet.Load.
+func newTestServer(t *testing.T, opts *serveOptions, chains ...string) *httptest.Server {
+	t.Helper()
+
+	if opts.maxCount == 0 {
+		opts.maxCount = 100
+	}
+
+	set := newChainSet(opts)
+	t.Cleanup(set.Close)
+
+	for _, chain := range chains {
+		err := set.Load(chain)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", chain, err)
+		}
+	}
+
+	srv := httptest.NewServer(newServer(set, opts))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// request sends a request and decodes the JSON response into v. It returns the
+// status code.
+func request(t *testing.T, method, url, contentType, body string, v interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: got Content-Type %q, want application/json", method, url, ct)
+	}
+
+	if v != nil {
+		err = json.NewDecoder(resp.Body).Decode(v)
+		if err != nil {
+			t.Fatalf("%s %s: error decoding response: %v", method, url, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+func TestServeGenerate(t *testing.T) {
+	srv := newTestServer(t, &serveOptions{}, buildChain(t, testText))
+
+	url := srv.URL + "/generate?seed=1&count=10&start=the&delimiter=_"
+
+	var first generateResponse
+	status := request(t, http.MethodGet, url, "", "", &first)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+
+	if first.Seed != 1 {
+		t.Errorf("got seed %d, want 1", first.Seed)
+	}
+
+	if len(first.Values) != 10 {
+		t.Errorf("got %d values, want 10", len(first.Values))
+	}
+
+	words := strings.Split(first.Text, "_")
+	if len(words) != len(first.Values) || words[0] != "the" {
+		t.Errorf("got text %q, want the values separated by _ starting with \"the\"", first.Text)
+	}
+
+	var second generateResponse
+	request(t, http.MethodGet, url, "", "", &second)
+	if second.Text != first.Text {
+		t.Errorf("got %q with the same seed, want %q", second.Text, first.Text)
+	}
+
+	var stopped generateResponse
+	request(t, http.MethodGet, srv.URL+"/generate?seed=1&start=the&stop=sat", "", "", &stopped)
+	if !strings.HasSuffix(stopped.Text, " sat") || strings.Count(stopped.Text, "sat") != 1 {
+		t.Errorf("got %q, want it to end at the first \"sat\"", stopped.Text)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	chain := buildChain(t, testText)
+	srv := newTestServer(t, &serveOptions{}, "a="+chain, "b="+chain)
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/generate", "", http.StatusNotFound},
+		{http.MethodGet, "/generate?chain=c", "", http.StatusNotFound},
+		{http.MethodGet, "/generate?chain=a&count=x", "", http.StatusBadRequest},
+		{http.MethodGet, "/generate?chain=a&count=-1", "", http.StatusBadRequest},
+		{http.MethodGet, "/generate?chain=a&count=101", "", http.StatusBadRequest},
+		{http.MethodGet, "/generate?chain=a&seed=x", "", http.StatusBadRequest},
+		{http.MethodGet, "/generate?chain=a&start=nope", "", http.StatusNotFound},
+		{http.MethodPost, "/generate?chain=a", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/links?chain=a", "", http.StatusBadRequest},
+		{http.MethodGet, "/links?chain=a&value=nope", "", http.StatusNotFound},
+		{http.MethodGet, "/score?chain=a", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/score?chain=a", "{", http.StatusBadRequest},
+		{http.MethodPost, "/score?chain=a", `{"sequence": ["the"]}`, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		var resp struct {
+			Error string `json:"error"`
+		}
+
+		status := request(t, c.method, srv.URL+c.path, "application/json", c.body, &resp)
+		if status != c.status {
+			t.Errorf("%s %s: got status %d, want %d", c.method, c.path, status, c.status)
+		}
+
+		if resp.Error == "" {
+			t.Errorf("%s %s: got no error message", c.method, c.path)
+		}
+	}
+
+	// /feed is only there with -feed.
+	resp, err := http.Post(srv.URL+"/feed?chain=a", "text/plain", strings.NewReader("a b"))
+	if err != nil {
+		t.Fatalf("POST /feed failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d for /feed without -feed, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServeScore(t *testing.T) {
+	srv := newTestServer(t, &serveOptions{}, buildChain(t, testText))
+
+	var resp scoreResponse
+	status := request(t, http.MethodPost, srv.URL+"/score", "application/json", `{"sequence": ["on", "the", "cat", "sat"]}`, &resp)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+
+	// on -> the is certain, the -> cat is 2 of 4 and cat -> sat is certain.
+	if resp.Transitions != 3 || resp.Probability != 0.5 || len(resp.Missing) != 0 {
+		t.Errorf("got %+v, want 3 transitions with probability 0.5", resp)
+	}
+
+	if resp.LogProbability == nil {
+		t.Errorf("got no log probability")
+	}
+
+	resp = scoreResponse{}
+	request(t, http.MethodPost, srv.URL+"/score", "application/json", `{"sequence": ["the", "cat", "on", "nope"]}`, &resp)
+
+	if resp.Probability != 0 || resp.LogProbability != nil {
+		t.Errorf("got probability %v, want 0", resp.Probability)
+	}
+
+	if len(resp.Missing) != 2 || resp.Missing[0] != 1 || resp.Missing[1] != 2 {
+		t.Errorf("got missing %v, want [1 2]", resp.Missing)
+	}
+}
+
+func TestServeLinks(t *testing.T) {
+	srv := newTestServer(t, &serveOptions{}, buildChain(t, testText))
+
+	var resp linksResponse
+	status := request(t, http.MethodGet, srv.URL+"/links?value=the", "", "", &resp)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+
+	if resp.Value != "the" {
+		t.Errorf("got value %v, want \"the\"", resp.Value)
+	}
+
+	want := map[string]int{"cat": 2, "mat": 1, "dog": 1}
+	if len(resp.Links) != len(want) {
+		t.Errorf("got %d links, want %d", len(resp.Links), len(want))
+	}
+
+	for _, l := range resp.Links {
+		value, _ := l.Value.(string)
+		if l.Count != want[value] {
+			t.Errorf("%v: got count %d, want %d", l.Value, l.Count, want[value])
+		}
+
+		if p := float64(want[value]) / 4; l.Probability != p {
+			t.Errorf("%v: got probability %v, want %v", l.Value, l.Probability, p)
+		}
+	}
+}
+
+func TestServeTuples(t *testing.T) {
+	srv := newTestServer(t, &serveOptions{}, buildChain(t, "a b c a b", "-n", "2"))
+
+	var resp linksResponse
+	status := request(t, http.MethodGet, srv.URL+"/links?value=a+b", "", "", &resp)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+
+	if len(resp.Links) != 1 || resp.Links[0].Count != 1 {
+		t.Errorf("got links %+v, want 1", resp.Links)
+	}
+
+	var gen generateResponse
+	request(t, http.MethodGet, srv.URL+"/generate?seed=1&count=2&start=a+b", "", "", &gen)
+	if gen.Text != "a b b c" {
+		t.Errorf("got text %q, want %q", gen.Text, "a b b c")
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	chain := buildChain(t, testText)
+	srv := newTestServer(t, &serveOptions{}, chain, "other="+chain)
+
+	var resp struct {
+		Status string        `json:"status"`
+		Chains []chainStatus `json:"chains"`
+	}
+	status := request(t, http.MethodGet, srv.URL+"/health", "", "", &resp)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+
+	if resp.Status != "ok" {
+		t.Errorf("got status %q, want ok", resp.Status)
+	}
+
+	if len(resp.Chains) != 2 || resp.Chains[0].Name != "other" || resp.Chains[1].Name != "test" {
+		t.Errorf("got chains %+v, want other and test", resp.Chains)
+	}
+
+	for _, c := range resp.Chains {
+		if c.Path != chain || c.Loaded.IsZero() {
+			t.Errorf("%s: got path %q and load time %v, want %q and a time", c.Name, c.Path, c.Loaded, chain)
+		}
+	}
+}
+
+func TestServeFeed(t *testing.T) {
+	srv := newTestServer(t, &serveOptions{feed: true, inMemory: true}, buildChain(t, testText))
+
+	var result struct {
+		Accepted int `json:"accepted"`
+	}
+	status := request(t, http.MethodPost, srv.URL+"/feed?chain=test", "text/plain", "the bird sat\nthe bird flew", &result)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+
+	if result.Accepted != 2 {
+		t.Errorf("got %d accepted, want 2", result.Accepted)
+	}
+
+	var links linksResponse
+	request(t, http.MethodGet, srv.URL+"/links?chain=test&value=bird", "", "", &links)
+	if len(links.Links) != 2 {
+		t.Errorf("got %d links from the new value, want 2", len(links.Links))
+	}
+}
+
+func TestServeFeedReadOnly(t *testing.T) {
+	srv := newTestServer(t, &serveOptions{feed: true}, buildChain(t, testText))
+
+	status := request(t, http.MethodPost, srv.URL+"/feed", "text/plain", "a b", nil)
+	if status != http.StatusConflict {
+		t.Errorf("got status %d for a chain on disk, want %d", status, http.StatusConflict)
+	}
+}
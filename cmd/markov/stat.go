@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pboyd/markov"
+)
+
+var statCommand = &command{
+	name:  "stat",
+	short: "print statistics about a chain",
+	long: `
+Stat prints statistics about a chain file.
+
+The report includes the number of values and transitions, the out-degree
+distribution (how many values link to N others), the most frequent values and
+transitions, values that don't link to anything (dead ends), a histogram of
+value types, and a breakdown of the file's size.
+
+Slack is the space reserved in link buckets that hasn't been used yet.
+"markov optimize" removes it, and "markov compact" resizes it to leave room
+for new links.
+`,
+	run: runStat,
+}
+
+type transition struct {
+	from, to int
+	count    int
+}
+
+type stats struct {
+	ids         []int
+	values      map[int]interface{}
+	transitions int
+	incoming    map[int]int
+	outDegree   []int
+	top         []transition
+	deadEnds    []int
+	types       map[string]int
+
+	// limit is the number of values and transitions to list.
+	limit int
+}
+
+func runStat(fs *flag.FlagSet, args []string) error {
+	source := fs.String("chain", "", "path to the chain file")
+	top := fs.Int("top", 10, "number of values and transitions to list")
+	fs.Parse(args)
+
+	err := requireChain(*source)
+	if err != nil {
+		return err
+	}
+
+	chain, err := markov.OpenDiskChainFile(*source, markov.ReadMode)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	s, err := collect(chain, *top)
+	if err != nil {
+		return fmt.Errorf("error reading chain: %v", err)
+	}
+
+	usage, err := chain.Usage()
+	if err != nil {
+		return fmt.Errorf("error reading chain: %v", err)
+	}
+
+	info, err := chain.File().Stat()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	s.print(w)
+	printUsage(w, usage, info.Size())
+	return w.Flush()
+}
+
+func collect(chain markov.Chain, limit int) (*stats, error) {
+	s := &stats{
+		limit:    limit,
+		values:   map[int]interface{}{},
+		incoming: map[int]int{},
+		types:    map[string]int{},
+	}
+
+	walker := markov.IterativeWalker(chain)
+	for {
+		value, err := walker.Next()
+		if err != nil {
+			if err == markov.ErrBrokenChain {
+				break
+			}
+			return nil, err
+		}
+
+		id, err := chain.Find(value)
+		if err != nil {
+			return nil, err
+		}
+
+		s.types[fmt.Sprintf("%T", value)]++
+
+		links, err := markov.LinkCounts(chain, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(links) == 0 {
+			s.deadEnds = append(s.deadEnds, id)
+		}
+		s.ids = append(s.ids, id)
+		s.values[id] = value
+
+		bucket := degreeBucket(len(links))
+		for len(s.outDegree) <= bucket {
+			s.outDegree = append(s.outDegree, 0)
+		}
+		s.outDegree[bucket]++
+
+		for _, l := range links {
+			s.transitions += l.Count
+			s.incoming[l.ID] += l.Count
+			s.addTransition(transition{from: id, to: l.ID, count: l.Count})
+		}
+	}
+
+	return s, nil
+}
+
+// addTransition keeps the most frequent transitions in s.top.
+func (s *stats) addTransition(t transition) {
+	if s.limit <= 0 {
+		return
+	}
+
+	if len(s.top) == s.limit && t.count <= s.top[len(s.top)-1].count {
+		return
+	}
+
+	i := sort.Search(len(s.top), func(i int) bool {
+		return s.top[i].count < t.count
+	})
+
+	if len(s.top) < s.limit {
+		s.top = append(s.top, transition{})
+	}
+	copy(s.top[i+1:], s.top[i:])
+	s.top[i] = t
+}
+
+// degreeBucket returns the histogram bucket for an out-degree. Bucket 0 is for
+// 0 links, bucket 1 for 1 link, bucket 2 for 2-3 links, bucket 3 for 4-7
+// links, and so on.
+func degreeBucket(degree int) int {
+	bucket := 0
+	for degree > 0 {
+		bucket++
+		degree >>= 1
+	}
+	return bucket
+}
+
+func degreeRange(bucket int) string {
+	if bucket < 2 {
+		return fmt.Sprint(bucket)
+	}
+
+	low := 1 << uint(bucket-1)
+	return fmt.Sprintf("%d-%d", low, low*2-1)
+}
+
+func (s *stats) print(w *tabwriter.Writer) {
+	fmt.Fprintf(w, "Values:\t%d\n", len(s.values))
+	fmt.Fprintf(w, "Transitions:\t%d\n", s.transitions)
+	fmt.Fprintf(w, "Dead ends:\t%d\n", len(s.deadEnds))
+
+	fmt.Fprintln(w, "\nOut-degree:")
+	for bucket, count := range s.outDegree {
+		if count == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%d\n", degreeRange(bucket), count)
+	}
+
+	fmt.Fprintln(w, "\nValue types:")
+	types := make([]string, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if s.types[types[i]] != s.types[types[j]] {
+			return s.types[types[i]] > s.types[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for _, t := range types {
+		fmt.Fprintf(w, "  %s\t%d\n", t, s.types[t])
+	}
+
+	if s.limit <= 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\nMost frequent values:")
+	ids := make([]int, len(s.ids))
+	copy(ids, s.ids)
+	sort.SliceStable(ids, func(i, j int) bool {
+		return s.incoming[ids[i]] > s.incoming[ids[j]]
+	})
+	if len(ids) > s.limit {
+		ids = ids[:s.limit]
+	}
+	for _, id := range ids {
+		fmt.Fprintf(w, "  %v\t%d\n", s.values[id], s.incoming[id])
+	}
+
+	fmt.Fprintln(w, "\nMost frequent transitions:")
+	for _, t := range s.top {
+		fmt.Fprintf(w, "  %v -> %v\t%d\n", s.values[t.from], s.values[t.to], t.count)
+	}
+
+	if len(s.deadEnds) > 0 {
+		fmt.Fprintln(w, "\nDead ends:")
+		deadEnds := s.deadEnds
+		if len(deadEnds) > s.limit {
+			deadEnds = deadEnds[:s.limit]
+		}
+		for _, id := range deadEnds {
+			fmt.Fprintf(w, "  %v\n", s.values[id])
+		}
+		if len(s.deadEnds) > len(deadEnds) {
+			fmt.Fprintf(w, "  (%d more)\n", len(s.deadEnds)-len(deadEnds))
+		}
+	}
+}
+
+func printUsage(w *tabwriter.Writer, u *markov.DiskUsage, fileSize int64) {
+	fmt.Fprintln(w, "\nFile:")
+	fmt.Fprintf(w, "  Version\t%d\n", u.Version)
+	fmt.Fprintf(w, "  Compressed\t%v\n", u.Compressed)
+	fmt.Fprintf(w, "  Size on disk\t%d\n", fileSize)
+	if u.Compressed {
+		fmt.Fprintf(w, "  Uncompressed size\t%d\n", u.Size())
+	}
+
+	total := u.Size()
+	row := func(name string, size int64) {
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", name, size, percent(size, total))
+	}
+
+	row("Header", u.Header)
+	row(fmt.Sprintf("Records (%d)", u.RecordCount), u.Records)
+	row(fmt.Sprintf("Link buckets (%d)", u.ListBucketCount), u.ListBuckets)
+	if u.LinkData > 0 {
+		row("Compact links", u.LinkData)
+	}
+	row("Slack", u.Slack)
+}
+
+func percent(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// statLines runs stat and returns its output lines with the columns separated
+// by a single space.
+func statLines(t *testing.T, args ...string) map[string]bool {
+	t.Helper()
+
+	out, err := runCommand(t, statCommand, "", args...)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+
+	lines := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	return lines
+}
+
+func TestStat(t *testing.T) {
+	// x is a dead end.
+	chain := buildChain(t, "a b a c a b x")
+
+	lines := statLines(t, "-chain", chain, "-top", "2")
+
+	for _, want := range []string{
+		"Values: 4",
+		"Transitions: 6",
+		"Dead ends: 1",
+		"Out-degree:",
+		"0 1",
+		"1 1",
+		"2-3 2",
+		"Value types:",
+		"string 4",
+		"Most frequent values:",
+		"a 2",
+		"b 2",
+		"Most frequent transitions:",
+		"a -> b 2",
+		"Dead ends:",
+		"x",
+		"File:",
+		"Compressed false",
+	} {
+		if !lines[want] {
+			t.Errorf("got no line %q", want)
+		}
+	}
+
+	// -top 2 lists 2 values, so c and x are left out.
+	for _, notWant := range []string{"c 1", "x 1"} {
+		if lines[notWant] {
+			t.Errorf("got line %q, want only 2 values", notWant)
+		}
+	}
+
+	lines = statLines(t, "-chain", chain, "-top", "0")
+	if lines["Most frequent values:"] || lines["Most frequent transitions:"] {
+		t.Errorf("got lists with -top 0")
+	}
+	if !lines["Values: 4"] {
+		t.Errorf("got no values count with -top 0")
+	}
+}
+
+func TestStatCompressed(t *testing.T) {
+	chain := buildChain(t, testText)
+	out := chain + ".gz"
+
+	_, err := runCommand(t, optimizeCommand, "", "-chain", chain, "-out", out, "-compress")
+	if err != nil {
+		t.Fatalf("optimize failed: %v", err)
+	}
+
+	lines := statLines(t, "-chain", out)
+	for _, want := range []string{"Values: 6", "Transitions: 11", "Compressed true"} {
+		if !lines[want] {
+			t.Errorf("got no line %q", want)
+		}
+	}
+}
+
+func TestStatTopTransitions(t *testing.T) {
+	s := &stats{limit: 2}
+
+	for _, count := range []int{1, 3, 2, 3, 5} {
+		s.addTransition(transition{count: count})
+	}
+
+	if len(s.top) != 2 || s.top[0].count != 5 || s.top[1].count != 3 {
+		t.Errorf("got %v, want the transitions with counts 5 and 3", s.top)
+	}
+
+	s = &stats{}
+	s.addTransition(transition{count: 1})
+	if len(s.top) != 0 {
+		t.Errorf("got %d transitions with no limit, want 0", len(s.top))
+	}
+}
+
+func TestDegreeBucket(t *testing.T) {
+	cases := []struct {
+		degree int
+		bucket int
+		rng    string
+	}{
+		{0, 0, "0"},
+		{1, 1, "1"},
+		{2, 2, "2-3"},
+		{3, 2, "2-3"},
+		{4, 3, "4-7"},
+		{7, 3, "4-7"},
+		{8, 4, "8-15"},
+		{1000, 10, "512-1023"},
+	}
+
+	for _, c := range cases {
+		bucket := degreeBucket(c.degree)
+		if bucket != c.bucket {
+			t.Errorf("degree %d: got bucket %d, want %d", c.degree, bucket, c.bucket)
+		}
+
+		if got := degreeRange(bucket); got != c.rng {
+			t.Errorf("bucket %d: got range %q, want %q", bucket, got, c.rng)
+		}
+	}
+}
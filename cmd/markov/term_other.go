@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "errors"
+
+// makeRaw isn't supported on this platform, so lines are read without
+// editing.
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("terminal not supported")
+}
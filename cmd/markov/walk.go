@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"github.com/pboyd/markov"
+	"github.com/pboyd/markov/tokenize"
+)
+
+var walkCommand = &command{
+	name:  "walk",
+	short: "generate values from a chain",
+	long: `
+Walk reads a chain and writes values to STDOUT. Each value is chosen randomly,
+weighted by how often it followed the previous value.
+
+With -format text, values are joined into text instead of being separated
+by -delimiter: punctuation is attached to the neighboring words, quotes are
+paired and sentences are capitalized. This suits chains built with the
+default word tokens. For N-gram chains, only the last word of each N-gram
+after the first is written, since the others overlap with the previous
+N-gram.
+
+Without -seed, a seed is chosen and printed to STDERR so the output can be
+repeated. The same seed gives the same output from the same chain file, but
+not necessarily from other versions of markov.
+
+As an example:
+
+	markov walk -chain words.mkv -count 50 -start the -format text
+`,
+	run: runWalk,
+}
+
+func runWalk(fs *flag.FlagSet, args []string) error {
+	source := fs.String("chain", "", "path to the chain file")
+	delimiter := fs.String("delimiter", " ", "delimiter to insert between values (Go escape sequences are allowed)")
+	count := fs.Int("count", 100, "number of values to generate")
+	seed := fs.Int64("seed", 0, "random seed")
+	start := fs.String("start", "", "value to start with (strings, or space-separated words for N-gram chains)")
+	outputFormat := fs.String("format", "plain", "output format: plain (values separated by -delimiter) or text")
+	fs.Parse(args)
+
+	err := requireChain(*source)
+	if err != nil {
+		return err
+	}
+
+	if *seed == 0 {
+		*seed = int64(os.Getpid())
+		fmt.Fprintf(os.Stderr, "-seed=%d\n", *seed)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+
+	delim, err := strconv.Unquote("\"" + *delimiter + "\"")
+	if err != nil {
+		return usageErrorf("invalid delimiter: %v", err)
+	}
+
+	file, err := markov.OpenDiskChainFile(*source, markov.ReadMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	chain := file.DiskChain(nil)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	var write func(value interface{})
+	switch *outputFormat {
+	case "plain":
+		write = func(value interface{}) {
+			fmt.Fprint(out, format(value), delim)
+		}
+	case "text":
+		text := (&tokenize.Detokenizer{Capitalize: true}).NewWriter(out)
+		first := true
+		write = func(value interface{}) {
+			words := tokens(value)
+			if !first {
+				words = words[len(words)-1:]
+			}
+			first = false
+
+			for _, word := range words {
+				text.WriteToken(word)
+			}
+		}
+	default:
+		return usageErrorf("unknown -format %q", *outputFormat)
+	}
+
+	id := 0
+	if *start != "" {
+		id, err = findValue(chain, *start)
+		if err != nil {
+			return fmt.Errorf("start value %q: %v", *start, err)
+		}
+
+		value, err := chain.Get(id)
+		if err != nil {
+			return err
+		}
+		write(value)
+	}
+
+	walker := markov.RandomWalkerWithRand(chain, id, rng)
+	for generated := 0; generated < *count; generated++ {
+		value, err := walker.Next()
+		if err != nil {
+			return fmt.Errorf("error generating value: %v", err)
+		}
+
+		write(value)
+	}
+
+	fmt.Fprint(out, "\n")
+	return nil
+}
@@ -0,0 +1,62 @@
+package markov
+
+import "os"
+
+// DefaultCompactHeadroom is the headroom left by CompactDiskChain when it
+// isn't set.
+const DefaultCompactHeadroom = 0.25
+
+// CompactOptions are the options for CompactDiskChain.
+type CompactOptions struct {
+	// Order is the order the records are written in.
+	Order RecordOrder
+
+	// Headroom is the room left in each value's list of links for new
+	// links (see BulkLoadOptions). If it's 0, DefaultCompactHeadroom is
+	// used. If it's less than 0, no room is left.
+	Headroom float64
+
+	// Workers and Progress are passed to BulkLoad.
+	Workers  int
+	Progress func(written, total int)
+}
+
+// CompactDiskChain writes a copy of the chain file src to dest without the
+// unused space that builds up as a chain is updated. Any existing data in
+// dest will be lost, so dest must not be src.
+//
+// Each value's links are copied into a single bucket with room for more, so
+// unlike an optimized copy (see DiskChainWriter.Compact) the chain can still
+// be updated efficiently. The records can also be reordered to put values that
+// are read together close together in the file.
+//
+// src may be compressed, optimized or in an older format. dest is always in
+// the current format, and can be updated. Neither file is locked (see
+// OpenDiskChainFile).
+func CompactDiskChain(dest, src *os.File, opts *CompactOptions) error {
+	if opts == nil {
+		opts = &CompactOptions{}
+	}
+
+	headroom := opts.Headroom
+	if headroom == 0 {
+		headroom = DefaultCompactHeadroom
+	}
+
+	in, err := openDiskChainWriterFile(src)
+	if err != nil {
+		return err
+	}
+
+	out, err := newDiskChainWriter(dest, diskVersion)
+	if err != nil {
+		return err
+	}
+
+	return out.BulkLoad(in, &BulkLoadOptions{
+		Workers:  opts.Workers,
+		Progress: opts.Progress,
+		Order:    opts.Order,
+		Headroom: headroom,
+	})
+}
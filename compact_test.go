@@ -0,0 +1,265 @@
+package markov
+
+import "testing"
+
+func TestCompactDiskChain(t *testing.T) {
+	srcFile, cleanup := tempFile(t)
+	defer cleanup()
+
+	src, err := NewDiskChainWriter(srcFile)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	testWriteChain(t, src)
+
+	// One link more than a bucket holds needs a second bucket that's
+	// almost empty.
+	relateMany(t, src, "hub", 0, linkListItemsPerBucket+1)
+
+	srcUsage, err := src.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+
+	first, err := src.Get(0)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	for _, order := range []RecordOrder{SourceOrder, BreadthFirstOrder, FrequencyOrder} {
+		f, cleanup := tempFile(t)
+		defer cleanup()
+
+		err = CompactDiskChain(f, srcFile, &CompactOptions{Order: order})
+		if err != nil {
+			t.Fatalf("order %d: CompactDiskChain failed: %v", order, err)
+		}
+
+		dest, err := OpenDiskChainWriter(f)
+		if err != nil {
+			t.Fatalf("order %d: OpenDiskChainWriter failed: %v", order, err)
+		}
+
+		assertSameLinks(t, dest, src)
+		assertSameLinks(t, src, dest)
+
+		value, err := dest.Get(0)
+		if err != nil {
+			t.Fatalf("order %d: Get failed: %v", order, err)
+		}
+		if value != first {
+			t.Errorf("order %d: got first value %v, want %v", order, value, first)
+		}
+
+		usage, err := dest.Usage()
+		if err != nil {
+			t.Fatalf("order %d: Usage failed: %v", order, err)
+		}
+
+		if usage.Size() >= srcUsage.Size() {
+			t.Errorf("order %d: got size %d, want less than %d", order, usage.Size(), srcUsage.Size())
+		}
+
+		if usage.Slack == 0 {
+			t.Errorf("order %d: got no slack, want room for new links", order)
+		}
+
+		// A new link fits in the headroom.
+		id, err := dest.Add("new value")
+		if err != nil {
+			t.Fatalf("order %d: Add failed: %v", order, err)
+		}
+
+		firstID, err := dest.Find(first)
+		if err != nil {
+			t.Fatalf("order %d: Find failed: %v", order, err)
+		}
+
+		err = dest.Relate(firstID, id, 1)
+		if err != nil {
+			t.Fatalf("order %d: Relate failed: %v", order, err)
+		}
+
+		usage, err = dest.Usage()
+		if err != nil {
+			t.Fatalf("order %d: Usage failed: %v", order, err)
+		}
+
+		if usage.ListBucketCount != 0 {
+			t.Errorf("order %d: got %d list buckets, want 0", order, usage.ListBucketCount)
+		}
+	}
+}
+
+func TestCompactDiskChainHeadroom(t *testing.T) {
+	srcFile, cleanup := tempFile(t)
+	defer cleanup()
+
+	src, err := NewDiskChainWriter(srcFile)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	testWriteChain(t, src)
+
+	// Lists always have room for at least a full bucket, so headroom only
+	// makes a difference to values with more links than that.
+	relateMany(t, src, "hub", 0, 400)
+
+	var slack []int64
+	for _, headroom := range []float64{-1, 0, 1} {
+		f, cleanup := tempFile(t)
+		defer cleanup()
+
+		err = CompactDiskChain(f, srcFile, &CompactOptions{Headroom: headroom})
+		if err != nil {
+			t.Fatalf("headroom %v: CompactDiskChain failed: %v", headroom, err)
+		}
+
+		dest, err := ReadDiskChain(f)
+		if err != nil {
+			t.Fatalf("headroom %v: ReadDiskChain failed: %v", headroom, err)
+		}
+
+		testReadChain(t, dest)
+
+		usage, err := dest.Usage()
+		if err != nil {
+			t.Fatalf("headroom %v: Usage failed: %v", headroom, err)
+		}
+
+		slack = append(slack, usage.Slack)
+	}
+
+	if !(slack[0] < slack[1] && slack[1] < slack[2]) {
+		t.Errorf("got slack %v, want it to increase with the headroom", slack)
+	}
+}
+
+func TestCompactDiskChainUpdate(t *testing.T) {
+	srcFile, cleanup := tempFile(t)
+	defer cleanup()
+
+	src, err := NewDiskChainWriter(srcFile)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	relateMany(t, src, "a", 0, 2)
+	relateMany(t, src, "b", 0, 100)
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	err = CompactDiskChain(f, srcFile, nil)
+	if err != nil {
+		t.Fatalf("CompactDiskChain failed: %v", err)
+	}
+
+	dest, err := OpenDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("OpenDiskChainWriter failed: %v", err)
+	}
+
+	// Lists have room for twice their links, at least 8 and at most 128.
+	relateMany(t, dest, "a", 2, 8)
+	relateMany(t, dest, "b", 100, 128)
+
+	assertListBuckets(t, dest, 0)
+
+	// The next buckets are the same size as the first.
+	relateMany(t, dest, "a", 8, 24)
+	relateMany(t, dest, "b", 128, 129)
+
+	assertListBuckets(t, dest, 3)
+
+	links, err := LinkCounts(dest, mustFind(t, dest, "a"))
+	if err != nil {
+		t.Fatalf("LinkCounts failed: %v", err)
+	}
+
+	if len(links) != 24 {
+		t.Errorf("got %d links, want 24", len(links))
+	}
+}
+
+func assertListBuckets(t *testing.T, chain *DiskChainWriter, want int) {
+	t.Helper()
+
+	usage, err := chain.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+
+	if usage.ListBucketCount != want {
+		t.Errorf("got %d list buckets, want %d", usage.ListBucketCount, want)
+	}
+}
+
+// relateMany links parent to each int from start up to end.
+func relateMany(t *testing.T, chain ReadWriteChain, parent interface{}, start, end int) {
+	t.Helper()
+
+	parentID, err := chain.Add(parent)
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	for i := start; i < end; i++ {
+		childID, err := chain.Add(i)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		err = chain.Relate(parentID, childID, 1)
+		if err != nil {
+			t.Fatalf("Relate failed: %v", err)
+		}
+	}
+}
+
+func mustFind(t *testing.T, chain Chain, value interface{}) int {
+	t.Helper()
+
+	id, err := chain.Find(value)
+	if err != nil {
+		t.Fatalf("Find(%v) failed: %v", value, err)
+	}
+	return id
+}
+
+func TestCompactDiskChainCompressed(t *testing.T) {
+	srcFile, cleanup := tempFile(t)
+	defer cleanup()
+
+	src, err := NewDiskChainWriter(srcFile)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	testWriteChain(t, src)
+
+	compressed, cleanup := tempFile(t)
+	defer cleanup()
+
+	err = CompressDiskChain(compressed, srcFile)
+	if err != nil {
+		t.Fatalf("CompressDiskChain failed: %v", err)
+	}
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	err = CompactDiskChain(f, compressed, nil)
+	if err != nil {
+		t.Fatalf("CompactDiskChain failed: %v", err)
+	}
+
+	dest, err := OpenDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("OpenDiskChainWriter failed: %v", err)
+	}
+
+	assertSameLinks(t, dest, src)
+	assertSameLinks(t, src, dest)
+
+	// The copy can be updated.
+	testWriteChain(t, dest)
+}
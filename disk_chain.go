@@ -2,36 +2,219 @@ package markov
 
 import "os"
 
-var _ Chain = &DiskChain{}
+var (
+	_ Chain        = &DiskChain{}
+	_ SamplerChain = &DiskChain{}
+)
 
 // DiskChain is a read-only Chain implementation for file-based chains.
+//
+// Recently read values and their links are cached in memory, so reading the
+// same values repeatedly (as a random walk over natural language text does)
+// doesn't read the file every time.
+//
+// A DiskChain is safe for concurrent use by multiple goroutines.
+//
+// To read a chain while it's written, get a DiskChain from the writer with
+// DiskChainWriter.DiskChain. Each read then sees an Add or Relate either
+// completely or not at all, and cached links are read again once they've
+// changed. A read is a snapshot of one value and it's links, not of the whole
+// chain, so a walk may see links that were added between it's steps.
+//
+// A DiskChain opened with ReadDiskChain has the file locked, so it can't be
+// written with this package while it's open (where locks are supported).
 type DiskChain struct {
 	// DiskChain is wrapper around the read funcs of DiskChainWriter.
 	w *DiskChainWriter
+
+	// cache is nil if caching is disabled.
+	cache *diskChainCache
 }
 
-// ReadDiskChain reads a chain from a file.
+// DiskChainOptions are the options for ReadDiskChainWithOptions.
+type DiskChainOptions struct {
+	// CacheSize is the number of values to keep in memory, with their
+	// links. If it's 0 a default size is used. If it's less than 0,
+	// nothing is cached.
+	CacheSize int
+
+	// Wait causes ReadDiskChainWithOptions to wait for the file to be
+	// closed, instead of returning ErrLocked, if it's being written.
+	// Don't wait for a file that's open for writing in the same
+	// goroutine, it will never be closed.
+	Wait bool
+}
+
+// ReadDiskChain reads a chain from a file. The file may be compressed by
+// CompressDiskChain.
+//
+// The file is locked so other processes can read it but can't write to it
+// with this package until it's closed. If the file is being written,
+// ReadDiskChain returns ErrLocked. That includes a DiskChainWriter in this
+// process using another handle to the file, since locks belong to the open
+// file.
 func ReadDiskChain(fh *os.File) (*DiskChain, error) {
-	w, err := OpenDiskChainWriter(fh)
+	return ReadDiskChainWithOptions(fh, nil)
+}
+
+// ReadDiskChainWithOptions reads a chain from a file, like ReadDiskChain, with
+// the given options. If opts is nil the defaults are used.
+func ReadDiskChainWithOptions(fh *os.File, opts *DiskChainOptions) (*DiskChain, error) {
+	if opts == nil {
+		opts = &DiskChainOptions{}
+	}
+
+	err := lockFile(fh, false, opts.Wait)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := openDiskChainWriterFile(fh)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DiskChain{
+	return newDiskChain(w, opts), nil
+}
+
+// DiskChain returns a DiskChain that reads from the writer's file, with the
+// given options (Wait is ignored). If opts is nil the defaults are used.
+//
+// The DiskChain shares the writer's lock, so it can be read while the chain
+// is written. Opening the file again with ReadDiskChain fails while the writer
+// has it locked.
+func (c *DiskChainWriter) DiskChain(opts *DiskChainOptions) *DiskChain {
+	if opts == nil {
+		opts = &DiskChainOptions{}
+	}
+
+	return newDiskChain(c, opts)
+}
+
+func newDiskChain(w *DiskChainWriter, opts *DiskChainOptions) *DiskChain {
+	c := &DiskChain{
 		w: w,
-	}, nil
+	}
+
+	size := opts.CacheSize
+	if size == 0 {
+		size = defaultDiskChainCacheSize
+	}
+
+	if size > 0 {
+		c.cache = newDiskChainCache(size)
+	}
+
+	return c
 }
 
 // Get returns a value by it's ID. Returns nil if the ID doesn't exist.
 func (c *DiskChain) Get(id int) (interface{}, error) {
-	return c.w.Get(id)
+	if c.cache == nil {
+		return c.w.Get(id)
+	}
+
+	entry, err := c.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.value, nil
 }
 
 // Links returns the items linked to the given item.
 //
 // Returns ErrNotFound if the ID doesn't exist.
 func (c *DiskChain) Links(id int) ([]Link, error) {
-	return c.w.Links(id)
+	if c.cache == nil {
+		return c.w.Links(id)
+	}
+
+	entry, err := c.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]Link(nil), entry.links...), nil
+}
+
+func (c *DiskChain) linkCounts(id int) (linkCountSlice, error) {
+	if c.cache == nil {
+		return c.w.linkCounts(id)
+	}
+
+	entry, err := c.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(linkCountSlice(nil), entry.counts...), nil
+}
+
+// Sampler returns a Sampler for the items linked to id. Satisfies the
+// SamplerChain interface. Samplers are cached with the links. If caching is
+// disabled a new Sampler is built for each call, so RandomWalker doesn't use
+// them.
+//
+// Returns ErrNotFound if the ID doesn't exist.
+func (c *DiskChain) Sampler(id int) (*Sampler, error) {
+	if c.cache == nil {
+		counts, err := c.w.linkCounts(id)
+		if err != nil {
+			return nil, err
+		}
+
+		return countSampler(counts), nil
+	}
+
+	entry, err := c.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.getSampler(), nil
+}
+
+// read returns the cache entry for id, reading it from the file if it isn't
+// cached.
+func (c *DiskChain) read(id int) (*diskChainCacheEntry, error) {
+	if id == 0 {
+		id = diskHeaderLength
+	}
+
+	// A write that's in progress hasn't updated the record's generation
+	// yet, so the cached entry is what a read before the write would have
+	// seen. Writes to other records don't affect it.
+	entry := c.cache.get(id, c.w.lastUpdated(int64(id)))
+	if entry != nil {
+		return entry, nil
+	}
+
+	value, counts, generation, err := c.w.readValueAndLinks(id)
+	if err != nil {
+		return nil, err
+	}
+
+	entry = &diskChainCacheEntry{
+		id:         id,
+		value:      value,
+		counts:     counts,
+		links:      counts.LinkSlice(),
+		generation: generation,
+	}
+	c.cache.add(entry)
+
+	return entry, nil
+}
+
+// CacheStats returns statistics for the cache. They're all zero if caching is
+// disabled.
+func (c *DiskChain) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+
+	return c.cache.stats()
 }
 
 // Find returns the ID for the given value.
@@ -47,6 +230,11 @@ func (c *DiskChain) Next(id int) (int, error) {
 	return c.w.Next(id)
 }
 
+// Usage reads the entire file and reports how the space is used.
+func (c *DiskChain) Usage() (*DiskUsage, error) {
+	return c.w.Usage()
+}
+
 // Random pseudo-randomly picks a value and returns it. Satisfies the
 // RandomChain interface.
 func (c *DiskChain) Random() (interface{}, error) {
@@ -0,0 +1,128 @@
+package markov
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultDiskChainCacheSize is the number of values cached by a DiskChain
+// when the size isn't set.
+const defaultDiskChainCacheSize = 4096
+
+// CacheStats are the statistics of a DiskChain's cache.
+type CacheStats struct {
+	// Hits is the number of reads that were found in the cache.
+	Hits int64
+
+	// Misses is the number of reads that went to the file.
+	Misses int64
+
+	// Len is the number of values in the cache.
+	Len int
+}
+
+// diskChainCache is a least-recently-used cache of values and their links,
+// keyed by ID.
+type diskChainCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[int]*list.Element
+	order   *list.List // Most recently used first.
+	hits    int64
+	misses  int64
+}
+
+type diskChainCacheEntry struct {
+	id     int
+	value  interface{}
+	counts linkCountSlice
+	links  []Link
+
+	// generation is the writer's generation when the entry was read. The
+	// entry is stale once its record is updated at a later generation.
+	generation uint64
+
+	// sampler is built the first time it's needed.
+	samplerOnce sync.Once
+	sampler     *Sampler
+}
+
+// getSampler returns the entry's Sampler.
+func (e *diskChainCacheEntry) getSampler() *Sampler {
+	e.samplerOnce.Do(func() {
+		e.sampler = countSampler(e.counts)
+	})
+	return e.sampler
+}
+
+func newDiskChainCache(size int) *diskChainCache {
+	return &diskChainCache{
+		size:    size,
+		entries: make(map[int]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached entry for id, or nil if it isn't cached or it was
+// read before lastUpdated, the generation of the record's last update. The
+// entry must not be modified.
+func (c *diskChainCache) get(id int, lastUpdated uint64) *diskChainCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		c.misses++
+		return nil
+	}
+
+	entry := e.Value.(*diskChainCacheEntry)
+	if entry.generation < lastUpdated {
+		c.order.Remove(e)
+		delete(c.entries, id)
+		c.misses++
+		return nil
+	}
+
+	c.hits++
+	c.order.MoveToFront(e)
+	return entry
+}
+
+// add caches an entry, removing the least recently used entry if the cache
+// is full.
+func (c *diskChainCache) add(entry *diskChainCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another reader may have added it, possibly from an older read.
+	if e, ok := c.entries[entry.id]; ok {
+		if e.Value.(*diskChainCacheEntry).generation >= entry.generation {
+			c.order.MoveToFront(e)
+			return
+		}
+
+		c.order.Remove(e)
+		delete(c.entries, entry.id)
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*diskChainCacheEntry).id)
+	}
+
+	c.entries[entry.id] = c.order.PushFront(entry)
+}
+
+func (c *diskChainCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Len:    c.order.Len(),
+	}
+}
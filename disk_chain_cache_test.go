@@ -0,0 +1,221 @@
+package markov
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiskChainCache(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Feed(writer, sliceChannel([]interface{}{"a", "b", "c", "a"}))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	chain := writer.DiskChain(&DiskChainOptions{CacheSize: 2})
+
+	a, _ := chain.Find("a")
+	b, _ := chain.Find("b")
+	c, _ := chain.Find("c")
+
+	reads := []struct {
+		id   int
+		hit  bool
+		want interface{}
+	}{
+		{a, false, "a"},
+		{a, true, "a"},
+		{b, false, "b"},
+		{a, true, "a"},
+		// Evicts b, which is the least recently used.
+		{c, false, "c"},
+		{a, true, "a"},
+		{b, false, "b"},
+		// ID 0 is an alias for the first value.
+		{0, true, "a"},
+	}
+
+	for i, r := range reads {
+		before := chain.CacheStats()
+
+		value, err := chain.Get(r.id)
+		if err != nil {
+			t.Fatalf("%d: Get failed: %v", i, err)
+		}
+
+		if value != r.want {
+			t.Errorf("%d: got %v, want %v", i, value, r.want)
+		}
+
+		after := chain.CacheStats()
+		hit := after.Hits == before.Hits+1
+		if hit != r.hit || after.Hits+after.Misses != before.Hits+before.Misses+1 {
+			t.Errorf("%d: got stats %+v after %+v, want hit=%v", i, after, before, r.hit)
+		}
+
+		if after.Len > 2 {
+			t.Errorf("%d: cache has %d entries, want at most 2", i, after.Len)
+		}
+	}
+
+	// Changes to returned links must not change the cache.
+	links, _ := chain.Links(a)
+	links[0].ID = -1
+
+	links, _ = chain.Links(a)
+	if links[0].ID != b {
+		t.Errorf("got link to %d, want %d", links[0].ID, b)
+	}
+}
+
+func TestDiskChainCacheUpdated(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Feed(writer, sliceChannel([]interface{}{"a", "b"}))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	chain := writer.DiskChain(nil)
+
+	a, _ := chain.Find("a")
+	b, _ := chain.Find("b")
+
+	assertCounts := func(want []LinkCount) {
+		t.Helper()
+
+		counts, err := LinkCounts(chain, a)
+		if err != nil {
+			t.Fatalf("LinkCounts failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("got links %v, want %v", counts, want)
+		}
+	}
+
+	assertCounts([]LinkCount{{ID: b, Count: 1}})
+	assertCounts([]LinkCount{{ID: b, Count: 1}})
+	if stats := chain.CacheStats(); stats.Hits != 1 {
+		t.Errorf("got %d hits, want 1", stats.Hits)
+	}
+
+	// Cached links are read again after they're changed.
+	err = writer.Relate(a, b, 2)
+	if err != nil {
+		t.Fatalf("Relate failed: %v", err)
+	}
+	assertCounts([]LinkCount{{ID: b, Count: 3}})
+
+	c, err := writer.Add("c")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	err = writer.Relate(a, c, 1)
+	if err != nil {
+		t.Fatalf("Relate failed: %v", err)
+	}
+	assertCounts([]LinkCount{{ID: b, Count: 3}, {ID: c, Count: 1}})
+
+	if stats := chain.CacheStats(); stats.Hits != 1 || stats.Len != 1 {
+		t.Errorf("got stats %+v, want 1 hit and 1 entry", stats)
+	}
+}
+
+func TestDiskChainCacheUnrelatedUpdate(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Feed(writer, sliceChannel([]interface{}{"a", "b", "c", "d"}))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	chain := writer.DiskChain(nil)
+
+	a, _ := chain.Find("a")
+	b, _ := chain.Find("b")
+	c, _ := chain.Find("c")
+	d, _ := chain.Find("d")
+
+	for _, id := range []int{a, c} {
+		_, err := chain.Links(id)
+		if err != nil {
+			t.Fatalf("Links failed: %v", err)
+		}
+	}
+
+	// Updating a leaves c cached.
+	err = writer.Relate(a, d, 1)
+	if err != nil {
+		t.Fatalf("Relate failed: %v", err)
+	}
+
+	before := chain.CacheStats()
+
+	counts, err := LinkCounts(chain, c)
+	if err != nil {
+		t.Fatalf("LinkCounts failed: %v", err)
+	}
+	if !reflect.DeepEqual(counts, []LinkCount{{ID: d, Count: 1}}) {
+		t.Errorf("got links %v from c, want 1 to d", counts)
+	}
+
+	after := chain.CacheStats()
+	if after.Hits != before.Hits+1 || after.Misses != before.Misses {
+		t.Errorf("got stats %+v after %+v, want a hit for c", after, before)
+	}
+
+	counts, err = LinkCounts(chain, a)
+	if err != nil {
+		t.Fatalf("LinkCounts failed: %v", err)
+	}
+	if !reflect.DeepEqual(counts, []LinkCount{{ID: b, Count: 1}, {ID: d, Count: 1}}) {
+		t.Errorf("got links %v from a, want 1 to b and 1 to d", counts)
+	}
+
+	if stats := chain.CacheStats(); stats.Misses != after.Misses+1 {
+		t.Errorf("got stats %+v after %+v, want a miss for a", stats, after)
+	}
+}
+
+func TestDiskChainCacheDisabled(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	testWriteChain(t, writer)
+
+	chain, err := ReadDiskChainWithOptions(f, &DiskChainOptions{CacheSize: -1})
+	if err != nil {
+		t.Fatalf("ReadDiskChainWithOptions failed: %v", err)
+	}
+
+	testReadChain(t, chain)
+
+	if stats := chain.CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("got stats %+v, want zero", stats)
+	}
+}
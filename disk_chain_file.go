@@ -0,0 +1,168 @@
+package markov
+
+import "os"
+
+// OpenMode controls how OpenDiskChainFile opens a file.
+type OpenMode int
+
+const (
+	// ReadMode opens an existing file for reading only.
+	ReadMode OpenMode = iota
+
+	// CreateMode creates a new, empty, chain. An existing file is
+	// replaced.
+	CreateMode
+
+	// UpdateMode opens an existing file for reading and writing. If the
+	// file doesn't exist it's created.
+	UpdateMode
+)
+
+// NoWait can be combined with a mode (e.g. UpdateMode|NoWait) to return
+// ErrLocked, instead of waiting, when the file is in use by another process.
+const NoWait OpenMode = 1 << 8
+
+// DiskChainFile is a disk chain opened by path.
+type DiskChainFile struct {
+	*DiskChainWriter
+	file *os.File
+}
+
+// OpenDiskChainFile opens the chain file at path.
+//
+// In ReadMode, Add and Relate return ErrReadOnly. Compressed files (see
+// CompressDiskChain) can only be opened in ReadMode.
+//
+// The file is locked until it's closed, so that other processes using this
+// package can't write to it while it's being read, or read or write it while
+// it's being written. Locks are advisory, and aren't supported on every
+// platform (e.g. Windows). If the file is in use, OpenDiskChainFile waits for
+// it unless the mode includes NoWait. Each call opens the file again, so it
+// also waits for chains opened from the same path in this process: opening
+// a path while it's open for writing in the same goroutine never returns
+// without NoWait. If the file is replaced (e.g. renamed over) while waiting,
+// the new file is opened instead.
+func OpenDiskChainFile(path string, mode OpenMode) (*DiskChainFile, error) {
+	wait := mode&NoWait == 0
+	mode &^= NoWait
+
+	fh, err := openLocked(path, mode, wait)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := openDiskChainFile(fh, mode)
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+
+	return &DiskChainFile{
+		DiskChainWriter: w,
+		file:            fh,
+	}, nil
+}
+
+// openLocked opens and locks the file at path. The file at path may be
+// replaced while the lock is held by another process, so once it's locked it's
+// opened again if path no longer refers to it.
+func openLocked(path string, mode OpenMode, wait bool) (*os.File, error) {
+	for {
+		var fh *os.File
+		var err error
+
+		if mode == ReadMode {
+			fh, err = os.Open(path)
+		} else {
+			fh, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Lock before anything is read, since CreateMode truncates the
+		// file.
+		err = lockFile(fh, mode != ReadMode, wait)
+		if err != nil {
+			fh.Close()
+			return nil, err
+		}
+
+		replaced, err := fileReplaced(fh, path)
+		if err != nil {
+			fh.Close()
+			return nil, err
+		}
+
+		if !replaced {
+			return fh, nil
+		}
+		fh.Close()
+	}
+}
+
+// fileReplaced reports whether path no longer refers to the open file fh.
+func fileReplaced(fh *os.File, path string) (bool, error) {
+	info, err := fh.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	pathInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !os.SameFile(info, pathInfo), nil
+}
+
+// openDiskChainFile opens a chain from a locked file.
+func openDiskChainFile(fh *os.File, mode OpenMode) (*DiskChainWriter, error) {
+	if mode == CreateMode {
+		return newDiskChainWriter(fh, diskVersion)
+	}
+
+	if mode == UpdateMode {
+		info, err := fh.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		// The file was just created.
+		if info.Size() == 0 {
+			return newDiskChainWriter(fh, diskVersion)
+		}
+
+		w, err := openDiskChainWriterFile(fh)
+		if err != nil {
+			return nil, err
+		}
+
+		if w.readOnly {
+			return nil, ErrReadOnly
+		}
+
+		return w, nil
+	}
+
+	w, err := openDiskChainWriterFile(fh)
+	if err != nil {
+		return nil, err
+	}
+	w.readOnly = true
+
+	return w, nil
+}
+
+// File returns the chain's file.
+func (f *DiskChainFile) File() *os.File {
+	return f.file
+}
+
+// Close closes the file, which releases it's lock.
+func (f *DiskChainFile) Close() error {
+	return f.file.Close()
+}
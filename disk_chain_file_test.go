@@ -0,0 +1,292 @@
+package markov
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenDiskChainFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "markov")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "chain.mkv")
+
+	_, err = OpenDiskChainFile(path, ReadMode)
+	if !os.IsNotExist(err) {
+		t.Errorf("ReadMode on a missing file: got %v, want not exist", err)
+	}
+
+	// UpdateMode creates the file if it doesn't exist.
+	f, err := OpenDiskChainFile(path, UpdateMode)
+	if err != nil {
+		t.Fatalf("UpdateMode failed: %v", err)
+	}
+	testWriteChain(t, f)
+	f.Close()
+
+	f, err = OpenDiskChainFile(path, UpdateMode)
+	if err != nil {
+		t.Fatalf("UpdateMode failed: %v", err)
+	}
+	testReadChain(t, f)
+
+	_, err = f.Add("new value")
+	if err != nil {
+		t.Errorf("Add failed: %v", err)
+	}
+	f.Close()
+
+	f, err = OpenDiskChainFile(path, ReadMode)
+	if err != nil {
+		t.Fatalf("ReadMode failed: %v", err)
+	}
+
+	_, err = f.Find("new value")
+	if err != nil {
+		t.Errorf("Find failed: %v", err)
+	}
+
+	_, err = f.Add("another value")
+	if err != ErrReadOnly {
+		t.Errorf("Add in ReadMode: got %v, want %v", err, ErrReadOnly)
+	}
+
+	err = f.Relate(0, 0, 1)
+	if err != ErrReadOnly {
+		t.Errorf("Relate in ReadMode: got %v, want %v", err, ErrReadOnly)
+	}
+	f.Close()
+
+	// CreateMode replaces the existing chain.
+	f, err = OpenDiskChainFile(path, CreateMode)
+	if err != nil {
+		t.Fatalf("CreateMode failed: %v", err)
+	}
+	defer f.Close()
+
+	_, err = f.Find("new value")
+	if err != ErrNotFound {
+		t.Errorf("Find after CreateMode: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestOpenDiskChainFileLock(t *testing.T) {
+	if !fileLockSupported {
+		t.Skip("file locks aren't supported")
+	}
+
+	dir, err := os.MkdirTemp("", "markov")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "chain.mkv")
+
+	writer, err := OpenDiskChainFile(path, CreateMode)
+	if err != nil {
+		t.Fatalf("CreateMode failed: %v", err)
+	}
+	testWriteChain(t, writer)
+
+	// Locks belong to the open file, so a second open in the same
+	// process conflicts like another process would.
+	for _, mode := range []OpenMode{ReadMode, UpdateMode, CreateMode} {
+		_, err = OpenDiskChainFile(path, mode|NoWait)
+		if err != ErrLocked {
+			t.Errorf("mode %d while writing: got error %v, want %v", mode, err, ErrLocked)
+		}
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer fh.Close()
+
+	_, err = ReadDiskChain(fh)
+	if err != ErrLocked {
+		t.Errorf("ReadDiskChain while writing: got error %v, want %v", err, ErrLocked)
+	}
+
+	// A reader waits for the writer to close the file.
+	opened := make(chan error)
+	go func() {
+		reader, err := OpenDiskChainFile(path, ReadMode)
+		if err == nil {
+			reader.Close()
+		}
+		opened <- err
+	}()
+
+	select {
+	case err := <-opened:
+		t.Fatalf("ReadMode didn't wait for the writer, got error %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writer.Close()
+
+	err = <-opened
+	if err != nil {
+		t.Fatalf("ReadMode failed: %v", err)
+	}
+
+	// Readers can share the file, but a writer can't open it.
+	reader1, err := OpenDiskChainFile(path, ReadMode|NoWait)
+	if err != nil {
+		t.Fatalf("ReadMode failed: %v", err)
+	}
+	defer reader1.Close()
+
+	reader2, err := ReadDiskChain(fh)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+	testReadChain(t, reader2)
+
+	_, err = OpenDiskChainFile(path, UpdateMode|NoWait)
+	if err != ErrLocked {
+		t.Errorf("UpdateMode while reading: got error %v, want %v", err, ErrLocked)
+	}
+}
+
+func TestDiskChainConstructorsLock(t *testing.T) {
+	if !fileLockSupported {
+		t.Skip("file locks aren't supported")
+	}
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	testWriteChain(t, writer)
+
+	// Other handles in the same process fail instead of waiting for a
+	// lock that this goroutine holds.
+	readHandle, err := os.Open(f.Name())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer readHandle.Close()
+
+	_, err = ReadDiskChain(readHandle)
+	if err != ErrLocked {
+		t.Errorf("ReadDiskChain: got error %v, want %v", err, ErrLocked)
+	}
+
+	_, err = OpenDiskChainWriter(readHandle)
+	if err != ErrLocked {
+		t.Errorf("OpenDiskChainWriter: got error %v, want %v", err, ErrLocked)
+	}
+
+	writeHandle, err := os.OpenFile(f.Name(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer writeHandle.Close()
+
+	_, err = OpenDiskChainWriter(writeHandle)
+	if err != ErrLocked {
+		t.Errorf("OpenDiskChainWriter: got error %v, want %v", err, ErrLocked)
+	}
+
+	// The file isn't truncated when the lock fails.
+	_, err = NewDiskChainWriter(writeHandle)
+	if err != ErrLocked {
+		t.Errorf("NewDiskChainWriter: got error %v, want %v", err, ErrLocked)
+	}
+	testReadChain(t, writer)
+
+	// Wait waits for the writer's handle to be closed.
+	opened := make(chan error)
+	go func() {
+		_, err := ReadDiskChainWithOptions(readHandle, &DiskChainOptions{Wait: true})
+		opened <- err
+	}()
+
+	select {
+	case err := <-opened:
+		t.Fatalf("ReadDiskChainWithOptions didn't wait for the writer, got error %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	f.Close()
+
+	err = <-opened
+	if err != nil {
+		t.Fatalf("ReadDiskChainWithOptions failed: %v", err)
+	}
+}
+
+func TestOpenDiskChainFileReplaced(t *testing.T) {
+	if !fileLockSupported {
+		t.Skip("file locks aren't supported")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chain.mkv")
+
+	old, err := OpenDiskChainFile(path, CreateMode)
+	if err != nil {
+		t.Fatalf("CreateMode failed: %v", err)
+	}
+	defer old.Close()
+
+	_, err = old.Add("old")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	opened := make(chan *DiskChainFile)
+	go func() {
+		f, err := OpenDiskChainFile(path, UpdateMode)
+		if err != nil {
+			t.Errorf("UpdateMode failed: %v", err)
+		}
+		opened <- f
+	}()
+
+	// Replace the file while the other goroutine waits for the lock.
+	time.Sleep(50 * time.Millisecond)
+
+	replacement, err := OpenDiskChainFile(filepath.Join(dir, "new.mkv"), CreateMode)
+	if err != nil {
+		t.Fatalf("CreateMode failed: %v", err)
+	}
+	_, err = replacement.Add("new")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	replacement.Close()
+
+	err = os.Rename(filepath.Join(dir, "new.mkv"), path)
+	if err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	old.Close()
+
+	f := <-opened
+	if f == nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Find("new")
+	if err != nil {
+		t.Errorf("Find in the replacement failed: %v", err)
+	}
+
+	_, err = f.Find("old")
+	if err != ErrNotFound {
+		t.Errorf("got error %v finding a value in the replaced file, want %v", err, ErrNotFound)
+	}
+}
@@ -1,11 +1,16 @@
 package markov
 
 import (
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/pboyd/markov/internal/disk"
 )
 
 func tempFile(t testing.TB) (*os.File, func()) {
@@ -116,6 +121,366 @@ func TestDiskToDiskCopy(t *testing.T) {
 	testReadChain(t, dest)
 }
 
+func TestDiskChainCompact(t *testing.T) {
+	src := &MemoryChain{}
+	testWriteChain(t, src)
+
+	f1, cleanup1 := tempFile(t)
+	defer cleanup1()
+
+	f2, cleanup2 := tempFile(t)
+	defer cleanup2()
+
+	normal, err := NewDiskChainWriter(f1)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Copy(normal, src)
+	if err != nil {
+		t.Fatalf("Copy failed with error: %v", err)
+	}
+
+	compact, err := NewDiskChainWriter(f2)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+	compact.Compact = true
+
+	err = Copy(compact, src)
+	if err != nil {
+		t.Fatalf("Copy failed with error: %v", err)
+	}
+
+	reader, err := ReadDiskChain(f2)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	testReadChain(t, reader)
+
+	normalInfo, _ := f1.Stat()
+	compactInfo, _ := f2.Stat()
+	if compactInfo.Size() >= normalInfo.Size() {
+		t.Errorf("compact size %d is not smaller than normal size %d", compactInfo.Size(), normalInfo.Size())
+	}
+
+	spaceID, _ := compact.Find(' ')
+	aID, _ := compact.Find('a')
+	err = compact.Relate(spaceID, aID, 1)
+	if err != ErrReadOnly {
+		t.Errorf("got error %v, want %v", err, ErrReadOnly)
+	}
+
+	// New values can still be added and related.
+	newID, err := compact.Add("new")
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	err = compact.Relate(newID, spaceID, 1)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	links, err := compact.Links(newID)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	if len(links) != 1 || links[0].ID != spaceID {
+		t.Errorf("got links %v, want a link to %d", links, spaceID)
+	}
+}
+
+func TestCompressDiskChain(t *testing.T) {
+	f1, cleanup1 := tempFile(t)
+	defer cleanup1()
+
+	f2, cleanup2 := tempFile(t)
+	defer cleanup2()
+
+	writer, err := NewDiskChainWriter(f1)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	testWriteChain(t, writer)
+
+	err = CompressDiskChain(f2, f1)
+	if err != nil {
+		t.Fatalf("CompressDiskChain failed: %v", err)
+	}
+
+	normalInfo, _ := f1.Stat()
+	compressedInfo, _ := f2.Stat()
+	if compressedInfo.Size() >= normalInfo.Size() {
+		t.Errorf("compressed size %d is not smaller than normal size %d", compressedInfo.Size(), normalInfo.Size())
+	}
+
+	reader, err := ReadDiskChain(f2)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	testReadChain(t, reader)
+
+	want, err := chainLen(writer)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	got, err := chainLen(reader)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("got %d values, want %d", got, want)
+	}
+
+	compressedWriter, err := OpenDiskChainWriter(f2)
+	if err != nil {
+		t.Fatalf("OpenDiskChainWriter failed: %v", err)
+	}
+
+	_, err = compressedWriter.Add("new")
+	if err != ErrReadOnly {
+		t.Errorf("got error %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestDiskChainUsage(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	testWriteChain(t, writer)
+
+	usage, err := writer.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+
+	info, _ := f.Stat()
+	if usage.Size() != info.Size() {
+		t.Errorf("got size %d, want %d", usage.Size(), info.Size())
+	}
+
+	length, _ := chainLen(writer)
+	if usage.RecordCount != length {
+		t.Errorf("got %d records, want %d", usage.RecordCount, length)
+	}
+
+	if usage.Slack <= 0 || usage.Slack >= usage.Records {
+		t.Errorf("got slack %d, want between 0 and %d", usage.Slack, usage.Records)
+	}
+
+	if usage.Version != int(diskVersion) || usage.Compressed {
+		t.Errorf("got version %d, compressed %v", usage.Version, usage.Compressed)
+	}
+}
+
+func TestDiskChainUpgrade(t *testing.T) {
+	for _, version := range []disk.Version{disk.Version1, disk.Version2} {
+		t.Run(fmt.Sprintf("Version%d", version), func(t *testing.T) {
+			testDiskChainUpgrade(t, version)
+		})
+	}
+}
+
+func testDiskChainUpgrade(t *testing.T, version disk.Version) {
+	f1, cleanup1 := tempFile(t)
+	defer cleanup1()
+
+	f2, cleanup2 := tempFile(t)
+	defer cleanup2()
+
+	writer, err := newDiskChainWriter(f1, version)
+	if err != nil {
+		t.Fatalf("newDiskChainWriter failed: %v", err)
+	}
+
+	testReadWriteChain(t, writer)
+
+	src, err := ReadDiskChain(f1)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	if src.w.version != version {
+		t.Errorf("got version %d, want %d", src.w.version, version)
+	}
+
+	testReadChain(t, src)
+
+	dest, err := NewDiskChainWriter(f2)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Copy(dest, src)
+	if err != nil {
+		t.Fatalf("Copy failed with error: %v", err)
+	}
+
+	upgraded, err := OpenDiskChainWriter(f2)
+	if err != nil {
+		t.Fatalf("OpenDiskChainWriter failed: %v", err)
+	}
+
+	if upgraded.version != diskVersion {
+		t.Errorf("got version %d, want %d", upgraded.version, diskVersion)
+	}
+
+	testReadChain(t, upgraded)
+
+	// Counts should be copied exactly.
+	spaceID, _ := src.Find(' ')
+	want, err := src.linkCounts(spaceID)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	spaceID, _ = upgraded.Find(' ')
+	got, err := upgraded.linkCounts(spaceID)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d links, want %d", len(got), len(want))
+	}
+
+	for i := range got {
+		if got[i].Count != want[i].Count {
+			t.Errorf("link %d: got count %d, want %d", i, got[i].Count, want[i].Count)
+		}
+	}
+}
+
+func TestDiskChainLargeCounts(t *testing.T) {
+	cases := []struct {
+		version  disk.Version
+		overflow bool
+	}{
+		{disk.Version2, true},
+		{disk.Version3, false},
+	}
+
+	for _, c := range cases {
+		f, cleanup := tempFile(t)
+		defer cleanup()
+
+		chain, err := newDiskChainWriter(f, c.version)
+		if err != nil {
+			t.Fatalf("newDiskChainWriter failed: %v", err)
+		}
+
+		a, _ := chain.Add("a")
+		b, _ := chain.Add("b")
+
+		err = chain.Relate(a, b, math.MaxUint32-1)
+		if err != nil {
+			t.Fatalf("version %d: got error: %v", c.version, err)
+		}
+
+		err = chain.Relate(a, b, 2)
+		if c.overflow {
+			if err != ErrCountOverflow {
+				t.Errorf("version %d: got error %v, want %v", c.version, err, ErrCountOverflow)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("version %d: got error: %v", c.version, err)
+		}
+
+		counts, err := chain.linkCounts(a)
+		if err != nil {
+			t.Fatalf("version %d: got error: %v", c.version, err)
+		}
+
+		if len(counts) != 1 || counts[0].Count != math.MaxUint32+1 {
+			t.Errorf("version %d: got %v, want count %d", c.version, counts, math.MaxUint32+1)
+		}
+	}
+}
+
+func TestDiskChainLargeFanOut(t *testing.T) {
+	const fanOut = 1<<16 + 10
+
+	src := NewMemoryChain(fanOut + 1)
+	for i := 0; i <= fanOut; i++ {
+		src.Add(i)
+	}
+
+	// Relate is too slow for this many links, so build the list directly.
+	src.links[0] = make(linkCountSlice, fanOut)
+	for i := range src.links[0] {
+		src.links[0][i] = linkCount{ID: i + 1, Count: 1}
+	}
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	dest, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Copy(dest, src)
+	if err != nil {
+		t.Fatalf("Copy failed with error: %v", err)
+	}
+
+	zeroID, err := dest.Find(0)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	// Add one more link, which must go in a new bucket.
+	lastID, err := dest.Add(fanOut + 1)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	err = dest.Relate(zeroID, lastID, 1)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	reader, err := ReadDiskChain(f)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	links, err := reader.Links(zeroID)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	if len(links) != fanOut+1 {
+		t.Fatalf("got %d links, want %d", len(links), fanOut+1)
+	}
+
+	for i, link := range links {
+		value, err := reader.Get(link.ID)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+
+		if value != i+1 {
+			t.Fatalf("link %d: got value %v, want %d", i, value, i+1)
+		}
+	}
+}
+
 func BenchmarkDiskCopy(b *testing.B) {
 	src := NewMemoryChain(b.N)
 	err := Feed(src, normalDistGenerator(b.N, b.N*2))
@@ -138,3 +503,231 @@ func BenchmarkDiskCopy(b *testing.B) {
 		b.Fatalf("Copy failed with error: %v", err)
 	}
 }
+
+func TestDiskChainConcurrentReaders(t *testing.T) {
+	src := NewMemoryChain(0)
+	testWriteChain(t, src)
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	err = Copy(writer, src)
+	if err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	// A small cache, so entries are evicted while they're being read.
+	for _, cacheSize := range []int{8, -1} {
+		chain, err := ReadDiskChainWithOptions(f, &DiskChainOptions{CacheSize: cacheSize})
+		if err != nil {
+			t.Fatalf("ReadDiskChainWithOptions failed: %v", err)
+		}
+
+		const readers = 8
+
+		var wg sync.WaitGroup
+		wg.Add(readers)
+		errs := make(chan error, readers)
+
+		for r := 0; r < readers; r++ {
+			go func() {
+				defer wg.Done()
+
+				walker := RandomWalker(chain, 0)
+				for i := 0; i < 1000; i++ {
+					value, err := walker.Next()
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					id, err := chain.Find(value)
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					_, err = chain.Links(id)
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("cache size %d: read failed: %v", cacheSize, err)
+		}
+
+		testReadChain(t, chain)
+	}
+}
+
+func TestDiskChainWriterConcurrentReadWrite(t *testing.T) {
+	testConcurrentReadWrite(t, func(w *DiskChainWriter) Chain { return w })
+}
+
+func TestDiskChainConcurrentReadWrite(t *testing.T) {
+	// A small cache, so links are cached, evicted and replaced while
+	// they're written.
+	for _, cacheSize := range []int{8, 0, -1} {
+		cacheSize := cacheSize
+		testConcurrentReadWrite(t, func(w *DiskChainWriter) Chain {
+			return w.DiskChain(&DiskChainOptions{CacheSize: cacheSize})
+		})
+	}
+}
+
+// testConcurrentReadWrite writes to a chain while reading it from the chain
+// returned by newReader.
+func testConcurrentReadWrite(t *testing.T, newReader func(*DiskChainWriter) Chain) {
+	// Enough children to need several list buckets.
+	const fanOut = linkListItemsPerBucket*3 + 10
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	chain, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	hub, err := chain.Add(-1)
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	reader := newReader(chain)
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+
+	// The writer adds links to 0, 1, 2... in order, then adds 1 to each
+	// count in the same order. Readers should always see a prefix of
+	// the links, with no count more than 1 greater than another.
+	go func() {
+		defer close(done)
+
+		children := make([]int, fanOut)
+		for round := 0; round < 2; round++ {
+			for i := range children {
+				if round == 0 {
+					var err error
+					children[i], err = chain.Add(i)
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+
+				err := chain.Relate(hub, children[i], 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+
+	const readers = 4
+
+	var wg sync.WaitGroup
+	wg.Add(readers)
+
+	for r := 0; r < readers; r++ {
+		go func() {
+			defer wg.Done()
+
+			seen, total := 0, 0
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				counts, err := LinkCounts(reader, hub)
+				if err != nil {
+					t.Errorf("LinkCounts failed: %v", err)
+					return
+				}
+
+				if len(counts) < seen {
+					t.Errorf("got %d links after %d", len(counts), seen)
+					return
+				}
+				seen = len(counts)
+
+				sum := 0
+				for i, count := range counts {
+					value, err := reader.Get(count.ID)
+					if err != nil {
+						t.Errorf("Get failed: %v", err)
+						return
+					}
+
+					if value != i {
+						t.Errorf("link %d: got %v, want %d", i, value, i)
+						return
+					}
+
+					if count.Count < counts[len(counts)-1].Count || count.Count > counts[len(counts)-1].Count+1 {
+						t.Errorf("link %d: got count %d, last link has %d", i, count.Count, counts[len(counts)-1].Count)
+						return
+					}
+
+					sum += count.Count
+				}
+
+				if sum < total {
+					t.Errorf("got total count %d after %d", sum, total)
+					return
+				}
+				total = sum
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("write failed: %v", err)
+	default:
+	}
+
+	counts, err := LinkCounts(reader, hub)
+	if err != nil {
+		t.Fatalf("LinkCounts failed: %v", err)
+	}
+
+	if len(counts) != fanOut {
+		t.Fatalf("got %d links, want %d", len(counts), fanOut)
+	}
+
+	for i, count := range counts {
+		if count.Count != 2 {
+			t.Errorf("link %d: got count %d, want 2", i, count.Count)
+		}
+	}
+}
+
+func TestDiskChainWriterConcurrentWrites(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	chain, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	testConcurrentWrites(t, chain)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"os"
@@ -15,10 +16,18 @@ import (
 var _ ReadWriteChain = &DiskChainWriter{}
 
 const (
-	diskHeader = "MKV\u0001"
+	diskMagic        = "MKV"
+	diskHeaderLength = len(diskMagic) + 1
+
+	// diskVersion is the format version of new files.
+	diskVersion = disk.Version4
 
-	linkListItemSize       = 12
 	linkListItemsPerBucket = 128
+
+	// maxTrackedUpdates is the number of updated records a DiskChainWriter
+	// remembers for cache checks. When there are more, every cached entry
+	// read before then is treated as stale.
+	maxTrackedUpdates = 1 << 16
 )
 
 // DiskChainWriter is a ReadWriteChain implementation for file-based chains.
@@ -28,71 +37,211 @@ const (
 // particularly inefficient (but possible, and sometimes necessary). Building a
 // MemoryChain and copying to a DiskChainWriter is likely faster.
 //
-// Values can be strings, runes or any builtin numeric type.
+// Values can be strings, runes, bools, time.Time, any builtin numeric type,
+// or arrays of supported types (including tuples, see Tuple). Other types can
+// be stored after they're registered with RegisterValue or
+// RegisterBinaryValue. Values are compared with ==, so time.Time values
+// should be in UTC and without a monotonic clock reading, and slices
+// (including []byte) can't be stored.
+//
+// Files written by older versions of this package can be opened and updated,
+// but they retain their original format. To upgrade a file to the current
+// format, Copy it to a new DiskChainWriter.
+//
+// A DiskChainWriter is safe for concurrent use. It can be read from any
+// number of goroutines while it's written, and each read sees an Add or
+// Relate either completely or not at all. To read it with a cache, use
+// DiskChain.
 type DiskChainWriter struct {
-	file           *os.File
-	fileWriteMutex sync.Mutex
+	// Compact causes CopyFrom to store links in a compact, variable-length
+	// encoding instead of fixed-size buckets. This makes the file smaller
+	// and faster to read, but the links of values written this way can't
+	// be updated: Relate returns ErrReadOnly.
+	//
+	// Compact is ignored for files in older formats.
+	Compact bool
+
+	file     disk.File
+	version  disk.Version
+	readOnly bool
+
+	// fileMutex is held for writing while the file is updated and for
+	// reading while it's read, so reads never see a partial update.
+	fileMutex sync.RWMutex
 
 	index      map[interface{}]int64
 	indexMutex sync.RWMutex
+
+	// generation is incremented each time an existing record is updated,
+	// and updates has the generation of each record's last update, so
+	// cached links can be checked. Records that aren't in updates were
+	// last updated at or before updatesFloor.
+	generation      uint64
+	updates         map[int64]uint64
+	updatesFloor    uint64
+	generationMutex sync.Mutex
 }
 
 // NewDiskChainWriter creates a new DiskChainWriter. File must be writable. Any
 // existing data in the file will be lost.
+//
+// The file is locked so other processes can't open it with this package
+// until it's closed. If the file is already open, NewDiskChainWriter returns
+// ErrLocked without changing it. That includes other handles to the file in
+// this process, since locks belong to the open file (use OpenDiskChainFile
+// to wait for the file instead).
 func NewDiskChainWriter(file *os.File) (*DiskChainWriter, error) {
+	err := lockFile(file, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDiskChainWriter(file, diskVersion)
+}
+
+func newDiskChainWriter(file *os.File, version disk.Version) (*DiskChainWriter, error) {
 	err := file.Truncate(0)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = file.WriteAt([]byte(diskHeader), 0)
+	_, err = file.WriteAt(diskHeader(version), 0)
 	if err != nil {
 		return nil, err
 	}
 
 	return &DiskChainWriter{
-		file:  file,
-		index: make(map[interface{}]int64),
+		file:    file,
+		version: version,
+		index:   make(map[interface{}]int64),
 	}, nil
 }
 
 // OpenDiskChainWriter reads an existing disk chain. If file is a read/write
 // handle the disk chain can be updated.
+//
+// Compressed files (see CompressDiskChain) can be opened, but they can't be
+// updated. Add and Relate return ErrReadOnly.
+//
+// The file is locked until it's closed. A read/write handle is locked so no
+// other process can open the file with this package, and a read-only handle
+// so only other readers can. If the file is in use, including through another
+// handle in this process, OpenDiskChainWriter returns ErrLocked.
 func OpenDiskChainWriter(file *os.File) (*DiskChainWriter, error) {
-	err := verifyDiskHeader(file)
+	writable, err := fileWritable(file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file, writable, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDiskChainWriterFile(file)
+}
+
+// openDiskChainWriterFile opens a chain from a file, which may be compressed,
+// without locking it.
+func openDiskChainWriterFile(file *os.File) (*DiskChainWriter, error) {
+	compressed, err := disk.IsCompressed(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compressed {
+		return openDiskChainWriter(file, false)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := disk.OpenCompressed(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return openDiskChainWriter(cf, true)
+}
+
+func openDiskChainWriter(file disk.File, readOnly bool) (*DiskChainWriter, error) {
+	version, err := readDiskHeader(file)
 	if err != nil {
 		return nil, err
 	}
 
 	c := &DiskChainWriter{
-		file:  file,
-		index: make(map[interface{}]int64),
+		file:     file,
+		version:  version,
+		readOnly: readOnly,
+		index:    make(map[interface{}]int64),
 	}
 
 	return c, c.buildIndex()
 }
 
-func verifyDiskHeader(file *os.File) error {
-	actualHeader := make([]byte, len(diskHeader))
-	_, err := file.ReadAt(actualHeader, 0)
+// CompressDiskChain writes a compressed copy of the chain file src to dest.
+// Any existing data in dest will be lost.
+//
+// The chain is split into blocks which are compressed individually, so it
+// can be read without decompressing the entire file. The compressed file can
+// be read with ReadDiskChain, but it can't be updated. Reads are slower than
+// from an uncompressed file.
+func CompressDiskChain(dest, src *os.File) error {
+	_, err := readDiskHeader(src)
 	if err != nil {
 		return err
 	}
 
-	if !bytes.Equal(actualHeader, []byte(diskHeader)) {
-		return errors.New("markov: unrecognized file")
+	info, err := src.Stat()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = dest.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	return disk.Compress(dest, src, info.Size(), 0)
+}
+
+func diskHeader(version disk.Version) []byte {
+	return append([]byte(diskMagic), byte(version))
+}
+
+// readDiskHeader returns the format version of file.
+func readDiskHeader(file io.ReaderAt) (disk.Version, error) {
+	actualHeader := make([]byte, diskHeaderLength)
+	_, err := file.ReadAt(actualHeader, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(actualHeader[:len(diskMagic)], []byte(diskMagic)) {
+		return 0, errors.New("markov: unrecognized file")
+	}
+
+	version := disk.Version(actualHeader[len(diskMagic)])
+	if version < disk.Version1 || version > diskVersion {
+		return 0, fmt.Errorf("markov: unsupported file version %d", version)
+	}
+
+	return version, nil
 }
 
 // Get returns a value by it's ID. Returns nil if the ID doesn't exist.
 func (c *DiskChainWriter) Get(id int) (interface{}, error) {
 	if id == 0 {
-		id = len(diskHeader)
+		id = diskHeaderLength
 	}
 
-	record, err := disk.ReadRecord(c.file, int64(id), linkListItemSize)
+	c.fileMutex.RLock()
+	defer c.fileMutex.RUnlock()
+
+	record, err := disk.ReadRecord(c.file, c.version, int64(id), c.linkListItemSize())
 	if err != nil {
 		return nil, err
 	}
@@ -104,44 +253,133 @@ func (c *DiskChainWriter) Get(id int) (interface{}, error) {
 //
 // Returns ErrNotFound if the ID doesn't exist.
 func (c *DiskChainWriter) Links(id int) ([]Link, error) {
+	counts, err := c.linkCounts(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return counts.LinkSlice(), nil
+}
+
+func (c *DiskChainWriter) linkCounts(id int) (linkCountSlice, error) {
 	if id == 0 {
-		id = len(diskHeader)
+		id = diskHeaderLength
 	}
 
-	list, err := c.linkList(int64(id))
+	c.fileMutex.RLock()
+	defer c.fileMutex.RUnlock()
+
+	record, err := disk.ReadRecord(c.file, c.version, int64(id), c.linkListItemSize())
 	if err != nil {
 		return nil, err
 	}
 
-	total := list.Len()
+	return c.recordLinkCounts(record)
+}
+
+// readValueAndLinks returns the value and links of a record with one read,
+// and the generation they were read at.
+func (c *DiskChainWriter) readValueAndLinks(id int) (interface{}, linkCountSlice, uint64, error) {
+	if id == 0 {
+		id = diskHeaderLength
+	}
 
-	links := make([]Link, total)
-	counts := make([]uint32, total)
-	sum := 0
+	c.fileMutex.RLock()
+	defer c.fileMutex.RUnlock()
 
-	for i := 0; i < total; i++ {
-		value, err := list.Get(uint16(i))
+	generation := c.currentGeneration()
+
+	record, err := disk.ReadRecord(c.file, c.version, int64(id), c.linkListItemSize())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	value, err := unmarshalValue(record.Value())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	counts, err := c.recordLinkCounts(record)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return value, counts, generation, nil
+}
+
+// currentGeneration returns the number of times existing records have been
+// updated.
+func (c *DiskChainWriter) currentGeneration() uint64 {
+	c.generationMutex.Lock()
+	defer c.generationMutex.Unlock()
+
+	return c.generation
+}
+
+// lastUpdated returns the generation of the last update to the record at
+// offset. Links read at an earlier generation are stale.
+func (c *DiskChainWriter) lastUpdated(offset int64) uint64 {
+	c.generationMutex.Lock()
+	defer c.generationMutex.Unlock()
+
+	generation, ok := c.updates[offset]
+	if !ok {
+		return c.updatesFloor
+	}
+	return generation
+}
+
+// updated marks links of the record at offset read before now as stale. The
+// caller must hold fileMutex for writing.
+func (c *DiskChainWriter) updated(offset int64) {
+	c.generationMutex.Lock()
+	defer c.generationMutex.Unlock()
+
+	c.generation++
+
+	if c.updates == nil || len(c.updates) >= maxTrackedUpdates {
+		c.updates = make(map[int64]uint64)
+		c.updatesFloor = c.generation
+	}
+	c.updates[offset] = c.generation
+}
+
+func (c *DiskChainWriter) recordLinkCounts(record *disk.Record) (linkCountSlice, error) {
+	if record.Compact() {
+		data, err := record.Data()
 		if err != nil {
 			return nil, err
 		}
 
-		id, count := c.unpackLinkValue(value)
-		sum += int(count)
-		counts[i] = count
-		links[i] = Link{ID: id}
+		return decodeLinks(data)
 	}
 
-	for i := range links {
-		links[i].Probability = float64(counts[i]) / float64(sum)
+	list := record.List
+	total := list.Len()
+	counts := make(linkCountSlice, total)
+
+	for i := 0; i < total; i++ {
+		value, err := list.Get(i)
+		if err != nil {
+			return nil, err
+		}
+
+		id, count := c.unpackLinkValue(value)
+		counts[i] = linkCount{ID: id, Count: int(count)}
 	}
 
-	return links, nil
+	return counts, nil
 }
 
 // Find returns the ID for the given value.
 //
 // Returns ErrNotFound if the value doesn't exist.
 func (c *DiskChainWriter) Find(value interface{}) (int, error) {
+	err := checkComparable(value)
+	if err != nil {
+		return 0, err
+	}
+
 	c.indexMutex.RLock()
 	defer c.indexMutex.RUnlock()
 
@@ -157,24 +395,44 @@ func (c *DiskChainWriter) Find(value interface{}) (int, error) {
 //
 // If the value exists it's ID is returned.
 func (c *DiskChainWriter) Add(value interface{}) (int, error) {
-	return c.add(value, linkListItemsPerBucket)
+	return c.add(value, linkListItemsPerBucket, false)
 }
 
-func (c *DiskChainWriter) add(value interface{}, bucketSize uint16) (int, error) {
+// add inserts a value if it doesn't exist. bucketSize is the capacity of the
+// record's first bucket of links, unless compact is true.
+func (c *DiskChainWriter) add(value interface{}, bucketSize int, compact bool) (int, error) {
 	existing, err := c.Find(value)
 	if err == nil {
 		return existing, nil
 	}
+	if err == ErrNotComparable {
+		return 0, err
+	}
+
+	if c.readOnly {
+		return 0, ErrReadOnly
+	}
 
 	valueBuf, err := marshalValue(value)
 	if err != nil {
 		return 0, err
 	}
 
-	c.fileWriteMutex.Lock()
-	defer c.fileWriteMutex.Unlock()
+	c.fileMutex.Lock()
+	defer c.fileMutex.Unlock()
+
+	// Another goroutine may have added the value since it was checked.
+	existing, err = c.Find(value)
+	if err == nil {
+		return existing, nil
+	}
 
-	record, err := disk.NewRecord(c.file, valueBuf, linkListItemSize, bucketSize)
+	var record *disk.Record
+	if compact {
+		record, err = disk.NewCompactRecord(c.file, c.version, valueBuf)
+	} else {
+		record, err = disk.NewRecord(c.file, c.version, valueBuf, c.linkListItemSize(), bucketSize)
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -189,11 +447,23 @@ func (c *DiskChainWriter) add(value interface{}, bucketSize uint16) (int, error)
 
 // Relate increases the number of times child occurs after parent.
 func (c *DiskChainWriter) Relate(parent, child int, delta int) error {
-	record, err := disk.ReadRecord(c.file, int64(parent), linkListItemSize)
+	if c.readOnly {
+		return ErrReadOnly
+	}
+
+	c.fileMutex.Lock()
+	defer c.fileMutex.Unlock()
+	defer c.updated(int64(parent))
+
+	record, err := disk.ReadRecord(c.file, c.version, int64(parent), c.linkListItemSize())
 	if err != nil {
 		return err
 	}
 
+	if record.Compact() {
+		return ErrReadOnly
+	}
+
 	err = c.relateToRecord(record, child, delta)
 	if err != nil {
 		return err
@@ -202,26 +472,25 @@ func (c *DiskChainWriter) Relate(parent, child int, delta int) error {
 	return record.Write()
 }
 
+// relateToRecord adds to the count of a link in a record. The caller must
+// hold fileMutex.
 func (c *DiskChainWriter) relateToRecord(record *disk.Record, child, delta int) error {
-	c.fileWriteMutex.Lock()
-	defer c.fileWriteMutex.Unlock()
-
 	newChild := true
 
 	// Check for an existing entry
 	for i := 0; i < record.List.Len(); i++ {
-		value, err := record.List.Get(uint16(i))
+		value, err := record.List.Get(i)
 		if err != nil {
 			return err
 		}
 
 		id, count := c.unpackLinkValue(value)
 		if id == child {
-			if int(count)+delta > math.MaxUint32 {
-				return errors.New("uint32 overflow")
+			if delta > 0 && uint64(delta) > c.maxLinkCount()-count {
+				return ErrCountOverflow
 			}
 
-			count += uint32(delta)
+			count += uint64(delta)
 			c.updateLinkCount(value, count)
 			newChild = false
 			break
@@ -229,11 +498,11 @@ func (c *DiskChainWriter) relateToRecord(record *disk.Record, child, delta int)
 	}
 
 	if newChild {
-		if delta > math.MaxUint32 {
-			return errors.New("uint32 overflow")
+		if uint64(delta) > c.maxLinkCount() {
+			return ErrCountOverflow
 		}
 
-		err := record.List.Append(c.packLinkValue(child, uint32(delta)))
+		err := record.List.Append(c.packLinkValue(child, uint64(delta)))
 		if err != nil {
 			return err
 		}
@@ -242,37 +511,188 @@ func (c *DiskChainWriter) relateToRecord(record *disk.Record, child, delta int)
 	return nil
 }
 
-func (c *DiskChainWriter) linkList(id int64) (*disk.List, error) {
-	record, err := disk.ReadRecord(c.file, id, linkListItemSize)
+// appendToRecord appends links to a record. The caller must hold fileMutex.
+func (c *DiskChainWriter) appendToRecord(record *disk.Record, links linkCountSlice, idMap map[int]int) error {
+	for _, link := range links {
+		if uint64(link.Count) > c.maxLinkCount() {
+			return ErrCountOverflow
+		}
+
+		err := record.List.Append(c.packLinkValue(idMap[link.ID], uint64(link.Count)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RelateLinks increases the counts of several children of parent at once,
+// which is faster than calling Relate for each. Satisfies the BatchRelater
+// interface.
+func (c *DiskChainWriter) RelateLinks(parent int, links []LinkCount) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+
+	c.fileMutex.Lock()
+	defer c.fileMutex.Unlock()
+	defer c.updated(int64(parent))
+
+	record, err := disk.ReadRecord(c.file, c.version, int64(parent), c.linkListItemSize())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return record.List, nil
+	if record.Compact() {
+		return ErrReadOnly
+	}
+
+	counts := make(linkCountSlice, len(links))
+	for i, link := range links {
+		counts[i] = linkCount(link)
+	}
+
+	err = c.mergeLinks(record, counts)
+	if err != nil {
+		return err
+	}
+
+	return record.Write()
+}
+
+// mergeIntoRecord adds links to the existing links of a record. The caller
+// must hold fileMutex.
+func (c *DiskChainWriter) mergeIntoRecord(record *disk.Record, links linkCountSlice, idMap map[int]int) error {
+	mapped := make(linkCountSlice, len(links))
+	for i, link := range links {
+		mapped[i] = linkCount{ID: idMap[link.ID], Count: link.Count}
+	}
+
+	return c.mergeLinks(record, mapped)
+}
+
+// mergeLinks adds links to the existing links of a record. The caller must
+// hold fileMutex.
+func (c *DiskChainWriter) mergeLinks(record *disk.Record, links linkCountSlice) error {
+	// Index the existing links, rather than searching the list for each
+	// new one.
+	existing := make(map[int]int, record.List.Len())
+	for i := 0; i < record.List.Len(); i++ {
+		value, err := record.List.Get(i)
+		if err != nil {
+			return err
+		}
+
+		id, _ := c.unpackLinkValue(value)
+		existing[id] = i
+	}
+
+	for _, link := range links {
+		i, ok := existing[link.ID]
+		if !ok {
+			if uint64(link.Count) > c.maxLinkCount() {
+				return ErrCountOverflow
+			}
+
+			err := record.List.Append(c.packLinkValue(link.ID, uint64(link.Count)))
+			if err != nil {
+				return err
+			}
+
+			existing[link.ID] = record.List.Len() - 1
+			continue
+		}
+
+		value, err := record.List.Get(i)
+		if err != nil {
+			return err
+		}
+
+		_, count := c.unpackLinkValue(value)
+		if link.Count > 0 && uint64(link.Count) > c.maxLinkCount()-count {
+			return ErrCountOverflow
+		}
+
+		err = record.List.Set(i, c.packLinkValue(link.ID, count+uint64(link.Count)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkListItemSize returns the size of a packed link.
+//
+// Each link is an 8 byte ID followed by the count. Before version 3 counts
+// were 4 bytes, since then they're 8 bytes.
+func (c *DiskChainWriter) linkListItemSize() int {
+	if c.version < disk.Version3 {
+		return 12
+	}
+	return 16
+}
+
+// maxLinkCount returns the largest count that can be stored in a link.
+func (c *DiskChainWriter) maxLinkCount() uint64 {
+	if c.version < disk.Version3 {
+		return math.MaxUint32
+	}
+	return math.MaxInt64
 }
 
-func (c *DiskChainWriter) unpackLinkValue(value []byte) (id int, count uint32) {
+// setCompactLinks writes the links for a compact record. Compact records
+// can't be updated, so this fails if the record already has links. The
+// caller must hold fileMutex.
+func (c *DiskChainWriter) setCompactLinks(record *disk.Record, links linkCountSlice, idMap map[int]int) error {
+	existing, err := record.Data()
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return ErrReadOnly
+	}
+
+	mapped := make(linkCountSlice, len(links))
+	for i, link := range links {
+		mapped[i] = linkCount{ID: idMap[link.ID], Count: link.Count}
+	}
+
+	return record.SetData(encodeLinks(mapped))
+}
+
+func (c *DiskChainWriter) unpackLinkValue(value []byte) (id int, count uint64) {
 	id = int(binary.BigEndian.Uint64(value))
-	count = binary.BigEndian.Uint32(value[8:])
+	if c.version < disk.Version3 {
+		count = uint64(binary.BigEndian.Uint32(value[8:]))
+	} else {
+		count = binary.BigEndian.Uint64(value[8:])
+	}
 	return
 }
 
-func (c *DiskChainWriter) packLinkValue(id int, count uint32) []byte {
-	buf := make([]byte, 12)
+func (c *DiskChainWriter) packLinkValue(id int, count uint64) []byte {
+	buf := make([]byte, c.linkListItemSize())
 	binary.BigEndian.PutUint64(buf, uint64(id))
-	binary.BigEndian.PutUint32(buf[8:], count)
+	c.updateLinkCount(buf, count)
 	return buf
 }
 
-func (c *DiskChainWriter) updateLinkCount(buf []byte, count uint32) {
-	binary.BigEndian.PutUint32(buf[8:], count)
+func (c *DiskChainWriter) updateLinkCount(buf []byte, count uint64) {
+	if c.version < disk.Version3 {
+		binary.BigEndian.PutUint32(buf[8:], uint32(count))
+	} else {
+		binary.BigEndian.PutUint64(buf[8:], count)
+	}
 }
 
 func (c *DiskChainWriter) buildIndex() error {
 	c.indexMutex.Lock()
 	defer c.indexMutex.Unlock()
 
-	rr := disk.NewRecordReader(c.file, int64(len(diskHeader)), linkListItemSize)
+	rr := disk.NewRecordReader(c.file, c.version, int64(diskHeaderLength), c.linkListItemSize())
 	for {
 		record, err := rr.Read()
 		if err != nil {
@@ -296,10 +716,13 @@ func (c *DiskChainWriter) buildIndex() error {
 // interface.
 func (c *DiskChainWriter) Next(id int) (int, error) {
 	if id == 0 {
-		id = len(diskHeader)
+		id = diskHeaderLength
 	}
 
-	rr := disk.NewRecordReader(c.file, int64(id), linkListItemSize)
+	c.fileMutex.RLock()
+	defer c.fileMutex.RUnlock()
+
+	rr := disk.NewRecordReader(c.file, c.version, int64(id), c.linkListItemSize())
 	next, err := rr.Next()
 	if err == io.EOF {
 		return 0, ErrBrokenChain
@@ -314,8 +737,22 @@ func (c *DiskChainWriter) Next(id int) (int, error) {
 
 // CopyFrom satisfies the CopyFrom interface. It's faster than the generic Copy
 // algorithm implemented by Copy.
+//
+// src is read from one goroutine. To copy into an empty chain, BulkLoad is
+// faster, but it reads src from multiple goroutines.
 func (c *DiskChainWriter) CopyFrom(src Chain) error {
-	valueToDestID := make(map[interface{}]int)
+	if c.readOnly {
+		return ErrReadOnly
+	}
+
+	compact := c.Compact && c.version >= disk.Version4
+
+	type copyID struct {
+		dest  int
+		links linkCountSlice
+	}
+
+	var ids []copyID
 	srcIDtoDestID := make(map[int]int)
 
 	walker := IterativeWalker(src)
@@ -339,45 +776,113 @@ func (c *DiskChainWriter) CopyFrom(src Chain) error {
 			return err
 		}
 
-		destID, err := c.add(value, uint16(len(links)))
+		destID, err := c.add(value, len(links), compact)
 		if err != nil {
 			return err
 		}
 
-		valueToDestID[value] = destID
+		ids = append(ids, copyID{dest: destID, links: links})
 		srcIDtoDestID[srcID] = destID
 	}
 
-	for value, destID := range valueToDestID {
-		srcID, err := src.Find(value)
+	for _, id := range ids {
+		err := c.copyLinks(id.dest, id.links, srcIDtoDestID)
 		if err != nil {
 			return err
 		}
+	}
 
-		linkCounts, err := linkCounts(src, srcID)
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-		record, err := disk.ReadRecord(c.file, int64(destID), linkListItemSize)
-		if err != nil {
-			return err
-		}
+// copyLinks adds links copied from another chain to a record. idMap maps the
+// IDs in the other chain to IDs in this one.
+func (c *DiskChainWriter) copyLinks(destID int, links linkCountSlice, idMap map[int]int) error {
+	c.fileMutex.Lock()
+	defer c.fileMutex.Unlock()
+	defer c.updated(int64(destID))
 
-		for _, link := range linkCounts {
-			err = c.relateToRecord(record, srcIDtoDestID[link.ID], link.Count)
-			if err != nil {
-				return err
-			}
-		}
+	record, err := disk.ReadRecord(c.file, c.version, int64(destID), c.linkListItemSize())
+	if err != nil {
+		return err
+	}
 
-		err = record.Write()
-		if err != nil {
-			return err
-		}
+	if record.Compact() {
+		return c.setCompactLinks(record, links, idMap)
 	}
 
-	return nil
+	// Each link is unique, so if the record was empty there's no need to
+	// search it for existing entries.
+	if record.List.Len() == 0 {
+		err = c.appendToRecord(record, links, idMap)
+	} else {
+		err = c.mergeIntoRecord(record, links, idMap)
+	}
+	if err != nil {
+		return err
+	}
+
+	return record.Write()
+}
+
+// DiskUsage describes the space used in a chain file. Sizes are in bytes, and
+// are uncompressed sizes for compressed files.
+type DiskUsage struct {
+	// Version is the file format version.
+	Version int
+
+	// Compressed is true if the file is compressed.
+	Compressed bool
+
+	// Header is the size of the file header.
+	Header int64
+
+	// Records is the space used by values, including the first bucket of
+	// links for each value.
+	Records     int64
+	RecordCount int
+
+	// ListBuckets is the space used by additional buckets of links, which
+	// are added when the first bucket fills up.
+	ListBuckets     int64
+	ListBucketCount int
+
+	// LinkData is the space used by compact links.
+	LinkData int64
+
+	// Slack is the space reserved for links that haven't been added. It's
+	// part of Records and ListBuckets.
+	Slack int64
+}
+
+// Size returns the total size of the file.
+func (u *DiskUsage) Size() int64 {
+	return u.Header + u.Records + u.ListBuckets + u.LinkData
+}
+
+// Usage reads the entire file and reports how the space is used.
+func (c *DiskChainWriter) Usage() (*DiskUsage, error) {
+	c.fileMutex.RLock()
+	defer c.fileMutex.RUnlock()
+
+	u, err := disk.FileUsage(c.file, c.version, int64(diskHeaderLength), c.linkListItemSize())
+	if err != nil {
+		return nil, err
+	}
+
+	_, compressed := c.file.(*disk.CompressedFile)
+
+	return &DiskUsage{
+		Version:         int(c.version),
+		Compressed:      compressed,
+		Header:          int64(diskHeaderLength),
+		Records:         u.Records,
+		RecordCount:     u.RecordCount,
+		ListBuckets:     u.ListBuckets,
+		ListBucketCount: u.ListBucketCount,
+		LinkData:        u.Data,
+		Slack:           u.Slack,
+	}, nil
 }
 
 // Random pseudo-randomly picks a value and returns it. Satisfies the
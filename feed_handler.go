@@ -0,0 +1,290 @@
+package markov
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxFeedBodySize is the default limit for FeedHandler request bodies.
+const DefaultMaxFeedBodySize = 10 << 20
+
+// FeedHandler is an http.Handler that adds sequences to a chain. Each sequence
+// is written to the chain with Feed.
+//
+// Requests must be POSTs. The body is read according to its Content-Type:
+//
+//	application/json	an object with a "sequences" array of arrays, e.g.
+//				{"sequences": [["a", "b"], ["c", "d"]]}. Values are
+//				decoded as by DecodeJSON.
+//	application/x-ndjson	one JSON array per line
+//	text/plain		one sequence per line, split into words by
+//				whitespace. This is the default.
+//
+// The response is a FeedResult, encoded as JSON. A sequence that fails doesn't
+// stop the others from being added.
+//
+// Sequences aren't applied atomically. A sequence that can't be decoded isn't
+// written at all, but if the chain returns an error part way through a
+// sequence, the values and links before the error stay in the chain. The
+// sequence is reported as rejected, with Partial set in its FeedError.
+// Likewise, if the body can't be read, the response is an error (400 Bad
+// Request or 413 Request Entity Too Large) but the sequences before the
+// problem have been added, and are counted in Accepted.
+type FeedHandler struct {
+	// Chain receives the sequences.
+	Chain WriteChain
+
+	// Lock, if not nil, is held while each sequence is written to the
+	// chain.
+	Lock sync.Locker
+
+	// MaxBodySize is the largest request body that will be read. 0 means
+	// DefaultMaxFeedBodySize.
+	MaxBodySize int64
+
+	// MaxConcurrent is the number of requests that can be handled at once.
+	// Further requests are rejected with 503 Service Unavailable, and a
+	// Retry-After header, until one finishes. 0 means no limit.
+	//
+	// This is the only backpressure: requests aren't queued, since a slow
+	// chain would hold every queued request open. Clients should retry
+	// rejected requests after a delay.
+	MaxConcurrent int
+
+	once    sync.Once
+	pending chan struct{}
+}
+
+// NewFeedHandler creates a FeedHandler for chain.
+func NewFeedHandler(chain WriteChain) *FeedHandler {
+	return &FeedHandler{
+		Chain: chain,
+	}
+}
+
+// FeedResult is the response from FeedHandler.
+type FeedResult struct {
+	// Accepted is the number of sequences that were added.
+	Accepted int `json:"accepted"`
+
+	// Rejected is the number of sequences that weren't added.
+	Rejected int `json:"rejected"`
+
+	// Errors describes each rejected sequence.
+	Errors []FeedError `json:"errors"`
+
+	// Error is set when the request body couldn't be read. Sequences
+	// before the error have been added, and are counted in Accepted.
+	Error string `json:"error,omitempty"`
+}
+
+// FeedError describes a sequence that FeedHandler couldn't add.
+type FeedError struct {
+	// Index is the position of the sequence in the request, starting at 0.
+	Index int `json:"index"`
+
+	Error string `json:"error"`
+
+	// Partial is true if the chain returned the error after part of the
+	// sequence had been written. The part before the error stays in the
+	// chain.
+	Partial bool `json:"partial,omitempty"`
+}
+
+func (h *FeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeFeedError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	h.once.Do(func() {
+		if h.MaxConcurrent > 0 {
+			h.pending = make(chan struct{}, h.MaxConcurrent)
+		}
+	})
+
+	if h.pending != nil {
+		select {
+		case h.pending <- struct{}{}:
+			defer func() { <-h.pending }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeFeedError(w, http.StatusServiceUnavailable, errors.New("too many requests"))
+			return
+		}
+	}
+
+	maxBodySize := h.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxFeedBodySize
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	result := &FeedResult{
+		Errors: []FeedError{},
+	}
+
+	err := readSequences(body, r.Header.Get("Content-Type"), int(maxBodySize), func(i int, sequence []interface{}, err error) {
+		partial := false
+		if err == nil {
+			partial, err = h.feed(sequence)
+		}
+
+		if err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, FeedError{
+				Index:   i,
+				Error:   err.Error(),
+				Partial: partial,
+			})
+			return
+		}
+
+		result.Accepted++
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		result.Error = err.Error()
+		writeFeedResponse(w, status, result)
+		return
+	}
+
+	writeFeedResponse(w, http.StatusOK, result)
+}
+
+// feed writes a sequence to the chain. partial is true if it failed after
+// part of the sequence may have been written.
+func (h *FeedHandler) feed(sequence []interface{}) (partial bool, err error) {
+	if len(sequence) == 0 {
+		return false, errors.New("empty sequence")
+	}
+
+	// Feed can return before reading every value, so the channel is
+	// buffered to hold the whole sequence.
+	values := make(chan interface{}, len(sequence))
+	for _, v := range sequence {
+		values <- v
+	}
+	close(values)
+
+	if h.Lock != nil {
+		h.Lock.Lock()
+		defer h.Lock.Unlock()
+	}
+
+	err = Feed(h.Chain, values)
+	return err != nil, err
+}
+
+// readSequences reads each sequence in the body and passes it to fn, along
+// with an error if that sequence couldn't be decoded. The returned error is
+// for problems with the body as a whole.
+func readSequences(body io.Reader, contentType string, maxLine int, fn func(int, []interface{}, error)) error {
+	mediaType := "text/plain"
+	if contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		return readJSONSequences(body, fn)
+	case "application/x-ndjson":
+		return readLines(body, maxLine, func(i int, line string) {
+			sequence, err := decodeJSONSequence([]byte(line))
+			fn(i, sequence, err)
+		})
+	case "text/plain":
+		return readLines(body, maxLine, func(i int, line string) {
+			fields := strings.Fields(line)
+			sequence := make([]interface{}, len(fields))
+			for j, f := range fields {
+				sequence[j] = f
+			}
+			fn(i, sequence, nil)
+		})
+	default:
+		return fmt.Errorf("unsupported content type %q", mediaType)
+	}
+}
+
+func readJSONSequences(body io.Reader, fn func(int, []interface{}, error)) error {
+	var req struct {
+		Sequences []json.RawMessage `json:"sequences"`
+	}
+
+	err := json.NewDecoder(body).Decode(&req)
+	if err != nil {
+		return err
+	}
+
+	for i, raw := range req.Sequences {
+		sequence, err := decodeJSONSequence(raw)
+		fn(i, sequence, err)
+	}
+
+	return nil
+}
+
+func decodeJSONSequence(buf []byte) ([]interface{}, error) {
+	var raw []json.RawMessage
+	err := json.Unmarshal(buf, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence := make([]interface{}, len(raw))
+	for i := range raw {
+		sequence[i], err = decodeJSONValue(raw[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sequence, nil
+}
+
+// readLines calls fn for each non-blank line.
+func readLines(body io.Reader, maxLine int, fn func(int, string)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxLine)
+
+	i := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fn(i, line)
+		i++
+	}
+
+	return scanner.Err()
+}
+
+func writeFeedResponse(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeFeedError(w http.ResponseWriter, status int, err error) {
+	writeFeedResponse(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,209 @@
+package markov
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeedHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		accepted    int
+		errors      []int
+	}{
+		{
+			name:        "text",
+			contentType: "text/plain; charset=utf-8",
+			body:        "a b c\n\nb c a\n",
+			accepted:    2,
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"sequences": [["a", "b", "c"], "bad", [], ["b", "c", "a"]]}`,
+			accepted:    2,
+			errors:      []int{1, 2},
+		},
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body:        "[\"a\", \"b\", \"c\"]\n{\n[\"b\", \"c\", \"a\"]\n",
+			accepted:    2,
+			errors:      []int{1},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			chain := NewMemoryChain(0)
+			h := NewFeedHandler(chain)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+			req.Header.Set("Content-Type", c.contentType)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			var result FeedResult
+			err := json.NewDecoder(rec.Body).Decode(&result)
+			if err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+
+			if result.Accepted != c.accepted || result.Rejected != len(c.errors) {
+				t.Errorf("got %d accepted, %d rejected, want %d, %d", result.Accepted, result.Rejected, c.accepted, len(c.errors))
+			}
+
+			for i, e := range result.Errors {
+				if i >= len(c.errors) || e.Index != c.errors[i] {
+					t.Errorf("unexpected error for sequence %d: %s", e.Index, e.Error)
+				}
+			}
+
+			aID, _ := chain.Find("a")
+			bID, _ := chain.Find("b")
+			cID, _ := chain.Find("c")
+			counts, _ := LinkCounts(chain, bID)
+			if len(counts) != 1 || counts[0].ID != cID || counts[0].Count != 2 {
+				t.Errorf("got links %v from b, want 2 to c", counts)
+			}
+
+			counts, _ = LinkCounts(chain, cID)
+			if len(counts) != 1 || counts[0].ID != aID || counts[0].Count != 1 {
+				t.Errorf("got links %v from c, want 1 to a", counts)
+			}
+		})
+	}
+}
+
+func TestFeedHandlerErrors(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"method", http.MethodGet, "text/plain", "", http.StatusMethodNotAllowed},
+		{"content type", http.MethodPost, "image/png", "", http.StatusBadRequest},
+		{"json", http.MethodPost, "application/json", "[", http.StatusBadRequest},
+		{"too large", http.MethodPost, "text/plain", strings.Repeat("a b\n", 100), http.StatusRequestEntityTooLarge},
+		{"json at the limit", http.MethodPost, "application/json", "[" + strings.Repeat(" ", 99), http.StatusBadRequest},
+		{"json over the limit", http.MethodPost, "application/json", "[" + strings.Repeat(" ", 100), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := NewFeedHandler(NewMemoryChain(0))
+			h.MaxBodySize = 100
+
+			req := httptest.NewRequest(c.method, "/", strings.NewReader(c.body))
+			req.Header.Set("Content-Type", c.contentType)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Errorf("got status %d, want %d", rec.Code, c.status)
+			}
+		})
+	}
+}
+
+// failingChain is a MemoryChain whose Relate fails after a number of calls.
+type failingChain struct {
+	*MemoryChain
+	relates int
+}
+
+func (c *failingChain) Relate(parent, child, delta int) error {
+	if c.relates == 0 {
+		return ErrCountOverflow
+	}
+	c.relates--
+	return c.MemoryChain.Relate(parent, child, delta)
+}
+
+func TestFeedHandlerPartial(t *testing.T) {
+	chain := &failingChain{MemoryChain: NewMemoryChain(0), relates: 1}
+	h := NewFeedHandler(chain)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a b c\n"))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var result FeedResult
+	err := json.NewDecoder(rec.Body).Decode(&result)
+	if err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+
+	if result.Rejected != 1 || len(result.Errors) != 1 {
+		t.Fatalf("got %d rejected with errors %v, want 1", result.Rejected, result.Errors)
+	}
+
+	if !result.Errors[0].Partial {
+		t.Error("got Partial false, want true")
+	}
+
+	// The link before the error is still there.
+	a, _ := chain.Find("a")
+	b, _ := chain.Find("b")
+	counts, _ := chain.linkCounts(a)
+	if len(counts) != 1 || counts[0].ID != b {
+		t.Errorf("got links %v from a, want a link to b", counts)
+	}
+}
+
+// blockingLocker signals when Lock is called and blocks until released.
+type blockingLocker struct {
+	locked  chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLocker) Lock() {
+	l.locked <- struct{}{}
+	<-l.release
+}
+
+func (l *blockingLocker) Unlock() {}
+
+func TestFeedHandlerMaxConcurrent(t *testing.T) {
+	lock := &blockingLocker{
+		locked:  make(chan struct{}),
+		release: make(chan struct{}),
+	}
+
+	h := NewFeedHandler(NewMemoryChain(0))
+	h.Lock = lock
+	h.MaxConcurrent = 1
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a b"))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	// The first request has the only slot once it's waiting for the lock.
+	<-lock.locked
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a b"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	close(lock.release)
+	<-done
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
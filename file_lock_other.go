@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package markov
+
+import "os"
+
+const fileLockSupported = false
+
+// lockFile does nothing, files aren't locked on this platform.
+func lockFile(f *os.File, exclusive, wait bool) error {
+	return nil
+}
+
+// fileWritable always returns true, since it's only used to choose the type
+// of lock.
+func fileWritable(f *os.File) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,53 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package markov
+
+import (
+	"os"
+	"syscall"
+)
+
+const fileLockSupported = true
+
+// lockFile places an advisory lock on f, exclusive if exclusive is true and
+// shared otherwise. If wait is false it returns ErrLocked instead of waiting
+// for another process to release a conflicting lock. The lock is released
+// when f is closed.
+//
+// Locking a file that's already locked through the same handle changes the
+// type of the lock.
+func lockFile(f *os.File, exclusive, wait bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch err {
+		case nil:
+			return nil
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return ErrLocked
+		}
+
+		return &os.PathError{Op: "flock", Path: f.Name(), Err: err}
+	}
+}
+
+// fileWritable reports whether f was opened for writing.
+func fileWritable(f *os.File) (bool, error) {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return false, &os.PathError{Op: "fcntl", Path: f.Name(), Err: errno}
+	}
+
+	return flags&syscall.O_ACCMODE != syscall.O_RDONLY, nil
+}
@@ -0,0 +1,253 @@
+package markov
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GraphOptions limits the output of EncodeDOT, EncodeGraphML and EncodeCSV.
+// The zero value includes everything.
+type GraphOptions struct {
+	// MinProbability omits links with a lower probability.
+	MinProbability float64
+
+	// MaxNodes limits the output to the first MaxNodes values returned by
+	// IterativeWalker. Links to other values are omitted. 0 means no
+	// limit.
+	MaxNodes int
+}
+
+type graphEdge struct {
+	From, To    int
+	Count       int
+	Probability float64
+}
+
+// walkGraph calls node for each value in the chain, followed by edge for each
+// of the value's links.
+func walkGraph(chain Chain, opts *GraphOptions, node func(id int, value interface{}) error, edge func(graphEdge) error) error {
+	if opts == nil {
+		opts = &GraphOptions{}
+	}
+
+	var included map[int]struct{}
+	if opts.MaxNodes > 0 {
+		var err error
+		included, err = firstIDs(chain, opts.MaxNodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	walker := IterativeWalker(chain)
+	for nodes := 0; opts.MaxNodes <= 0 || nodes < opts.MaxNodes; nodes++ {
+		value, err := walker.Next()
+		if err != nil {
+			if err == ErrBrokenChain {
+				break
+			}
+			return err
+		}
+
+		id, err := chain.Find(value)
+		if err != nil {
+			return err
+		}
+
+		err = node(id, value)
+		if err != nil {
+			return err
+		}
+
+		links, err := linkCounts(chain, id)
+		if err != nil {
+			return err
+		}
+
+		total := links.sum()
+		for _, link := range links {
+			if included != nil {
+				if _, ok := included[link.ID]; !ok {
+					continue
+				}
+			}
+
+			p := float64(link.Count) / total
+			if p < opts.MinProbability {
+				continue
+			}
+
+			err = edge(graphEdge{From: id, To: link.ID, Count: link.Count, Probability: p})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// firstIDs returns the IDs of the first n values.
+func firstIDs(chain Chain, n int) (map[int]struct{}, error) {
+	ids := make(map[int]struct{}, n)
+
+	walker := IterativeWalker(chain)
+	for len(ids) < n {
+		value, err := walker.Next()
+		if err != nil {
+			if err == ErrBrokenChain {
+				break
+			}
+			return nil, err
+		}
+
+		id, err := chain.Find(value)
+		if err != nil {
+			return nil, err
+		}
+
+		ids[id] = struct{}{}
+	}
+
+	return ids, nil
+}
+
+// EncodeDOT writes the chain to w as a Graphviz DOT directed graph. Each value
+// is a node, and each link is an edge labeled with its probability. opts may
+// be nil.
+func EncodeDOT(w io.Writer, chain Chain, opts *GraphOptions) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString("digraph chain {\n")
+	if err != nil {
+		return err
+	}
+
+	err = walkGraph(chain, opts,
+		func(id int, value interface{}) error {
+			_, err := fmt.Fprintf(bw, "\tn%d [label=%s];\n", id, dotQuote(fmt.Sprint(value)))
+			return err
+		},
+		func(e graphEdge) error {
+			_, err := fmt.Fprintf(bw, "\tn%d -> n%d [label=\"%s\"];\n", e.From, e.To, formatProbability(e.Probability))
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = bw.WriteString("}\n")
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// EncodeGraphML writes the chain to w as a GraphML directed graph. Nodes have
+// a "value" attribute, and edges have "count" and "probability" attributes.
+// opts may be nil.
+func EncodeGraphML(w io.Writer, chain Chain, opts *GraphOptions) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString(xml.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="value" for="node" attr.name="value" attr.type="string"/>
+  <key id="count" for="edge" attr.name="count" attr.type="long"/>
+  <key id="probability" for="edge" attr.name="probability" attr.type="double"/>
+  <graph id="chain" edgedefault="directed">
+`)
+	if err != nil {
+		return err
+	}
+
+	err = walkGraph(chain, opts,
+		func(id int, value interface{}) error {
+			_, err := fmt.Fprintf(bw, "    <node id=\"n%d\"><data key=\"value\">", id)
+			if err != nil {
+				return err
+			}
+
+			err = xml.EscapeText(bw, []byte(fmt.Sprint(value)))
+			if err != nil {
+				return err
+			}
+
+			_, err = bw.WriteString("</data></node>\n")
+			return err
+		},
+		func(e graphEdge) error {
+			_, err := fmt.Fprintf(bw,
+				"    <edge source=\"n%d\" target=\"n%d\"><data key=\"count\">%d</data><data key=\"probability\">%s</data></edge>\n",
+				e.From, e.To, e.Count, formatProbability(e.Probability))
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = bw.WriteString("  </graph>\n</graphml>\n")
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// EncodeCSV writes each link in the chain to w as a CSV row of
+// from,to,count,probability. The first row is a header. opts may be nil.
+func EncodeCSV(w io.Writer, chain Chain, opts *GraphOptions) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"from", "to", "count", "probability"})
+	if err != nil {
+		return err
+	}
+
+	var from string
+	err = walkGraph(chain, opts,
+		func(id int, value interface{}) error {
+			from = fmt.Sprint(value)
+			return nil
+		},
+		func(e graphEdge) error {
+			to, err := chain.Get(e.To)
+			if err != nil {
+				return err
+			}
+
+			return cw.Write([]string{
+				from,
+				fmt.Sprint(to),
+				strconv.Itoa(e.Count),
+				formatProbability(e.Probability),
+			})
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatProbability(p float64) string {
+	return strconv.FormatFloat(p, 'g', 6, 64)
+}
@@ -0,0 +1,184 @@
+package markov
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func graphTestChain(t *testing.T) *MemoryChain {
+	chain := NewMemoryChain(0)
+
+	// a -> b (1), a -> c (3), b -> a, c -> a, c -> "d \"e\""
+	values := []interface{}{"a", "b", "a", "c", "a", "c", "a", "c", `d "e"`}
+	err := Feed(chain, sliceChannel(values))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	return chain
+}
+
+func TestEncodeDOT(t *testing.T) {
+	chain := graphTestChain(t)
+
+	var buf bytes.Buffer
+	err := EncodeDOT(&buf, chain, nil)
+	if err != nil {
+		t.Fatalf("EncodeDOT failed: %v", err)
+	}
+
+	expected := `digraph chain {
+	n0 [label="a"];
+	n0 -> n1 [label="0.25"];
+	n0 -> n2 [label="0.75"];
+	n1 [label="b"];
+	n1 -> n0 [label="1"];
+	n2 [label="c"];
+	n2 -> n0 [label="0.666667"];
+	n2 -> n3 [label="0.333333"];
+	n3 [label="d \"e\""];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	err = EncodeDOT(&buf, chain, &GraphOptions{MinProbability: 0.5, MaxNodes: 2})
+	if err != nil {
+		t.Fatalf("EncodeDOT failed: %v", err)
+	}
+
+	expected = `digraph chain {
+	n0 [label="a"];
+	n1 [label="b"];
+	n1 -> n0 [label="1"];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestEncodeGraphML(t *testing.T) {
+	chain := graphTestChain(t)
+
+	var buf bytes.Buffer
+	err := EncodeGraphML(&buf, chain, nil)
+	if err != nil {
+		t.Fatalf("EncodeGraphML failed: %v", err)
+	}
+
+	var doc struct {
+		Nodes []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:"data"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data"`
+		} `xml:"graph>edge"`
+	}
+
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+
+	if len(doc.Nodes) != 4 {
+		t.Errorf("got %d nodes, want 4", len(doc.Nodes))
+	} else if doc.Nodes[3].Value != `d "e"` {
+		t.Errorf("got node value %q, want %q", doc.Nodes[3].Value, `d "e"`)
+	}
+
+	if len(doc.Edges) != 5 {
+		t.Fatalf("got %d edges, want 5", len(doc.Edges))
+	}
+
+	edge := doc.Edges[1]
+	if edge.Source != "n0" || edge.Target != "n2" || edge.Data[0].Value != "3" || edge.Data[1].Value != "0.75" {
+		t.Errorf("got edge %+v", edge)
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	chain := graphTestChain(t)
+
+	var buf bytes.Buffer
+	err := EncodeCSV(&buf, chain, &GraphOptions{MinProbability: 0.5})
+	if err != nil {
+		t.Fatalf("EncodeCSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+
+	expected := [][]string{
+		{"from", "to", "count", "probability"},
+		{"a", "c", "3", "0.75"},
+		{"b", "a", "1", "1"},
+		{"c", "a", "2", "0.666667"},
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("got %d records, want %d", len(records), len(expected))
+	}
+
+	for i := range expected {
+		if strings.Join(records[i], ",") != strings.Join(expected[i], ",") {
+			t.Errorf("got %v, want %v", records[i], expected[i])
+		}
+	}
+}
+
+// shortWriter fails once more than n bytes have been written.
+type shortWriter struct {
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		written := w.n
+		w.n = 0
+		return written, io.ErrShortWrite
+	}
+
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestEncodeGraphWriteError(t *testing.T) {
+	chain := graphTestChain(t)
+
+	encoders := map[string]func(io.Writer, Chain, *GraphOptions) error{
+		"dot":     EncodeDOT,
+		"graphml": EncodeGraphML,
+		"csv":     EncodeCSV,
+	}
+
+	for name, encode := range encoders {
+		var buf bytes.Buffer
+		err := encode(&buf, chain, nil)
+		if err != nil {
+			t.Fatalf("%s: encode failed: %v", name, err)
+		}
+
+		// Partial output always comes with an error.
+		for n := 0; n < buf.Len(); n++ {
+			err := encode(&shortWriter{n: n}, chain, nil)
+			if err == nil {
+				t.Errorf("%s: got no error writing %d of %d bytes", name, n, buf.Len())
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrDataTooLong is returned by SetData when the data is too large to fit in
+// a section.
+var ErrDataTooLong = errors.New("record data too long")
+
+// A compact record stores its value and the offset of a data section instead
+// of a list. The data is opaque to this package, it's up to the caller to
+// encode the record's elements.
+//
+// The layout matches a normal record with a zero-length list bucket, except
+// that the list bucket's next pointer is the offset of the data section.
+
+// NewCompactRecord appends a new compact record at the end of file. The
+// record has no data until SetData is called.
+//
+// Compact records require Version4 or later.
+func NewCompactRecord(file File, v Version, value []byte) (*Record, error) {
+	if len(value) > maxValueLength(v) {
+		return nil, ErrValueTooLong
+	}
+
+	headerLen := sectionHeaderLength + recordHeaderLength(v)
+	size := headerLen + len(value) + offsetLength
+
+	buf := make([]byte, size)
+	putSectionHeader(buf, compactRecordSection, uint32(size-sectionHeaderLength))
+
+	r := &Record{
+		Offset:  -1,
+		file:    file,
+		version: v,
+		compact: true,
+		buf:     buf,
+	}
+	r.putHeader(len(value), 0)
+	copy(buf[headerLen:], value)
+
+	return r, r.Write()
+}
+
+func (r *Record) readCompact() error {
+	r.compact = true
+
+	rest := make([]byte, r.valueLength()+offsetLength)
+	_, err := r.file.ReadAt(rest, r.Offset+int64(len(r.buf)))
+	if err != nil {
+		return err
+	}
+
+	r.buf = append(r.buf, rest...)
+	return nil
+}
+
+// Compact returns true if the record is a compact record.
+func (r *Record) Compact() bool {
+	return r.compact
+}
+
+func (r *Record) dataOffset() int64 {
+	return int64(binary.BigEndian.Uint64(r.buf[len(r.buf)-offsetLength:]))
+}
+
+// Data returns the data stored with a compact record. It returns nil if the
+// record is not compact or has no data.
+func (r *Record) Data() ([]byte, error) {
+	if !r.compact {
+		return nil, nil
+	}
+
+	offset := r.dataOffset()
+	if offset == 0 {
+		return nil, nil
+	}
+
+	header := make([]byte, sectionHeaderLength)
+	_, err := r.file.ReadAt(header, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	st, len := sectionHeader(header)
+	if st != dataSection {
+		return nil, sectionTypeError(st)
+	}
+
+	data := make([]byte, len)
+	_, err = r.file.ReadAt(data, offset+sectionHeaderLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// SetData appends data to the end of the file and links it to the compact
+// record. The record is written to update the link, and any data previously
+// set on the record becomes unreachable.
+func (r *Record) SetData(data []byte) error {
+	if !r.compact {
+		return errors.New("not a compact record")
+	}
+
+	if len(data) > maxSectionLength {
+		return ErrDataTooLong
+	}
+
+	buf := make([]byte, sectionHeaderLength+len(data))
+	putSectionHeader(buf, dataSection, uint32(len(data)))
+	copy(buf[sectionHeaderLength:], data)
+
+	offset, err := writeAt(r.file, -1, buf)
+	if err != nil {
+		return err
+	}
+
+	binary.BigEndian.PutUint64(r.buf[len(r.buf)-offsetLength:], uint64(offset))
+	return r.Write()
+}
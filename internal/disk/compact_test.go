@@ -0,0 +1,82 @@
+package disk
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCompactRecord(t *testing.T) {
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	file.Write([]byte{'x'})
+
+	values := [][]byte{[]byte("a"), []byte("bb"), []byte("ccc")}
+	data := [][]byte{[]byte("data for a"), nil, []byte("data for c")}
+
+	records := make([]*Record, len(values))
+	for i, v := range values {
+		var err error
+		records[i], err = NewCompactRecord(file, Version4, v)
+		if err != nil {
+			t.Fatalf("NewCompactRecord failed: %v", err)
+		}
+
+		// A normal record in between shouldn't interfere.
+		_, err = NewRecord(file, Version4, v, 8, 4)
+		if err != nil {
+			t.Fatalf("NewRecord failed: %v", err)
+		}
+	}
+
+	for i, r := range records {
+		if data[i] == nil {
+			continue
+		}
+
+		err := r.SetData(data[i])
+		if err != nil {
+			t.Fatalf("SetData failed: %v", err)
+		}
+	}
+
+	rr := NewRecordReader(file, Version4, 1, 8)
+	for i := 0; ; i++ {
+		r, err := rr.Read()
+		if err == io.EOF {
+			if i != len(values)*2 {
+				t.Errorf("got %d records, want %d", i, len(values)*2)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		if !bytes.Equal(r.Value(), values[i/2]) {
+			t.Errorf("%d: got value %q, want %q", i, r.Value(), values[i/2])
+		}
+
+		compact := i%2 == 0
+		if r.Compact() != compact {
+			t.Errorf("%d: got compact %v, want %v", i, r.Compact(), compact)
+		}
+
+		if !compact {
+			if r.List == nil {
+				t.Errorf("%d: got nil list", i)
+			}
+			continue
+		}
+
+		actual, err := r.Data()
+		if err != nil {
+			t.Fatalf("%d: Data failed: %v", i, err)
+		}
+
+		if !bytes.Equal(actual, data[i/2]) {
+			t.Errorf("%d: got data %q, want %q", i, actual, data[i/2])
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package disk
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// A compressed file holds the contents of another file split into fixed-size
+// blocks, each compressed with DEFLATE. Blocks are decompressed as they're
+// read, so the original file can be read at any offset without decompressing
+// all of it.
+//
+// The layout is:
+//
+//	magic                 4 bytes
+//	block size            4 bytes
+//	uncompressed length   8 bytes
+//	index offset          8 bytes
+//	compressed blocks
+//	index                 8 byte offset of each block, then the end of the
+//	                      last block
+const (
+	compressedMagic        = "MKZ\u0001"
+	compressedHeaderLength = 24
+
+	// DefaultBlockSize is the uncompressed size of each block used by
+	// Compress when blockSize is 0.
+	DefaultBlockSize = 64 << 10
+
+	// MaxBlockSize is the largest block size. Larger blocks are rejected
+	// by Compress, and files that claim to have them are considered
+	// corrupt.
+	MaxBlockSize = 16 << 20
+
+	// compressedCacheSize is the number of decompressed blocks kept in
+	// memory.
+	compressedCacheSize = 8
+)
+
+// ErrReadOnly is returned when writing to a read-only file.
+var ErrReadOnly = errors.New("read-only file")
+
+var (
+	errCorruptCompressed = errors.New("corrupt compressed file")
+	errBlockSize         = errors.New("invalid block size")
+)
+
+// IsCompressed returns true if r is a compressed file.
+func IsCompressed(r io.ReaderAt) (bool, error) {
+	buf := make([]byte, len(compressedMagic))
+	_, err := r.ReadAt(buf, 0)
+	if err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return string(buf) == compressedMagic, nil
+}
+
+// Compress writes the first size bytes of src to dest as a compressed file.
+// If blockSize is 0, DefaultBlockSize is used. It can't be larger than
+// MaxBlockSize.
+func Compress(dest io.WriterAt, src io.ReaderAt, size int64, blockSize int) error {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	if blockSize > MaxBlockSize {
+		return errBlockSize
+	}
+
+	blocks := blockCount(size, blockSize)
+	index := make([]byte, (blocks+1)*offsetLength)
+
+	offset := int64(compressedHeaderLength)
+	block := make([]byte, blockSize)
+	var compressed bytes.Buffer
+
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < blocks; i++ {
+		n, err := src.ReadAt(block, int64(i)*int64(blockSize))
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if remaining := size - int64(i)*int64(blockSize); int64(n) > remaining {
+			n = int(remaining)
+		}
+
+		compressed.Reset()
+		fw.Reset(&compressed)
+
+		_, err = fw.Write(block[:n])
+		if err != nil {
+			return err
+		}
+
+		err = fw.Close()
+		if err != nil {
+			return err
+		}
+
+		_, err = dest.WriteAt(compressed.Bytes(), offset)
+		if err != nil {
+			return err
+		}
+
+		binary.BigEndian.PutUint64(index[i*offsetLength:], uint64(offset))
+		offset += int64(compressed.Len())
+	}
+
+	binary.BigEndian.PutUint64(index[blocks*offsetLength:], uint64(offset))
+
+	_, err = dest.WriteAt(index, offset)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, compressedHeaderLength)
+	copy(header, compressedMagic)
+	binary.BigEndian.PutUint32(header[4:], uint32(blockSize))
+	binary.BigEndian.PutUint64(header[8:], uint64(size))
+	binary.BigEndian.PutUint64(header[16:], uint64(offset))
+
+	_, err = dest.WriteAt(header, 0)
+	return err
+}
+
+// CompressedFile reads a file written by Compress. It satisfies File, but
+// all writes return ErrReadOnly.
+//
+// CompressedFile is safe for concurrent use.
+type CompressedFile struct {
+	r         io.ReaderAt
+	blockSize int
+	size      int64
+	index     []int64
+
+	mu        sync.Mutex
+	cache     [compressedCacheSize]compressedBlock
+	nextCache int
+}
+
+type compressedBlock struct {
+	number int
+	buf    []byte
+}
+
+// blockCount returns the number of blocks needed for size bytes.
+func blockCount(size int64, blockSize int) int {
+	blocks := size / int64(blockSize)
+	if size%int64(blockSize) != 0 {
+		blocks++
+	}
+	return int(blocks)
+}
+
+// OpenCompressed reads the header and block index of a compressed file that's
+// fileSize bytes long. The header and index are checked against the file size
+// before anything is allocated from them, so a corrupt file returns an error
+// instead of exhausting memory.
+func OpenCompressed(r io.ReaderAt, fileSize int64) (*CompressedFile, error) {
+	header := make([]byte, compressedHeaderLength)
+	_, err := r.ReadAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(header[:len(compressedMagic)]) != compressedMagic {
+		return nil, errors.New("not a compressed file")
+	}
+
+	f := &CompressedFile{
+		r:         r,
+		blockSize: int(binary.BigEndian.Uint32(header[4:])),
+		size:      int64(binary.BigEndian.Uint64(header[8:])),
+	}
+
+	if f.blockSize <= 0 || f.blockSize > MaxBlockSize || f.size < 0 {
+		return nil, errCorruptCompressed
+	}
+
+	// The index is at the end of the file, after the blocks, with an
+	// offset for each block and one more. So the index offset and the
+	// number of blocks are limited by the file size.
+	indexOffset := int64(binary.BigEndian.Uint64(header[16:]))
+	if indexOffset < compressedHeaderLength || indexOffset > fileSize {
+		return nil, errCorruptCompressed
+	}
+
+	blocks := blockCount(f.size, f.blockSize)
+	if int64(blocks) >= (fileSize-indexOffset)/offsetLength {
+		return nil, errCorruptCompressed
+	}
+
+	buf := make([]byte, (blocks+1)*offsetLength)
+	_, err = r.ReadAt(buf, indexOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	f.index = make([]int64, blocks+1)
+	last := int64(compressedHeaderLength)
+	for i := range f.index {
+		offset := int64(binary.BigEndian.Uint64(buf[i*offsetLength:]))
+		if offset < last || offset > indexOffset {
+			return nil, errCorruptCompressed
+		}
+
+		f.index[i] = offset
+		last = offset
+	}
+
+	for i := range f.cache {
+		f.cache[i].number = -1
+	}
+
+	return f, nil
+}
+
+// Size returns the uncompressed size of the file.
+func (f *CompressedFile) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(p) uncompressed bytes starting at off.
+func (f *CompressedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+
+		number := int(off / int64(f.blockSize))
+		block, err := f.block(number)
+		if err != nil {
+			return n, err
+		}
+
+		copied := copy(p[n:], block[off-int64(number)*int64(f.blockSize):])
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+// block returns the decompressed contents of a block. Blocks are decompressed
+// without holding the lock, so concurrent reads of different blocks don't
+// wait for each other.
+func (f *CompressedFile) block(number int) ([]byte, error) {
+	buf := f.cachedBlock(number)
+	if buf != nil {
+		return buf, nil
+	}
+
+	if number+1 >= len(f.index) {
+		return nil, errCorruptCompressed
+	}
+
+	start, end := f.index[number], f.index[number+1]
+	fr := flate.NewReader(io.NewSectionReader(f.r, start, end-start))
+	defer fr.Close()
+
+	length := int64(f.blockSize)
+	if remaining := f.size - int64(number)*int64(f.blockSize); remaining < length {
+		length = remaining
+	}
+
+	buf = make([]byte, length)
+	_, err := io.ReadFull(fr, buf)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errCorruptCompressed
+		}
+		return nil, err
+	}
+
+	f.cacheBlock(number, buf)
+
+	return buf, nil
+}
+
+// cachedBlock returns a block from the cache, or nil.
+func (f *CompressedFile) cachedBlock(number int) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, b := range f.cache {
+		if b.number == number {
+			return b.buf
+		}
+	}
+
+	return nil
+}
+
+// cacheBlock adds a block to the cache, unless another reader already has.
+func (f *CompressedFile) cacheBlock(number int, buf []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, b := range f.cache {
+		if b.number == number {
+			return
+		}
+	}
+
+	f.cache[f.nextCache] = compressedBlock{number: number, buf: buf}
+	f.nextCache = (f.nextCache + 1) % len(f.cache)
+}
+
+// WriteAt always returns ErrReadOnly.
+func (f *CompressedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// Write always returns ErrReadOnly.
+func (f *CompressedFile) Write(p []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// Seek always returns ErrReadOnly.
+func (f *CompressedFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, ErrReadOnly
+}
@@ -0,0 +1,215 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestCompressed(t *testing.T) {
+	src, cleanup := tempFile(t)
+	defer cleanup()
+
+	dest, cleanup2 := tempFile(t)
+	defer cleanup2()
+
+	// Repetitive data so it compresses, with a partial last block.
+	const (
+		blockSize = 1000
+		size      = blockSize*10 + 123
+	)
+
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 7)
+	}
+	src.Write(data)
+
+	err := Compress(dest, src, size, blockSize)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	compressed, err := IsCompressed(dest)
+	if err != nil {
+		t.Fatalf("IsCompressed failed: %v", err)
+	}
+	if !compressed {
+		t.Fatal("got IsCompressed false, want true")
+	}
+
+	compressed, err = IsCompressed(src)
+	if err != nil {
+		t.Fatalf("IsCompressed failed: %v", err)
+	}
+	if compressed {
+		t.Fatal("got IsCompressed true, want false")
+	}
+
+	info, _ := dest.Stat()
+	if info.Size() >= size {
+		t.Errorf("got compressed size %d, want < %d", info.Size(), size)
+	}
+
+	f, err := OpenCompressed(dest, info.Size())
+	if err != nil {
+		t.Fatalf("OpenCompressed failed: %v", err)
+	}
+
+	if f.Size() != size {
+		t.Errorf("got size %d, want %d", f.Size(), size)
+	}
+
+	for i := 0; i < 100; i++ {
+		off := rand.Int63n(size)
+		buf := make([]byte, rand.Intn(blockSize*3))
+
+		n, err := f.ReadAt(buf, off)
+
+		want := data[off:]
+		if len(want) > len(buf) {
+			want = want[:len(buf)]
+		}
+
+		if len(want) < len(buf) && err != io.EOF {
+			t.Errorf("got error %v at end of file, want %v", err, io.EOF)
+		}
+
+		if !bytes.Equal(buf[:n], want) {
+			t.Fatalf("read %d bytes at %d: wrong data", len(buf), off)
+		}
+	}
+
+	_, err = f.WriteAt([]byte{1}, 0)
+	if err != ErrReadOnly {
+		t.Errorf("got error %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestOpenCompressedCorrupt(t *testing.T) {
+	src, cleanup := tempFile(t)
+	defer cleanup()
+
+	const size = 5000
+	src.Write(bytes.Repeat([]byte("abc"), size/3))
+
+	var compressed bytes.Buffer
+	w := &bufferWriterAt{buf: &compressed}
+	err := Compress(w, src, size, 1000)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	valid := compressed.Bytes()
+
+	_, err = OpenCompressed(bytes.NewReader(valid), int64(len(valid)))
+	if err != nil {
+		t.Fatalf("OpenCompressed failed: %v", err)
+	}
+
+	indexOffset := binary.BigEndian.Uint64(valid[16:])
+
+	cases := []struct {
+		name   string
+		offset int
+		value  uint64
+		width  int
+	}{
+		{"zero block size", 4, 0, 4},
+		{"huge block size", 4, math.MaxUint32, 4},
+		{"huge uncompressed size", 8, 1 << 50, 8},
+		{"negative uncompressed size", 8, math.MaxUint64, 8},
+		{"index past the end", 16, uint64(len(valid)) + 1, 8},
+		{"index in the header", 16, 1, 8},
+		{"block past the index", int(indexOffset) + offsetLength, indexOffset + 1, 8},
+		{"blocks out of order", int(indexOffset) + offsetLength, compressedHeaderLength - 1, 8},
+	}
+
+	for _, tc := range cases {
+		corrupt := append([]byte(nil), valid...)
+		if tc.width == 4 {
+			binary.BigEndian.PutUint32(corrupt[tc.offset:], uint32(tc.value))
+		} else {
+			binary.BigEndian.PutUint64(corrupt[tc.offset:], tc.value)
+		}
+
+		_, err := OpenCompressed(bytes.NewReader(corrupt), int64(len(corrupt)))
+		if err != errCorruptCompressed {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, errCorruptCompressed)
+		}
+	}
+
+	err = Compress(w, src, size, MaxBlockSize+1)
+	if err != errBlockSize {
+		t.Errorf("got error %v, want %v", err, errBlockSize)
+	}
+}
+
+func TestCompressedConcurrentReads(t *testing.T) {
+	src, cleanup := tempFile(t)
+	defer cleanup()
+
+	const (
+		blockSize = 100
+		size      = blockSize * 50
+	)
+
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	src.Write(data)
+
+	var compressed bytes.Buffer
+	err := Compress(&bufferWriterAt{buf: &compressed}, src, size, blockSize)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	f, err := OpenCompressed(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()))
+	if err != nil {
+		t.Fatalf("OpenCompressed failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			r := rand.New(rand.NewSource(seed))
+			buf := make([]byte, 10)
+			for i := 0; i < 200; i++ {
+				off := r.Int63n(size - int64(len(buf)))
+				_, err := f.ReadAt(buf, off)
+				if err != nil {
+					t.Errorf("ReadAt failed: %v", err)
+					return
+				}
+
+				if !bytes.Equal(buf, data[off:off+int64(len(buf))]) {
+					t.Errorf("read at %d: wrong data", off)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
+
+// bufferWriterAt is an io.WriterAt that writes to a bytes.Buffer.
+type bufferWriterAt struct {
+	buf *bytes.Buffer
+}
+
+func (w *bufferWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	b := w.buf.Bytes()
+	if end := int(off) + len(p); end > len(b) {
+		w.buf.Write(make([]byte, end-len(b)))
+		b = w.buf.Bytes()
+	}
+	return copy(b[off:], p), nil
+}
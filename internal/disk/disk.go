@@ -3,20 +3,61 @@ package disk
 import (
 	"fmt"
 	"io"
-	"os"
 )
 
 const (
 	offsetLength        = 8
 	sectionHeaderLength = 4
-	recordHeaderLength  = 4
+
+	// maxSectionLength is the largest length that fits in a section
+	// header.
+	maxSectionLength = 1<<24 - 1
 )
 
+// Version identifies the layout of the records in a file.
+type Version uint8
+
+const (
+	// Version1 stores 16-bit value and list bucket lengths in record
+	// headers.
+	Version1 Version = 1
+
+	// Version2 stores 32-bit value and list bucket lengths in record
+	// headers.
+	Version2 Version = 2
+
+	// Version3 has the same record layout as Version2. It signals that
+	// list elements may be larger than in previous versions.
+	Version3 Version = 3
+
+	// Version4 adds compact records.
+	Version4 Version = 4
+)
+
+// recordHeaderLength returns the length of the record header (excluding the
+// section header) for the given version.
+func recordHeaderLength(v Version) int {
+	if v == Version1 {
+		return 4
+	}
+	return 8
+}
+
+// File is the interface used to read and write chain data. *os.File
+// satisfies it.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	io.WriteSeeker
+}
+
 type sectionType uint8
 
 const (
 	recordSection sectionType = 1 << iota
 	listBucketSection
+	compactRecordSection
+	dataSection
 )
 
 type sectionTypeError sectionType
@@ -47,7 +88,7 @@ func sectionHeader(buf []byte) (t sectionType, len uint32) {
 //
 // A negative offset starts from the end of the file. -1 is the very end, -2 is
 // the byte before and so forth.
-func writeAt(w *os.File, offset int64, buf []byte) (int64, error) {
+func writeAt(w File, offset int64, buf []byte) (int64, error) {
 	var newOff int64
 	var err error
 
@@ -0,0 +1,159 @@
+package disk
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// An EncodedRecord is a record built in memory, to be written to a new file.
+// Records are written one after another, and the sections that belong to
+// them (list buckets that don't fit in the record and compact record data)
+// are written later in the file. See SetDataOffset.
+type EncodedRecord struct {
+	// Record is the record section.
+	Record []byte
+
+	// Data holds the other sections that belong to the record.
+	Data []byte
+
+	// pointers are the offsets in Record and Data that point into Data.
+	pointers []pointer
+}
+
+type pointer struct {
+	buf    []byte
+	target int64
+}
+
+// RecordSize returns the size of a record encoded by EncodeRecord, with room
+// for capacity elements.
+func RecordSize(v Version, valueLen, elementSize, capacity int) int {
+	return sectionHeaderLength + recordHeaderLength(v) + valueLen + ListBucketSize(elementSize, headBucketLen(v, valueLen, elementSize, capacity))
+}
+
+// headBucketLen returns the capacity of the list bucket in a record. It's the
+// requested capacity, unless it won't fit. It's at least 1 so the list can
+// grow later.
+func headBucketLen(v Version, valueLen, elementSize, capacity int) int {
+	maxBucketLen := (maxSectionLength - recordHeaderLength(v) - valueLen - offsetLength) / elementSize
+	if v == Version1 && maxBucketLen > math.MaxUint16 {
+		maxBucketLen = math.MaxUint16
+	}
+
+	if capacity > maxBucketLen {
+		return maxBucketLen
+	}
+
+	if capacity < 1 {
+		return 1
+	}
+
+	return capacity
+}
+
+// EncodeRecord encodes a record with a list. elements holds the packed list
+// elements, each elementSize bytes long. The record's list bucket has room for
+// capacity elements, or for all the elements if there are more.
+//
+// Elements that don't fit in the record's list bucket are stored in
+// additional buckets in Data. Every bucket has the same capacity, so the last
+// may have unused space.
+func EncodeRecord(v Version, value []byte, elementSize int, elements []byte, capacity int) (*EncodedRecord, error) {
+	if len(value) > maxValueLength(v) {
+		return nil, ErrValueTooLong
+	}
+
+	count := len(elements) / elementSize
+	if capacity < count {
+		capacity = count
+	}
+
+	bucketLen := headBucketLen(v, len(value), elementSize, capacity)
+	bucketSize := ListBucketSize(elementSize, bucketLen)
+
+	headerLen := sectionHeaderLength + recordHeaderLength(v)
+	size := headerLen + len(value) + bucketSize
+
+	r := &Record{
+		version: v,
+		buf:     make([]byte, size),
+	}
+	putSectionHeader(r.buf, recordSection, uint32(size-sectionHeaderLength))
+	r.putHeader(len(value), bucketLen)
+	copy(r.buf[headerLen:], value)
+
+	head := r.buf[headerLen+len(value):]
+	n := copy(head[offsetLength:], elements)
+	elements = elements[n:]
+
+	// Allocate all the extra buckets at once, so the slices pointing into
+	// Data stay valid.
+	extra := (len(elements)/elementSize + bucketLen - 1) / bucketLen
+	e := &EncodedRecord{
+		Record: r.buf,
+		Data:   make([]byte, extra*(sectionHeaderLength+bucketSize)),
+	}
+
+	// next is the next pointer of the previous bucket.
+	next := head[:offsetLength]
+
+	for start := 0; start < len(e.Data); start += sectionHeaderLength + bucketSize {
+		bucket := e.Data[start : start+sectionHeaderLength+bucketSize]
+		putSectionHeader(bucket, listBucketSection, uint32(bucketSize))
+		n := copy(bucket[sectionHeaderLength+offsetLength:], elements)
+		elements = elements[n:]
+
+		e.pointers = append(e.pointers, pointer{buf: next, target: int64(start)})
+		next = bucket[sectionHeaderLength : sectionHeaderLength+offsetLength]
+	}
+
+	return e, nil
+}
+
+// CompactRecordSize returns the size of a record encoded by
+// EncodeCompactRecord.
+func CompactRecordSize(v Version, valueLen int) int {
+	return sectionHeaderLength + recordHeaderLength(v) + valueLen + offsetLength
+}
+
+// EncodeCompactRecord encodes a compact record with its data. Compact records
+// require Version4 or later.
+func EncodeCompactRecord(v Version, value []byte, data []byte) (*EncodedRecord, error) {
+	if len(value) > maxValueLength(v) {
+		return nil, ErrValueTooLong
+	}
+
+	if len(data) > maxSectionLength {
+		return nil, ErrDataTooLong
+	}
+
+	headerLen := sectionHeaderLength + recordHeaderLength(v)
+	size := CompactRecordSize(v, len(value))
+
+	r := &Record{
+		version: v,
+		buf:     make([]byte, size),
+	}
+	putSectionHeader(r.buf, compactRecordSection, uint32(size-sectionHeaderLength))
+	r.putHeader(len(value), 0)
+	copy(r.buf[headerLen:], value)
+
+	e := &EncodedRecord{
+		Record: r.buf,
+		Data:   make([]byte, sectionHeaderLength+len(data)),
+	}
+	putSectionHeader(e.Data, dataSection, uint32(len(data)))
+	copy(e.Data[sectionHeaderLength:], data)
+
+	e.pointers = []pointer{{buf: r.buf[size-offsetLength:], target: 0}}
+
+	return e, nil
+}
+
+// SetDataOffset updates the record with the offset that Data will be written
+// at. It must be called before the record is written.
+func (e *EncodedRecord) SetDataOffset(offset int64) {
+	for _, p := range e.pointers {
+		binary.BigEndian.PutUint64(p.buf, uint64(offset+p.target))
+	}
+}
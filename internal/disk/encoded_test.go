@@ -0,0 +1,177 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// writeEncoded writes records the way a bulk load does: records first, then
+// their data.
+func writeEncoded(t *testing.T, w io.WriteSeeker, records []*EncodedRecord) []int64 {
+	t.Helper()
+
+	start, err := w.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+
+	offsets := make([]int64, len(records))
+	dataOffset := start
+	for i, r := range records {
+		offsets[i] = dataOffset
+		dataOffset += int64(len(r.Record))
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		r.SetDataOffset(dataOffset)
+		dataOffset += int64(len(r.Data))
+		buf.Write(r.Record)
+	}
+	for _, r := range records {
+		buf.Write(r.Data)
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	return offsets
+}
+
+func TestEncodeRecord(t *testing.T) {
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	file.Write([]byte{'x'})
+
+	const elementSize = 8
+
+	// Version1 limits buckets to 65535 elements, so the large list
+	// needs extra buckets.
+	counts := []int{0, 3, 3, 1<<17 + 5}
+	capacities := []int{0, 0, 10, 0}
+
+	records := make([]*EncodedRecord, len(counts))
+	for i, count := range counts {
+		elements := make([]byte, count*elementSize)
+		for j := 0; j < count; j++ {
+			binary.BigEndian.PutUint64(elements[j*elementSize:], uint64(j+1))
+		}
+
+		var err error
+		records[i], err = EncodeRecord(Version1, []byte{byte('a' + i)}, elementSize, elements, capacities[i])
+		if err != nil {
+			t.Fatalf("EncodeRecord failed: %v", err)
+		}
+
+		capacity := capacities[i]
+		if capacity < count {
+			capacity = count
+		}
+
+		if size := RecordSize(Version1, 1, elementSize, capacity); size != len(records[i].Record) {
+			t.Errorf("%d: RecordSize returned %d, want %d", i, size, len(records[i].Record))
+		}
+	}
+
+	offsets := writeEncoded(t, file, records)
+
+	rr := NewRecordReader(file, Version1, offsets[0], elementSize)
+	for i, count := range counts {
+		r, err := rr.Read()
+		if err != nil {
+			t.Fatalf("%d: Read failed: %v", i, err)
+		}
+
+		if r.Offset != offsets[i] {
+			t.Errorf("%d: got offset %d, want %d", i, r.Offset, offsets[i])
+		}
+
+		if !bytes.Equal(r.Value(), []byte{byte('a' + i)}) {
+			t.Errorf("%d: got value %q", i, r.Value())
+		}
+
+		if r.List.Len() != count {
+			t.Fatalf("%d: got %d elements, want %d", i, r.List.Len(), count)
+		}
+
+		if r.List.Cap() < capacities[i] {
+			t.Errorf("%d: got capacity %d, want at least %d", i, r.List.Cap(), capacities[i])
+		}
+
+		for j := 0; j < count; j++ {
+			buf, err := r.List.Get(j)
+			if err != nil {
+				t.Fatalf("%d: Get(%d) failed: %v", i, j, err)
+			}
+
+			if actual := binary.BigEndian.Uint64(buf); actual != uint64(j+1) {
+				t.Fatalf("%d: element %d is %d, want %d", i, j, actual, j+1)
+			}
+		}
+
+		// The list can still grow.
+		buf := make([]byte, elementSize)
+		binary.BigEndian.PutUint64(buf, 1)
+		err = r.List.Append(buf)
+		if err != nil {
+			t.Fatalf("%d: Append failed: %v", i, err)
+		}
+		if r.List.Len() != count+1 {
+			t.Errorf("%d: got %d elements after Append, want %d", i, r.List.Len(), count+1)
+		}
+	}
+
+	_, err := rr.Read()
+	if err != io.EOF {
+		t.Errorf("got error %v, want %v", err, io.EOF)
+	}
+}
+
+func TestEncodeCompactRecord(t *testing.T) {
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	file.Write([]byte{'x'})
+
+	data := [][]byte{[]byte("data for a"), {}, []byte("data for c")}
+
+	records := make([]*EncodedRecord, len(data))
+	for i := range data {
+		var err error
+		records[i], err = EncodeCompactRecord(Version4, []byte{byte('a' + i)}, data[i])
+		if err != nil {
+			t.Fatalf("EncodeCompactRecord failed: %v", err)
+		}
+
+		if size := CompactRecordSize(Version4, 1); size != len(records[i].Record) {
+			t.Errorf("%d: CompactRecordSize returned %d, want %d", i, size, len(records[i].Record))
+		}
+	}
+
+	offsets := writeEncoded(t, file, records)
+
+	for i := range data {
+		r, err := ReadRecord(file, Version4, offsets[i], 8)
+		if err != nil {
+			t.Fatalf("%d: ReadRecord failed: %v", i, err)
+		}
+
+		if !r.Compact() {
+			t.Errorf("%d: record isn't compact", i)
+		}
+
+		actual, err := r.Data()
+		if err != nil {
+			t.Fatalf("%d: Data failed: %v", i, err)
+		}
+
+		if !bytes.Equal(actual, data[i]) {
+			t.Errorf("%d: got data %q, want %q", i, actual, data[i])
+		}
+	}
+}
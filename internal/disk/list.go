@@ -3,30 +3,29 @@ package disk
 import (
 	"encoding/binary"
 	"errors"
-	"os"
 )
 
 var ErrOutOfBounds = errors.New("list index out of bounds")
 
 type List struct {
-	file        *os.File
-	elementSize uint16
-	bucketCap   uint16
+	file        File
+	elementSize int
+	bucketCap   int
 
 	headBucket *listBucket
 
 	readBucket       *listBucket
-	readBucketNumber uint16
+	readBucketNumber int
 
 	tailBucket       *listBucket
-	tailBucketNumber uint16
+	tailBucketNumber int
 }
 
-func NewList(f *os.File, elementSize uint16, buf []byte) (*List, error) {
+func NewList(f File, elementSize int, buf []byte) (*List, error) {
 	l := &List{
 		file:        f,
 		elementSize: elementSize,
-		bucketCap:   (uint16(len(buf)) - offsetLength) / elementSize,
+		bucketCap:   (len(buf) - offsetLength) / elementSize,
 	}
 
 	l.headBucket = newListBucketFromBuf(-1, elementSize, buf)
@@ -40,8 +39,8 @@ func NewList(f *os.File, elementSize uint16, buf []byte) (*List, error) {
 	return l, nil
 }
 
-func ListBucketSize(elementSize, cap uint16) int {
-	return int(elementSize*cap) + offsetLength
+func ListBucketSize(elementSize, cap int) int {
+	return elementSize*cap + offsetLength
 }
 
 func (l *List) Append(buf []byte) error {
@@ -65,7 +64,7 @@ func (l *List) Append(buf []byte) error {
 	return nil
 }
 
-func (l *List) Get(i uint16) ([]byte, error) {
+func (l *List) Get(i int) ([]byte, error) {
 	bucketNumber := i / l.bucketCap
 	bucketIndex := i % l.bucketCap
 
@@ -74,14 +73,34 @@ func (l *List) Get(i uint16) ([]byte, error) {
 		return nil, err
 	}
 
-	if b == nil || bucketIndex > b.Count {
+	if b == nil || bucketIndex >= b.Count {
 		return nil, ErrOutOfBounds
 	}
 
 	return b.Get(bucketIndex), nil
 }
 
-func (l *List) loadReadBucket(number uint16) (*listBucket, error) {
+// Set replaces the element at index i. Changes are written by Flush.
+func (l *List) Set(i int, buf []byte) error {
+	bucketNumber := i / l.bucketCap
+	bucketIndex := i % l.bucketCap
+
+	b, err := l.loadReadBucket(bucketNumber)
+	if err != nil {
+		return err
+	}
+
+	if b == nil || bucketIndex >= b.Count {
+		return ErrOutOfBounds
+	}
+
+	copy(b.Get(bucketIndex), buf[:l.elementSize])
+	b.dirty = true
+
+	return nil
+}
+
+func (l *List) loadReadBucket(number int) (*listBucket, error) {
 	if number == 0 {
 		return l.headBucket, nil
 	}
@@ -94,6 +113,14 @@ func (l *List) loadReadBucket(number uint16) (*listBucket, error) {
 		return l.readBucket, nil
 	}
 
+	// Write changes made with Set before the bucket is replaced.
+	if l.readBucket.dirty {
+		err := l.readBucket.Flush(l.file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	offset, err := l.bucketOffset(number)
 	if err != nil {
 		return nil, err
@@ -114,13 +141,13 @@ func (l *List) loadReadBucket(number uint16) (*listBucket, error) {
 	return l.readBucket, nil
 }
 
-func (l *List) bucketOffset(number uint16) (int64, error) {
+func (l *List) bucketOffset(number int) (int64, error) {
 	offset := l.headBucket.Next()
 	var err error
 
 	buf := make([]byte, offsetLength)
 
-	for i := uint16(1); i < number; i++ {
+	for i := 1; i < number; i++ {
 		_, err = l.file.ReadAt(buf, offset+sectionHeaderLength)
 		if err != nil {
 			return 0, err
@@ -157,8 +184,8 @@ func (l *List) loadTailBucket() error {
 	return err
 }
 
-func (l *List) findTailBucket(offset int64) (int64, uint16, error) {
-	var number uint16
+func (l *List) findTailBucket(offset int64) (int64, int, error) {
+	var number int
 	var err error
 
 	buf := make([]byte, offsetLength)
@@ -181,19 +208,34 @@ func (l *List) findTailBucket(offset int64) (int64, uint16, error) {
 	return offset, number, nil
 }
 
-func (l *List) ElementSize() uint16 {
+func (l *List) ElementSize() int {
 	return l.elementSize
 }
 
 // Length returns the number of elements in the list.
 func (l *List) Len() int {
-	length := int(l.tailBucketNumber) * int(l.bucketCap)
-	length += int(l.tailBucket.Count)
+	length := l.tailBucketNumber * l.bucketCap
+	length += l.tailBucket.Count
 	return length
 }
 
+// Cap returns the number of elements the list can hold before another bucket
+// is needed.
+func (l *List) Cap() int {
+	return (l.tailBucketNumber + 1) * l.bucketCap
+}
+
 func (l *List) Flush() error {
-	// Never write the head bucket
+	// Elements returned by Get can be modified in place, so the bucket
+	// they were read from is written too. Never write the head bucket, it's
+	// written with the record.
+	if l.readBucketNumber != 0 && l.readBucketNumber != l.tailBucketNumber {
+		err := l.readBucket.Flush(l.file)
+		if err != nil {
+			return err
+		}
+	}
+
 	if l.tailBucketNumber == 0 {
 		return nil
 	}
@@ -207,12 +249,16 @@ func (l *List) Flush() error {
 type listBucket struct {
 	offset      int64
 	buf         []byte
-	elementSize uint16
+	elementSize int
 	managed     bool
-	Count       uint16
+	Count       int
+
+	// dirty is true if the bucket has been changed by List.Set since it
+	// was written.
+	dirty bool
 }
 
-func newListBucket(f *os.File, elementSize, cap uint16) (*listBucket, error) {
+func newListBucket(f File, elementSize, cap int) (*listBucket, error) {
 	b := &listBucket{
 		offset:      -1,
 		elementSize: elementSize,
@@ -225,7 +271,7 @@ func newListBucket(f *os.File, elementSize, cap uint16) (*listBucket, error) {
 	return b, b.Flush(f)
 }
 
-func newListBucketFromBuf(offset int64, elementSize uint16, buf []byte) *listBucket {
+func newListBucketFromBuf(offset int64, elementSize int, buf []byte) *listBucket {
 	b := &listBucket{
 		offset:      offset,
 		elementSize: elementSize,
@@ -237,14 +283,14 @@ func newListBucketFromBuf(offset int64, elementSize uint16, buf []byte) *listBuc
 	return b
 }
 
-func readListBucket(f *os.File, offset int64, elementSize, cap uint16) (*listBucket, error) {
+func readListBucket(f File, offset int64, elementSize, cap int) (*listBucket, error) {
 	b := &listBucket{
 		offset:      offset,
 		elementSize: elementSize,
 		managed:     true,
 	}
 
-	size := elementSize*cap + offsetLength + recordHeaderLength
+	size := sectionHeaderLength + ListBucketSize(elementSize, cap)
 
 	b.buf = make([]byte, size)
 	_, err := f.ReadAt(b.buf, offset)
@@ -262,7 +308,7 @@ func readListBucket(f *os.File, offset int64, elementSize, cap uint16) (*listBuc
 	return b, nil
 }
 
-func (b *listBucket) indexOffset(i uint16) (offset uint16) {
+func (b *listBucket) indexOffset(i int) (offset int) {
 	offset = offsetLength + i*b.elementSize
 	if b.managed {
 		offset += sectionHeaderLength
@@ -270,13 +316,13 @@ func (b *listBucket) indexOffset(i uint16) (offset uint16) {
 	return
 }
 
-func (b *listBucket) countElements() uint16 {
+func (b *listBucket) countElements() int {
 	// TODO: Maybe check the last element first? Only the last bucket will
 	// partially filled.
 
-	var count uint16
+	var count int
 
-	for i := b.indexOffset(0); i < uint16(len(b.buf)); i += b.elementSize {
+	for i := b.indexOffset(0); i < len(b.buf); i += b.elementSize {
 		if isNull(b.buf[i : i+b.elementSize]) {
 			return count
 		}
@@ -299,7 +345,7 @@ func (b *listBucket) Append(buf []byte) {
 	b.Count++
 }
 
-func (b *listBucket) Get(i uint16) []byte {
+func (b *listBucket) Get(i int) []byte {
 	o := b.indexOffset(i)
 	return b.buf[o : o+b.elementSize]
 }
@@ -320,7 +366,7 @@ func (b *listBucket) SetNext(offset int64) {
 	binary.BigEndian.PutUint64(b.buf[start:], uint64(offset))
 }
 
-func (b *listBucket) Flush(f *os.File) error {
+func (b *listBucket) Flush(f File) error {
 	if !b.managed {
 		return nil
 	}
@@ -331,5 +377,6 @@ func (b *listBucket) Flush(f *os.File) error {
 	}
 
 	b.offset = offset
+	b.dirty = false
 	return nil
 }
@@ -29,7 +29,7 @@ func TestList(t *testing.T) {
 		inserts := 1024
 
 		buf := make([]byte, l.ElementSize())
-		for i := uint16(0); i < uint16(inserts); i++ {
+		for i := 0; i < inserts; i++ {
 			binary.BigEndian.PutUint64(buf, uint64(i+1))
 			l.Append(buf)
 		}
@@ -38,7 +38,7 @@ func TestList(t *testing.T) {
 			t.Errorf("got len %d, want %d", l.Len(), inserts)
 		}
 
-		for i := uint16(0); i < uint16(inserts); i++ {
+		for i := 0; i < inserts; i++ {
 			buf, err := l.Get(i)
 			if err != nil {
 				t.Fatalf("Get %d failed: %v", i, err)
@@ -88,9 +88,9 @@ func TestList(t *testing.T) {
 			t.Errorf("got len %d, want %d", l2.Len(), l.Len())
 		}
 
-		length := uint16(l2.Len())
+		length := l2.Len()
 
-		for i := uint16(0); i < length; i++ {
+		for i := 0; i < length; i++ {
 			buf, err := l2.Get(i)
 			if err != nil {
 				t.Fatalf("%d: Get failed: %v", i, err)
@@ -113,7 +113,7 @@ func TestList(t *testing.T) {
 		inserts := 20
 
 		buf := make([]byte, l3.ElementSize())
-		for i := uint16(0); i < uint16(inserts); i++ {
+		for i := 0; i < inserts; i++ {
 			binary.BigEndian.PutUint64(buf, uint64(i+1))
 			l3.Append(buf)
 		}
@@ -122,4 +122,140 @@ func TestList(t *testing.T) {
 			t.Errorf("got len %d, want %d", l3.Len(), originalLen+inserts)
 		}
 	})
+
+	t.Run("Update", func(t *testing.T) {
+		// Element 20 is in the second bucket, which is neither the
+		// head nor the tail.
+		const index = 20
+
+		l4, err := NewList(rw, elementSize, head)
+		if err != nil {
+			t.Fatalf("ReadList failed: %v", err)
+		}
+
+		buf, err := l4.Get(index)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		binary.BigEndian.PutUint64(buf, 9999)
+
+		err = l4.Flush()
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+
+		l5, err := NewList(rw, elementSize, head)
+		if err != nil {
+			t.Fatalf("ReadList failed: %v", err)
+		}
+
+		buf, err = l5.Get(index)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+
+		if actual := binary.BigEndian.Uint64(buf); actual != 9999 {
+			t.Errorf("got %d, want 9999", actual)
+		}
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		// Elements in the head, two middle buckets and the tail.
+		indexes := []int{3, 20, 40, l.Len() - 1}
+
+		l6, err := NewList(rw, elementSize, head)
+		if err != nil {
+			t.Fatalf("ReadList failed: %v", err)
+		}
+
+		buf := make([]byte, elementSize)
+		for _, i := range indexes {
+			binary.BigEndian.PutUint64(buf, uint64(i+5000))
+			err := l6.Set(i, buf)
+			if err != nil {
+				t.Fatalf("Set %d failed: %v", i, err)
+			}
+		}
+
+		err = l6.Set(l6.Len(), buf)
+		if err != ErrOutOfBounds {
+			t.Errorf("got error %v, want %v", err, ErrOutOfBounds)
+		}
+
+		err = l6.Flush()
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+
+		l7, err := NewList(rw, elementSize, head)
+		if err != nil {
+			t.Fatalf("ReadList failed: %v", err)
+		}
+
+		for _, i := range indexes {
+			buf, err := l7.Get(i)
+			if err != nil {
+				t.Fatalf("Get %d failed: %v", i, err)
+			}
+
+			if actual := binary.BigEndian.Uint64(buf); actual != uint64(i+5000) {
+				t.Errorf("%d: got %d, want %d", i, actual, i+5000)
+			}
+		}
+	})
+}
+
+func TestListLarge(t *testing.T) {
+	rw, cleanup := tempFile(t)
+	defer cleanup()
+
+	const (
+		elementSize = 8
+		bucketCap   = 1024
+		inserts     = 1<<16 + 100
+	)
+
+	rw.Write([]byte{'x'})
+
+	head := make([]byte, ListBucketSize(elementSize, bucketCap))
+
+	l, err := NewList(rw, elementSize, head)
+	if err != nil {
+		t.Fatalf("NewList failed: %v", err)
+	}
+
+	buf := make([]byte, elementSize)
+	for i := 0; i < inserts; i++ {
+		binary.BigEndian.PutUint64(buf, uint64(i+1))
+		err = l.Append(buf)
+		if err != nil {
+			t.Fatalf("Append %d failed: %v", i, err)
+		}
+	}
+
+	err = l.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	l2, err := NewList(rw, elementSize, head)
+	if err != nil {
+		t.Fatalf("NewList failed: %v", err)
+	}
+
+	if l2.Len() != inserts {
+		t.Fatalf("got len %d, want %d", l2.Len(), inserts)
+	}
+
+	for i := 0; i < inserts; i++ {
+		buf, err := l2.Get(i)
+		if err != nil {
+			t.Fatalf("Get %d failed: %v", i, err)
+		}
+
+		actual := binary.BigEndian.Uint64(buf)
+		if actual != uint64(i+1) {
+			t.Fatalf("%d: want %d, got %d", i, i+1, actual)
+		}
+	}
 }
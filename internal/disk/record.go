@@ -2,45 +2,69 @@ package disk
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
-	"os"
+	"math"
 )
 
+// ErrValueTooLong is returned by NewRecord when the value is too large to fit
+// in a record.
+var ErrValueTooLong = errors.New("record value too long")
+
 type Record struct {
 	Offset int64
-	List   *List
-	file   *os.File
-	buf    []byte
+
+	// List holds the record's list elements. It's nil for compact
+	// records.
+	List *List
+
+	file    File
+	version Version
+	compact bool
+	buf     []byte
 }
 
 // NewRecord appends a new record at the end of file.
-func NewRecord(file *os.File, value []byte, listElementSize uint16, listBucketLen uint16) (*Record, error) {
-	size := sectionHeaderLength + recordHeaderLength + len(value)
+//
+// listBucketLen is the capacity of the record's first list bucket. It's
+// reduced if it won't fit in the record, further elements will be stored in
+// additional buckets.
+func NewRecord(file File, v Version, value []byte, listElementSize int, listBucketLen int) (*Record, error) {
+	if len(value) > maxValueLength(v) {
+		return nil, ErrValueTooLong
+	}
+
+	headerLen := sectionHeaderLength + recordHeaderLength(v)
+
+	maxBucketLen := (maxSectionLength - recordHeaderLength(v) - len(value) - offsetLength) / listElementSize
+	if v == Version1 && maxBucketLen > math.MaxUint16 {
+		maxBucketLen = math.MaxUint16
+	}
+	if listBucketLen > maxBucketLen {
+		listBucketLen = maxBucketLen
+	}
+
+	size := headerLen + len(value)
 	size += ListBucketSize(listElementSize, listBucketLen)
 
 	buf := make([]byte, size)
-	n := 0
-	putSectionHeader(buf[n:], recordSection, uint32(size-sectionHeaderLength))
-	n += 4
-	binary.BigEndian.PutUint16(buf[n:], uint16(len(value)))
-	n += 2
-	binary.BigEndian.PutUint16(buf[n:], listBucketLen)
-	n += 2
-	copy(buf[n:], value)
-	n += len(value)
+	putSectionHeader(buf, recordSection, uint32(size-sectionHeaderLength))
 
 	r := &Record{
-		Offset: -1,
-		file:   file,
-		buf:    buf,
+		Offset:  -1,
+		file:    file,
+		version: v,
+		buf:     buf,
 	}
+	r.putHeader(len(value), listBucketLen)
+	copy(buf[headerLen:], value)
 
 	err := r.Write()
 	if err != nil {
 		return nil, err
 	}
 
-	r.List, err = NewList(file, listElementSize, buf[n:])
+	r.List, err = NewList(file, listElementSize, buf[headerLen+len(value):])
 	if err != nil {
 		return nil, err
 	}
@@ -49,36 +73,42 @@ func NewRecord(file *os.File, value []byte, listElementSize uint16, listBucketLe
 }
 
 // ReadRecord reads a record from file at the given offset.
-func ReadRecord(file *os.File, offset int64, listElementSize uint16) (*Record, error) {
+func ReadRecord(file File, v Version, offset int64, listElementSize int) (*Record, error) {
 	r := &Record{
-		Offset: offset,
-		file:   file,
+		Offset:  offset,
+		file:    file,
+		version: v,
 	}
 
-	r.buf = make([]byte, sectionHeaderLength+recordHeaderLength)
+	headerLen := sectionHeaderLength + recordHeaderLength(v)
+
+	r.buf = make([]byte, headerLen)
 	_, err := file.ReadAt(r.buf, offset)
 	if err != nil {
 		return nil, err
 	}
 
 	st, _ := sectionHeader(r.buf)
+	if st == compactRecordSection {
+		return r, r.readCompact()
+	}
+
 	if st != recordSection {
 		return nil, sectionTypeError(st)
 	}
 
 	valueLen := r.valueLength()
-	restSize := int(valueLen) + ListBucketSize(listElementSize, r.listElements())
+	restSize := valueLen + ListBucketSize(listElementSize, r.listElements())
 	rest := make([]byte, restSize)
 
-	_, err = file.ReadAt(rest, offset+recordHeaderLength+sectionHeaderLength)
+	_, err = file.ReadAt(rest, offset+int64(headerLen))
 	if err != nil {
 		return nil, err
 	}
 
 	r.buf = append(r.buf, rest...)
 
-	listOffset := sectionHeaderLength + recordHeaderLength + int64(valueLen)
-	r.List, err = NewList(file, listElementSize, r.buf[listOffset:])
+	r.List, err = NewList(file, listElementSize, r.buf[headerLen+valueLen:])
 	if err != nil {
 		return nil, err
 	}
@@ -101,32 +131,61 @@ func (r *Record) Write() error {
 	return r.List.Flush()
 }
 
-func (r *Record) valueLength() uint16 {
-	return binary.BigEndian.Uint16(r.buf[4:])
+func (r *Record) putHeader(valueLen, listElements int) {
+	buf := r.buf[sectionHeaderLength:]
+	if r.version == Version1 {
+		binary.BigEndian.PutUint16(buf, uint16(valueLen))
+		binary.BigEndian.PutUint16(buf[2:], uint16(listElements))
+		return
+	}
+
+	binary.BigEndian.PutUint32(buf, uint32(valueLen))
+	binary.BigEndian.PutUint32(buf[4:], uint32(listElements))
+}
+
+func (r *Record) valueLength() int {
+	buf := r.buf[sectionHeaderLength:]
+	if r.version == Version1 {
+		return int(binary.BigEndian.Uint16(buf))
+	}
+	return int(binary.BigEndian.Uint32(buf))
 }
 
-func (r *Record) listElements() uint16 {
-	return binary.BigEndian.Uint16(r.buf[6:])
+func (r *Record) listElements() int {
+	buf := r.buf[sectionHeaderLength:]
+	if r.version == Version1 {
+		return int(binary.BigEndian.Uint16(buf[2:]))
+	}
+	return int(binary.BigEndian.Uint32(buf[4:]))
 }
 
 func (r *Record) Value() []byte {
-	start := sectionHeaderLength + recordHeaderLength
-	end := start + int(r.valueLength())
+	start := sectionHeaderLength + recordHeaderLength(r.version)
+	end := start + r.valueLength()
 	return r.buf[start:end]
 }
 
+func maxValueLength(v Version) int {
+	if v == Version1 {
+		return math.MaxUint16
+	}
+	return maxSectionLength - recordHeaderLength(v) - offsetLength
+}
+
 // RecordReader iterates through the records in a file.
 type RecordReader struct {
-	file            *os.File
+	file            File
+	version         Version
 	nextOffset      int64
-	listElementSize uint16
+	listElementSize int
 }
 
 // NewRecordReader creates a RecordReader. startOffset must the offset of a
 // record. listElementSize is passed through to ReadRecord.
-func NewRecordReader(file *os.File, startOffset int64, listElementSize uint16) *RecordReader {
+func NewRecordReader(file File, v Version, startOffset int64, listElementSize int) *RecordReader {
 	return &RecordReader{
 		file:            file,
+		version:         v,
 		nextOffset:      startOffset,
 		listElementSize: listElementSize,
 	}
@@ -139,7 +198,7 @@ func (rr *RecordReader) Read() (*Record, error) {
 		return nil, io.EOF
 	}
 
-	r, err := ReadRecord(rr.file, rr.nextOffset, rr.listElementSize)
+	r, err := ReadRecord(rr.file, rr.version, rr.nextOffset, rr.listElementSize)
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +230,7 @@ func (rr *RecordReader) Next() (int64, error) {
 		}
 
 		t, len := sectionHeader(buf)
-		if !first && t == recordSection {
+		if !first && (t == recordSection || t == compactRecordSection) {
 			return rr.nextOffset, nil
 		}
 
@@ -2,11 +2,21 @@ package disk
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"math"
 	"testing"
 )
 
 func TestRecord(t *testing.T) {
+	for _, v := range []Version{Version1, Version2} {
+		t.Run(fmt.Sprintf("Version%d", v), func(t *testing.T) {
+			testRecord(t, v)
+		})
+	}
+}
+
+func testRecord(t *testing.T, v Version) {
 	file, cleanup := tempFile(t)
 	defer cleanup()
 
@@ -23,7 +33,7 @@ func TestRecord(t *testing.T) {
 
 	t.Run("Read/Write", func(t *testing.T) {
 		for i := int64(0); i < inserts; i++ {
-			recordIn, err := NewRecord(file, buf, listElementSize, listBucketLength)
+			recordIn, err := NewRecord(file, v, buf, listElementSize, listBucketLength)
 			if err != nil {
 				t.Fatalf("got error: %v", err)
 			}
@@ -44,7 +54,7 @@ func TestRecord(t *testing.T) {
 	})
 
 	t.Run("Read", func(t *testing.T) {
-		rr := NewRecordReader(file, 0, listElementSize)
+		rr := NewRecordReader(file, v, 0, listElementSize)
 		found := 0
 
 		for {
@@ -75,3 +85,34 @@ func TestRecord(t *testing.T) {
 		}
 	})
 }
+
+func TestRecordLargeBucket(t *testing.T) {
+	cases := []struct {
+		v       Version
+		request int
+		want    int
+	}{
+		{Version1, math.MaxUint16 + 1, math.MaxUint16},
+		{Version2, math.MaxUint16 + 1, math.MaxUint16 + 1},
+		{Version2, maxSectionLength, (maxSectionLength - 8 - 1 - offsetLength) / 8},
+	}
+
+	for _, c := range cases {
+		file, cleanup := tempFile(t)
+		defer cleanup()
+
+		record, err := NewRecord(file, c.v, []byte{1}, 8, c.request)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+
+		record, err = ReadRecord(file, c.v, record.Offset, 8)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+
+		if record.listElements() != c.want {
+			t.Errorf("version %d: got bucket length %d, want %d", c.v, record.listElements(), c.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package disk
+
+import "io"
+
+// Usage describes the space used by each kind of section in a file. Sizes
+// include section headers.
+type Usage struct {
+	// Records is the space used by records, including the first list
+	// bucket of each record.
+	Records     int64
+	RecordCount int
+
+	// ListBuckets is the space used by list buckets after the first.
+	ListBuckets     int64
+	ListBucketCount int
+
+	// Data is the space used by the data of compact records.
+	Data int64
+
+	// Slack is the unused space in list buckets. It's part of Records and
+	// ListBuckets.
+	Slack int64
+}
+
+// FileUsage reads every section in file after start and totals the space
+// used by each type. listElementSize is passed through to ReadRecord.
+func FileUsage(file File, v Version, start int64, listElementSize int) (*Usage, error) {
+	u := &Usage{}
+
+	buf := make([]byte, sectionHeaderLength)
+	offset := start
+
+	for {
+		_, err := file.ReadAt(buf, offset)
+		if err != nil {
+			if err == io.EOF {
+				return u, nil
+			}
+			return nil, err
+		}
+
+		t, len := sectionHeader(buf)
+		size := sectionHeaderLength + int64(len)
+
+		switch t {
+		case recordSection:
+			u.Records += size
+			u.RecordCount++
+
+			r, err := ReadRecord(file, v, offset, listElementSize)
+			if err != nil {
+				return nil, err
+			}
+
+			u.Slack += int64((r.List.Cap() - r.List.Len()) * listElementSize)
+
+		case compactRecordSection:
+			u.Records += size
+			u.RecordCount++
+
+		case listBucketSection:
+			u.ListBuckets += size
+			u.ListBucketCount++
+
+		case dataSection:
+			u.Data += size
+
+		default:
+			return nil, sectionTypeError(t)
+		}
+
+		offset += size
+	}
+}
@@ -0,0 +1,67 @@
+package disk
+
+import "testing"
+
+func TestFileUsage(t *testing.T) {
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	file.Write([]byte{'x'})
+
+	const (
+		elementSize = 8
+		bucketLen   = 4
+	)
+
+	value := []byte("value")
+	element := []byte("12345678")
+
+	// 6 elements: a full first bucket and half of a second bucket.
+	r, err := NewRecord(file, Version4, value, elementSize, bucketLen)
+	if err != nil {
+		t.Fatalf("NewRecord failed: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		r.List.Append(element)
+	}
+
+	err = r.Write()
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	cr, err := NewCompactRecord(file, Version4, value)
+	if err != nil {
+		t.Fatalf("NewCompactRecord failed: %v", err)
+	}
+
+	err = cr.SetData([]byte("data"))
+	if err != nil {
+		t.Fatalf("SetData failed: %v", err)
+	}
+
+	u, err := FileUsage(file, Version4, 1, elementSize)
+	if err != nil {
+		t.Fatalf("FileUsage failed: %v", err)
+	}
+
+	recordSize := int64(sectionHeaderLength + recordHeaderLength(Version4) + len(value))
+	expected := Usage{
+		Records:         recordSize + int64(ListBucketSize(elementSize, bucketLen)) + recordSize + offsetLength,
+		RecordCount:     2,
+		ListBuckets:     int64(sectionHeaderLength + ListBucketSize(elementSize, bucketLen)),
+		ListBucketCount: 1,
+		Data:            sectionHeaderLength + 4,
+		Slack:           2 * elementSize,
+	}
+
+	if *u != expected {
+		t.Errorf("got %+v\nwant %+v", *u, expected)
+	}
+
+	info, _ := file.Stat()
+	if total := 1 + u.Records + u.ListBuckets + u.Data; total != info.Size() {
+		t.Errorf("got total %d, want file size %d", total, info.Size())
+	}
+}
@@ -0,0 +1,463 @@
+package markov
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// EncodeJSON writes the chain to w as JSON. The chain is read one value at a
+// time, so it doesn't need to fit in memory.
+//
+// The output is an array of [state, {next: count}] pairs, the same layout as
+// markovify's Chain.to_json. For example:
+//
+//	[[["the"],{"cat":2,"dog":1}],[["cat"],{"sat":1}],...]
+//
+// Values are converted to JSON strings, numbers or booleans. Arrays (and
+// tuples) become JSON arrays. As in markovify, states are always arrays:
+// tuples of more than one value are written as they are, and other values are
+// wrapped in an array of one element. The next values are object keys, which
+// must be strings, so values other than strings are written as their JSON
+// encoding. Strings which happen to be valid JSON (e.g. "42") are quoted.
+// markovify's next values are single words, so a chain of strings written by
+// EncodeJSON can be loaded by markovify (though words that look like JSON
+// keep their quotes), but a chain of tuples can't.
+//
+// Counts are exact when the chain is a MemoryChain, ShardedChain or DiskChain.
+// For other chains they're scaled from the link probabilities.
+func EncodeJSON(w io.Writer, chain Chain) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('[')
+
+	walker := IterativeWalker(chain)
+	for first := true; ; first = false {
+		value, err := walker.Next()
+		if err != nil {
+			if err == ErrBrokenChain {
+				break
+			}
+			return err
+		}
+
+		if !first {
+			bw.WriteByte(',')
+		}
+
+		err = encodeJSONEntry(bw, chain, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+func encodeJSONEntry(w *bufio.Writer, chain Chain, value interface{}) error {
+	id, err := chain.Find(value)
+	if err != nil {
+		return err
+	}
+
+	links, err := linkCounts(chain, id)
+	if err != nil {
+		return err
+	}
+
+	state, err := jsonState(value)
+	if err != nil {
+		return err
+	}
+
+	w.WriteByte('[')
+	w.Write(state)
+	w.WriteString(",{")
+
+	for i, link := range links {
+		next, err := chain.Get(link.ID)
+		if err != nil {
+			return err
+		}
+
+		key, err := jsonKey(next)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.Write(key)
+		fmt.Fprintf(w, ":%d", link.Count)
+	}
+
+	w.WriteString("}]")
+	return nil
+}
+
+// jsonValue returns the JSON encoding of a chain value.
+func jsonValue(value interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Array {
+		return json.Marshal(value)
+	}
+
+	elems := make([]json.RawMessage, rv.Len())
+	for i := range elems {
+		var err error
+		elems[i], err = jsonValue(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(elems)
+}
+
+// jsonState returns the JSON encoding of a value as a state, which is always
+// an array. See EncodeJSON.
+func jsonState(value interface{}) ([]byte, error) {
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Array && rv.Len() > 1 {
+		return jsonValue(value)
+	}
+
+	buf, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{'['}, buf...), ']'), nil
+}
+
+// jsonKey returns the value as a JSON string for use as an object key.
+func jsonKey(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok && !json.Valid([]byte(s)) {
+		return json.Marshal(s)
+	}
+
+	buf, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(string(buf))
+}
+
+// DecodeJSON reads a chain in the format written by EncodeJSON and writes it
+// to the WriteChain. The input is read one entry at a time, so it doesn't
+// need to fit in memory.
+//
+// JSON doesn't preserve Go types. Strings and booleans are decoded as string
+// and bool, whole numbers as int and other numbers as float64. Arrays are
+// decoded as tuples (see Tuple), except that a state with one element is
+// decoded as that element, so ["the"] is "the" and [["a"]] is Tuple("a"). A
+// state that isn't an array is decoded as it is. Object keys are decoded the
+// same way as values if they're valid JSON, so "42" is the number 42. To read
+// a markovify model, where every word is a string, use DecodeMarkovifyJSON.
+func DecodeJSON(r io.Reader, wc WriteChain) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	err := expectDelim(dec, '[')
+	if err != nil {
+		return err
+	}
+
+	for dec.More() {
+		var entry []json.RawMessage
+		err = dec.Decode(&entry)
+		if err != nil {
+			return err
+		}
+
+		if len(entry) != 2 {
+			return errors.New("markov: JSON entries must be [state, {next: count}] pairs")
+		}
+
+		err = decodeJSONEntry(wc, entry[0], entry[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func decodeJSONEntry(wc WriteChain, rawState, rawNext json.RawMessage) error {
+	state, err := decodeJSONState(rawState)
+	if err != nil {
+		return err
+	}
+
+	parent, err := wc.Add(state)
+	if err != nil {
+		return err
+	}
+
+	// Use the tokenizer to keep the links in order.
+	dec := json.NewDecoder(bytes.NewReader(rawNext))
+	dec.UseNumber()
+
+	err = expectDelim(dec, '{')
+	if err != nil {
+		return err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		next, err := decodeJSONKey(token.(string))
+		if err != nil {
+			return err
+		}
+
+		var count int
+		err = dec.Decode(&count)
+		if err != nil {
+			return err
+		}
+
+		child, err := wc.Add(next)
+		if err != nil {
+			return err
+		}
+
+		err = wc.Relate(parent, child, count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DecodeMarkovifyJSON reads a chain written by markovify (either
+// Chain.to_json or Text.to_json) and writes it to the WriteChain.
+//
+// markovify states are arrays of words, and each links to the next word.
+// Words are always strings, even if they look like numbers. If the state size
+// is 1, states are stored as strings and linked to the next word. Otherwise
+// they're stored as tuples (see Tuple), and each state is linked to the state
+// that follows it: the same words, without the first, followed by the next
+// word. That's the same as a chain built from N-grams, so it can be walked.
+//
+// Chain.to_json output is read one entry at a time. Text.to_json output holds
+// the chain in a string, so it's read into memory.
+func DecodeMarkovifyJSON(r io.Reader, wc WriteChain) error {
+	br := bufio.NewReader(r)
+
+	start, err := firstNonSpace(br)
+	if err != nil {
+		return err
+	}
+
+	if start == '{' {
+		var text struct {
+			Chain string `json:"chain"`
+		}
+
+		err = json.NewDecoder(br).Decode(&text)
+		if err != nil {
+			return err
+		}
+
+		br = bufio.NewReader(strings.NewReader(text.Chain))
+	}
+
+	dec := json.NewDecoder(br)
+
+	err = expectDelim(dec, '[')
+	if err != nil {
+		return err
+	}
+
+	for dec.More() {
+		var entry []json.RawMessage
+		err = dec.Decode(&entry)
+		if err != nil {
+			return err
+		}
+
+		if len(entry) != 2 {
+			return errors.New("markov: markovify entries must be [state, {next: count}] pairs")
+		}
+
+		var state []string
+		err = json.Unmarshal(entry[0], &state)
+		if err != nil || len(state) == 0 {
+			return errors.New("markov: markovify states must be arrays of strings")
+		}
+
+		err = decodeMarkovifyEntry(wc, state, entry[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func decodeMarkovifyEntry(wc WriteChain, state []string, rawNext json.RawMessage) error {
+	parent, err := wc.Add(markovifyState(state))
+	if err != nil {
+		return err
+	}
+
+	// Use the tokenizer to keep the links in order.
+	dec := json.NewDecoder(bytes.NewReader(rawNext))
+
+	err = expectDelim(dec, '{')
+	if err != nil {
+		return err
+	}
+
+	next := make([]string, len(state))
+	copy(next, state[1:])
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var count int
+		err = dec.Decode(&count)
+		if err != nil {
+			return err
+		}
+
+		next[len(next)-1] = token.(string)
+
+		child, err := wc.Add(markovifyState(next))
+		if err != nil {
+			return err
+		}
+
+		err = wc.Relate(parent, child, count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markovifyState returns the chain value for a markovify state.
+func markovifyState(words []string) interface{} {
+	if len(words) == 1 {
+		return words[0]
+	}
+
+	values := make([]interface{}, len(words))
+	for i, w := range words {
+		values[i] = w
+	}
+
+	return Tuple(values...)
+}
+
+// firstNonSpace returns the first byte in r that isn't white space, without
+// consuming it.
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+
+		return b, r.UnreadByte()
+	}
+}
+
+func decodeJSONKey(key string) (interface{}, error) {
+	if !json.Valid([]byte(key)) {
+		return key, nil
+	}
+
+	return decodeJSONValue([]byte(key))
+}
+
+func decodeJSONValue(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var raw interface{}
+	err := dec.Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromJSON(raw)
+}
+
+// decodeJSONState decodes a state written by jsonState.
+func decodeJSONState(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var raw interface{}
+	err := dec.Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if elems, ok := raw.([]interface{}); ok && len(elems) == 1 {
+		return fromJSON(elems[0])
+	}
+
+	return fromJSON(raw)
+}
+
+func fromJSON(raw interface{}) (interface{}, error) {
+	switch v := raw.(type) {
+	case string, bool:
+		return v, nil
+
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i), nil
+		}
+		return v.Float64()
+
+	case []interface{}:
+		elems := make([]interface{}, len(v))
+		for i := range v {
+			var err error
+			elems[i], err = fromJSON(v[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return Tuple(elems...), nil
+
+	default:
+		return nil, fmt.Errorf("markov: unsupported JSON value: %v", raw)
+	}
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("markov: got %v in JSON, want %v", token, delim)
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package markov
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	values := []interface{}{
+		"the", "cat", "42", "true", "", 42, 1.5, true,
+		Tuple("a", "b"), Tuple("a", 1, Tuple("c")), Tuple("c"), Tuple(Tuple("a", "b")),
+		"the", "42", 42, "cat", Tuple("a", "b"), "the",
+	}
+
+	src := NewMemoryChain(0)
+	err := Feed(src, sliceChannel(values))
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = EncodeJSON(&buf, src)
+	if err != nil {
+		t.Fatalf("EncodeJSON failed: %v", err)
+	}
+
+	dest := NewMemoryChain(0)
+	err = DecodeJSON(&buf, dest)
+	if err != nil {
+		t.Fatalf("DecodeJSON failed: %v", err)
+	}
+
+	if len(dest.values) != len(src.values) {
+		t.Fatalf("got %d values, want %d", len(dest.values), len(src.values))
+	}
+
+	for srcID, value := range src.values {
+		destID, err := dest.Find(value)
+		if err != nil {
+			t.Fatalf("%v: got error %v", value, err)
+		}
+
+		want := src.links[srcID]
+		got := dest.links[destID]
+
+		if len(got) != len(want) {
+			t.Fatalf("%v: got %d links, want %d", value, len(got), len(want))
+		}
+
+		for i := range want {
+			wantValue := src.values[want[i].ID]
+			gotValue := dest.values[got[i].ID]
+
+			if gotValue != wantValue || got[i].Count != want[i].Count {
+				t.Errorf("%v: got link to %v (%d), want %v (%d)", value, gotValue, got[i].Count, wantValue, want[i].Count)
+			}
+		}
+	}
+}
+
+func TestEncodeJSONMarkovify(t *testing.T) {
+	model, err := os.ReadFile("testdata/markovify-state1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := NewMemoryChain(0)
+	err = DecodeMarkovifyJSON(bytes.NewReader(model), chain)
+	if err != nil {
+		t.Fatalf("DecodeMarkovifyJSON failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = EncodeJSON(&buf, chain)
+	if err != nil {
+		t.Fatalf("EncodeJSON failed: %v", err)
+	}
+
+	// markovify reads each state as a list of words.
+	want := readMarkovify(t, model)
+	got := readMarkovify(t, buf.Bytes())
+
+	// ___END__ is a value in the chain, with no links, but not a state in
+	// markovify.
+	if len(got["___END__"]) != 0 {
+		t.Errorf("got links from ___END__: %v", got["___END__"])
+	}
+	delete(got, "___END__")
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The output reads back as the same chain either way.
+	for name, decode := range map[string]func(io.Reader, WriteChain) error{
+		"DecodeJSON":          DecodeJSON,
+		"DecodeMarkovifyJSON": DecodeMarkovifyJSON,
+	} {
+		dest := NewMemoryChain(0)
+		err = decode(bytes.NewReader(buf.Bytes()), dest)
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+
+		if len(dest.values) != len(chain.values) {
+			t.Errorf("%s: got %d values, want %d", name, len(dest.values), len(chain.values))
+		}
+		assertSameLinks(t, dest, chain)
+	}
+}
+
+// readMarkovify reads markovify JSON as markovify does, with each state as a
+// list of words. It returns the next words and counts for each state, with
+// the words in the state joined by spaces.
+func readMarkovify(t *testing.T, buf []byte) map[string]map[string]int {
+	t.Helper()
+
+	var entries [][2]json.RawMessage
+	err := json.Unmarshal(buf, &entries)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	model := map[string]map[string]int{}
+	for _, entry := range entries {
+		var state []string
+		err = json.Unmarshal(entry[0], &state)
+		if err != nil {
+			t.Fatalf("state %s isn't a list of words: %v", entry[0], err)
+		}
+
+		var next map[string]int
+		err = json.Unmarshal(entry[1], &next)
+		if err != nil {
+			t.Fatalf("next %s isn't a map of words: %v", entry[1], err)
+		}
+
+		model[strings.Join(state, " ")] = next
+	}
+
+	return model
+}
+
+func TestDecodeMarkovifyJSON(t *testing.T) {
+	model, err := os.ReadFile("testdata/markovify.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Text.to_json wraps the chain's JSON in a string.
+	text, _ := json.Marshal(map[string]interface{}{
+		"state_size": 2,
+		"chain":      string(model),
+	})
+
+	inputs := map[string][]byte{
+		"Chain.to_json": model,
+		"Text.to_json":  text,
+	}
+
+	for name, input := range inputs {
+		chain := NewMemoryChain(0)
+		err = DecodeMarkovifyJSON(bytes.NewReader(input), chain)
+		if err != nil {
+			t.Fatalf("%s: DecodeMarkovifyJSON failed: %v", name, err)
+		}
+
+		// Words that look like JSON are still strings.
+		for _, state := range []interface{}{Tuple("In", "1984"), Tuple("is", "true"), Tuple("was", "42")} {
+			_, err := chain.Find(state)
+			if err != nil {
+				t.Errorf("%s: Find(%v): %v", name, state, err)
+			}
+		}
+
+		_, err = chain.Find(Tuple("In", 1984))
+		if err != ErrNotFound {
+			t.Errorf("%s: got error %v for a numeric word, want %v", name, err, ErrNotFound)
+		}
+
+		start, err := chain.Find(Tuple("___BEGIN__", "___BEGIN__"))
+		if err != nil {
+			t.Fatalf("%s: got error: %v", name, err)
+		}
+
+		sentences := markovifySentences(t, chain, start, nil)
+		sort.Strings(sentences)
+
+		expected := []string{"In 1984 it rained", "It was 42", "That is true"}
+		if !reflect.DeepEqual(sentences, expected) {
+			t.Errorf("%s: got sentences %q, want %q", name, sentences, expected)
+		}
+	}
+
+	// With a state size of 1, states are strings.
+	chain := NewMemoryChain(0)
+	err = DecodeMarkovifyJSON(strings.NewReader(`[[["a"], {"1": 2}]]`), chain)
+	if err != nil {
+		t.Fatalf("DecodeMarkovifyJSON failed: %v", err)
+	}
+
+	id, err := chain.Find("a")
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	counts, _ := chain.linkCounts(id)
+	if len(counts) != 1 || chain.values[counts[0].ID] != "1" || counts[0].Count != 2 {
+		t.Errorf("got links %v, want a link to \"1\" (2)", counts)
+	}
+
+	for _, input := range []string{`[["a"]]`, `[[[1, 2], {}]]`, `[[[], {}]]`} {
+		err = DecodeMarkovifyJSON(strings.NewReader(input), NewMemoryChain(0))
+		if err == nil {
+			t.Errorf("got nil error for %s", input)
+		}
+	}
+}
+
+// markovifySentences follows every path from a markovify state to the end,
+// and returns the words on each path.
+func markovifySentences(t *testing.T, chain Chain, id int, words []string) []string {
+	links, err := chain.Links(id)
+	if err != nil {
+		t.Fatalf("Links failed: %v", err)
+	}
+
+	var sentences []string
+	for _, link := range links {
+		value, err := chain.Get(link.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+
+		word := reflect.ValueOf(value).Index(1).Interface().(string)
+		if word == "___END__" {
+			sentences = append(sentences, strings.Join(words, " "))
+			continue
+		}
+
+		path := append(append([]string(nil), words...), word)
+		sentences = append(sentences, markovifySentences(t, chain, link.ID, path)...)
+	}
+
+	return sentences
+}
+
+func sliceChannel(values []interface{}) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for _, v := range values {
+			ch <- v
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,75 @@
+package markov
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var errCorruptLinks = errors.New("markov: corrupt link data")
+
+// encodeLinks packs links into a compact variable-length encoding.
+//
+// The links are sorted by ID. The encoded form is the number of links
+// followed by the difference between each ID and the previous ID and the
+// link's count. Each number is an unsigned varint, so most counts take a
+// single byte.
+func encodeLinks(links linkCountSlice) []byte {
+	sorted := make(linkCountSlice, len(links))
+	copy(sorted, links)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	buf := make([]byte, binary.MaxVarintLen64*(1+len(sorted)*2))
+	n := binary.PutUvarint(buf, uint64(len(sorted)))
+
+	last := 0
+	for _, link := range sorted {
+		n += binary.PutUvarint(buf[n:], uint64(link.ID-last))
+		n += binary.PutUvarint(buf[n:], uint64(link.Count))
+		last = link.ID
+	}
+
+	return buf[:n]
+}
+
+// decodeLinks unpacks links encoded by encodeLinks.
+func decodeLinks(buf []byte) (linkCountSlice, error) {
+	if len(buf) == 0 {
+		return linkCountSlice{}, nil
+	}
+
+	length, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, errCorruptLinks
+	}
+	buf = buf[n:]
+
+	// Each link takes at least two bytes.
+	if length > uint64(len(buf)/2) {
+		return nil, errCorruptLinks
+	}
+
+	links := make(linkCountSlice, length)
+
+	last := 0
+	for i := range links {
+		delta, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errCorruptLinks
+		}
+		buf = buf[n:]
+
+		count, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errCorruptLinks
+		}
+		buf = buf[n:]
+
+		last += int(delta)
+		links[i] = linkCount{ID: last, Count: int(count)}
+	}
+
+	return links, nil
+}
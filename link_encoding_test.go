@@ -0,0 +1,47 @@
+package markov
+
+import "testing"
+
+func TestEncodeLinks(t *testing.T) {
+	cases := []linkCountSlice{
+		{},
+		{{ID: 4, Count: 1}},
+		{{ID: 1 << 40, Count: 1 << 50}, {ID: 7, Count: 127}, {ID: 8, Count: 128}},
+	}
+
+	for _, links := range cases {
+		buf := encodeLinks(links)
+
+		actual, err := decodeLinks(buf)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+
+		if len(actual) != len(links) {
+			t.Fatalf("got %d links, want %d", len(actual), len(links))
+		}
+
+		for _, want := range links {
+			i := actual.Find(want.ID)
+			if i < 0 {
+				t.Errorf("link %d is missing", want.ID)
+				continue
+			}
+
+			if actual[i].Count != want.Count {
+				t.Errorf("link %d: got count %d, want %d", want.ID, actual[i].Count, want.Count)
+			}
+		}
+
+		for i := 1; i < len(actual); i++ {
+			if actual[i].ID < actual[i-1].ID {
+				t.Errorf("links are not sorted: %v", actual)
+			}
+		}
+	}
+
+	_, err := decodeLinks([]byte{5, 1})
+	if err == nil {
+		t.Error("got nil error for corrupt links")
+	}
+}
@@ -8,6 +8,23 @@ var (
 
 	// ErrBrokenChain is returned when the chain ends.
 	ErrBrokenChain error = errors.New("markov: broken chain")
+
+	// ErrCountOverflow is returned by Relate when a link count is too
+	// large to be stored.
+	ErrCountOverflow error = errors.New("markov: link count overflow")
+
+	// ErrReadOnly is returned when writing to part of a chain that can't be
+	// updated.
+	ErrReadOnly error = errors.New("markov: read-only")
+
+	// ErrLocked is returned when opening a chain file without waiting
+	// fails because another process is using it.
+	ErrLocked error = errors.New("markov: chain file is locked by another process")
+
+	// ErrNotComparable is returned when adding or finding a value that
+	// can't be compared with ==, such as a []byte. Chains index values by
+	// comparing them, so store bytes as a string or an array instead.
+	ErrNotComparable error = errors.New("markov: value is not comparable (use a string or array instead of a slice)")
 )
 
 // Chain is a read-only Markov chain.
@@ -48,3 +65,30 @@ type Link struct {
 	ID          int
 	Probability float64
 }
+
+// LinkCount describes a child item by the number of times it followed the
+// parent.
+type LinkCount struct {
+	ID    int
+	Count int
+}
+
+// LinkCounts returns the items linked to the given item, with the number of
+// times each occurred.
+//
+// Counts are exact for MemoryChain, ShardedChain, DiskChain and
+// DiskChainWriter. Other chains only provide probabilities, so the counts are
+// scaled from them.
+func LinkCounts(chain Chain, id int) ([]LinkCount, error) {
+	lcs, err := linkCounts(chain, id)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]LinkCount, len(lcs))
+	for i, lc := range lcs {
+		counts[i] = LinkCount(lc)
+	}
+
+	return counts, nil
+}
@@ -75,6 +75,31 @@ func testReadChain(t *testing.T, chain Chain) {
 	}
 }
 
+func TestLinkCounts(t *testing.T) {
+	chain := NewMemoryChain(0)
+	Feed(chain, sliceChannel([]interface{}{"a", "b", "a", "b", "a", "c"}))
+
+	aID, _ := chain.Find("a")
+	bID, _ := chain.Find("b")
+	cID, _ := chain.Find("c")
+
+	counts, err := LinkCounts(chain, aID)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	expected := []LinkCount{{ID: bID, Count: 2}, {ID: cID, Count: 1}}
+	if len(counts) != len(expected) {
+		t.Fatalf("got %v, want %v", counts, expected)
+	}
+
+	for i := range expected {
+		if counts[i] != expected[i] {
+			t.Errorf("got %v, want %v", counts[i], expected[i])
+		}
+	}
+}
+
 func split(text string) <-chan interface{} {
 	runes := make(chan interface{})
 
@@ -0,0 +1,183 @@
+package markov
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// MatrixValues selects the values stored in a Matrix.
+type MatrixValues int
+
+const (
+	// Probabilities stores the probability of each transition. Each row
+	// sums to 1 (or 0 for values without links).
+	Probabilities MatrixValues = iota
+
+	// Counts stores the number of times each transition occurred.
+	Counts
+)
+
+// Matrix is a transition matrix in compressed sparse row (CSR) format. Row i,
+// column j is the transition from the value with ID IDs[i] to the value with
+// ID IDs[j].
+type Matrix struct {
+	// IDs maps row and column indices to chain IDs.
+	IDs []int
+
+	// RowPtr holds the start of each row in ColIndex and Values. Row i is
+	// ColIndex[RowPtr[i]:RowPtr[i+1]]. len(RowPtr) is len(IDs)+1.
+	RowPtr []int
+
+	// ColIndex holds the column of each non-zero entry. Columns are sorted
+	// within each row.
+	ColIndex []int
+
+	// Values holds each non-zero entry.
+	Values []float64
+
+	// Kind describes Values.
+	Kind MatrixValues
+
+	index map[int]int
+}
+
+// TransitionMatrix builds a sparse transition matrix from the chain. Values
+// are indexed in the order IterativeWalker returns them.
+func TransitionMatrix(chain Chain, kind MatrixValues) (*Matrix, error) {
+	m := &Matrix{
+		Kind:  kind,
+		index: map[int]int{},
+	}
+
+	walker := IterativeWalker(chain)
+	for {
+		value, err := walker.Next()
+		if err != nil {
+			if err == ErrBrokenChain {
+				break
+			}
+			return nil, err
+		}
+
+		id, err := chain.Find(value)
+		if err != nil {
+			return nil, err
+		}
+
+		m.index[id] = len(m.IDs)
+		m.IDs = append(m.IDs, id)
+	}
+
+	m.RowPtr = make([]int, 1, len(m.IDs)+1)
+
+	for _, id := range m.IDs {
+		links, err := linkCounts(chain, id)
+		if err != nil {
+			return nil, err
+		}
+
+		total := links.sum()
+		row := make([]matrixEntry, len(links))
+
+		for i, link := range links {
+			col, ok := m.index[link.ID]
+			if !ok {
+				return nil, fmt.Errorf("markov: link to unknown ID %d", link.ID)
+			}
+
+			row[i].col = col
+			row[i].value = float64(link.Count)
+			if kind == Probabilities {
+				row[i].value /= total
+			}
+		}
+
+		sort.Slice(row, func(i, j int) bool {
+			return row[i].col < row[j].col
+		})
+
+		for _, e := range row {
+			m.ColIndex = append(m.ColIndex, e.col)
+			m.Values = append(m.Values, e.value)
+		}
+
+		m.RowPtr = append(m.RowPtr, len(m.ColIndex))
+	}
+
+	return m, nil
+}
+
+type matrixEntry struct {
+	col   int
+	value float64
+}
+
+// Len returns the number of rows (and columns) in the matrix.
+func (m *Matrix) Len() int {
+	return len(m.IDs)
+}
+
+// Index returns the row and column index of a chain ID. It returns false if
+// the ID isn't in the matrix.
+func (m *Matrix) Index(id int) (int, bool) {
+	i, ok := m.index[id]
+	return i, ok
+}
+
+// At returns the value at row i, column j.
+func (m *Matrix) At(i, j int) float64 {
+	start, end := m.RowPtr[i], m.RowPtr[i+1]
+	cols := m.ColIndex[start:end]
+
+	k := sort.SearchInts(cols, j)
+	if k < len(cols) && cols[k] == j {
+		return m.Values[start+k]
+	}
+
+	return 0
+}
+
+// Dense returns the matrix as a slice of rows. It allocates Len()² values, so
+// it's only suitable for small chains.
+func (m *Matrix) Dense() [][]float64 {
+	n := m.Len()
+	backing := make([]float64, n*n)
+	rows := make([][]float64, n)
+
+	for i := range rows {
+		rows[i] = backing[i*n : (i+1)*n]
+		for k := m.RowPtr[i]; k < m.RowPtr[i+1]; k++ {
+			rows[i][m.ColIndex[k]] = m.Values[k]
+		}
+	}
+
+	return rows
+}
+
+// WriteMatrixMarket writes the matrix to w in Matrix Market coordinate
+// format. Indices in the file start at 1, so row i in the file is the chain
+// ID IDs[i-1].
+func (m *Matrix) WriteMatrixMarket(w io.Writer) error {
+	field := "real"
+	if m.Kind == Counts {
+		field = "integer"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%%%%MatrixMarket matrix coordinate %s general\n", field)
+	fmt.Fprintf(bw, "%d %d %d\n", m.Len(), m.Len(), len(m.Values))
+
+	for i := 0; i < m.Len(); i++ {
+		for k := m.RowPtr[i]; k < m.RowPtr[i+1]; k++ {
+			_, err := fmt.Fprintf(bw, "%d %d %s\n", i+1, m.ColIndex[k]+1, strconv.FormatFloat(m.Values[k], 'g', -1, 64))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
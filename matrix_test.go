@@ -0,0 +1,68 @@
+package markov
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTransitionMatrix(t *testing.T) {
+	chain := graphTestChain(t)
+
+	m, err := TransitionMatrix(chain, Probabilities)
+	if err != nil {
+		t.Fatalf("TransitionMatrix failed: %v", err)
+	}
+
+	expected := [][]float64{
+		{0, 0.25, 0.75, 0},
+		{1, 0, 0, 0},
+		{2.0 / 3, 0, 0, 1.0 / 3},
+		{0, 0, 0, 0},
+	}
+
+	if m.Len() != len(expected) {
+		t.Fatalf("got %d rows, want %d", m.Len(), len(expected))
+	}
+
+	dense := m.Dense()
+	for i := range expected {
+		for j := range expected[i] {
+			if m.At(i, j) != expected[i][j] {
+				t.Errorf("At(%d, %d): got %v, want %v", i, j, m.At(i, j), expected[i][j])
+			}
+
+			if dense[i][j] != expected[i][j] {
+				t.Errorf("Dense()[%d][%d]: got %v, want %v", i, j, dense[i][j], expected[i][j])
+			}
+		}
+	}
+
+	cID, _ := chain.Find("c")
+	i, ok := m.Index(cID)
+	if !ok || m.IDs[i] != cID {
+		t.Errorf("got index %d, %v for ID %d", i, ok, cID)
+	}
+
+	counts, err := TransitionMatrix(chain, Counts)
+	if err != nil {
+		t.Fatalf("TransitionMatrix failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = counts.WriteMatrixMarket(&buf)
+	if err != nil {
+		t.Fatalf("WriteMatrixMarket failed: %v", err)
+	}
+
+	expectedMM := `%%MatrixMarket matrix coordinate integer general
+4 4 5
+1 2 1
+1 3 3
+2 1 1
+3 1 2
+3 4 1
+`
+	if buf.String() != expectedMM {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expectedMM)
+	}
+}
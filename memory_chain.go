@@ -8,6 +8,9 @@ import (
 var _ Chain = &MemoryChain{}
 
 // MemoryChain is a ReadWriteChain kept in memory.
+//
+// It's safe to use a MemoryChain from multiple goroutines. Writes are
+// serialized, see ShardedChain for a chain that can be written concurrently.
 type MemoryChain struct {
 	mu         sync.RWMutex
 	valueIndex map[interface{}]int
@@ -32,7 +35,7 @@ func (c *MemoryChain) Get(id int) (interface{}, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if id >= len(c.values) {
+	if id < 0 || id >= len(c.values) {
 		return nil, nil
 	}
 
@@ -46,7 +49,7 @@ func (c *MemoryChain) Links(id int) ([]Link, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if id >= len(c.links) {
+	if id < 0 || id >= len(c.links) {
 		return nil, ErrNotFound
 	}
 
@@ -57,6 +60,11 @@ func (c *MemoryChain) Links(id int) ([]Link, error) {
 //
 // Returns ErrNotFound if the value doesn't exist.
 func (c *MemoryChain) Find(value interface{}) (int, error) {
+	err := checkComparable(value)
+	if err != nil {
+		return 0, err
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -77,10 +85,19 @@ func (c *MemoryChain) Add(value interface{}) (int, error) {
 	if err == nil {
 		return existing, nil
 	}
+	if err == ErrNotComparable {
+		return 0, err
+	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// Another goroutine may have added the value since Find released the
+	// lock.
+	if existing, ok := c.valueIndex[value]; ok {
+		return existing, nil
+	}
+
 	c.values = append(c.values, value)
 	c.links = append(c.links, make(linkCountSlice, 0, 1))
 
@@ -95,7 +112,16 @@ func (c *MemoryChain) Add(value interface{}) (int, error) {
 }
 
 // Relate increases the number of times child occurs after parent.
+//
+// Returns ErrNotFound if the parent doesn't exist.
 func (c *MemoryChain) Relate(parent, child int, delta int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if parent < 0 || parent >= len(c.links) {
+		return ErrNotFound
+	}
+
 	childIndex := c.links[parent].Find(child)
 	if childIndex < 0 {
 		c.links[parent] = append(c.links[parent], linkCount{ID: child})
@@ -134,7 +160,12 @@ func (c *MemoryChain) linkCounts(id int) (linkCountSlice, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	return c.links[id], nil
+	if id < 0 || id >= len(c.links) {
+		return nil, ErrNotFound
+	}
+
+	// Relate updates counts in place, so the caller needs a copy.
+	return append(linkCountSlice(nil), c.links[id]...), nil
 }
 
 type linkCount struct {
@@ -142,19 +173,21 @@ type linkCount struct {
 	Count int
 }
 
-func (l *linkCount) Link(total int) Link {
+func (l *linkCount) Link(total float64) Link {
 	return Link{
 		ID:          l.ID,
-		Probability: float64(l.Count) / float64(total),
+		Probability: float64(l.Count) / total,
 	}
 }
 
 type linkCountSlice []linkCount
 
-func (ls linkCountSlice) sum() int {
-	total := 0
+// sum returns the total of all counts. It's a float64 because the sum of
+// large counts can overflow an int.
+func (ls linkCountSlice) sum() float64 {
+	var total float64
 	for _, l := range ls {
-		total += l.Count
+		total += float64(l.Count)
 	}
 	return total
 }
@@ -0,0 +1,265 @@
+package markov
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A MemoryChain snapshot is:
+//
+//	magic        4 bytes ("MKM" and a version number)
+//	value count  uvarint
+//	values       uvarint length followed by the encoded value, for each value
+//	links        for each value, the number of links (uvarint), then the
+//	             ID (uvarint) and count (varint) of each link
+const memorySnapshotMagic = "MKM\u0001"
+
+var errInvalidSnapshot = errors.New("markov: invalid snapshot")
+
+// WriteTo writes a binary snapshot of the chain to w. The snapshot includes
+// every value, link and count, and preserves the IDs. Values must be types
+// supported by DiskChainWriter.
+//
+// WriteTo satisfies the io.WriterTo interface.
+func (c *MemoryChain) WriteTo(w io.Writer) (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sw := &snapshotWriter{w: bufio.NewWriter(w)}
+
+	sw.write([]byte(memorySnapshotMagic))
+	sw.writeUvarint(uint64(len(c.values)))
+
+	for _, value := range c.values {
+		buf, err := marshalValue(value)
+		if err != nil {
+			return sw.n, err
+		}
+
+		sw.writeUvarint(uint64(len(buf)))
+		sw.write(buf)
+	}
+
+	for _, links := range c.links {
+		sw.writeUvarint(uint64(len(links)))
+		for _, link := range links {
+			sw.writeUvarint(uint64(link.ID))
+			sw.writeVarint(int64(link.Count))
+		}
+	}
+
+	if sw.err != nil {
+		return sw.n, sw.err
+	}
+
+	return sw.n, sw.w.Flush()
+}
+
+// ReadFrom replaces the contents of the chain with a snapshot written by
+// WriteTo.
+//
+// ReadFrom satisfies the io.ReaderFrom interface. It may read past the end of
+// the snapshot if r doesn't implement io.ByteReader.
+func (c *MemoryChain) ReadFrom(r io.Reader) (int64, error) {
+	sr := &snapshotReader{}
+	if br, ok := r.(byteReader); ok {
+		sr.r = br
+	} else {
+		sr.r = bufio.NewReader(r)
+	}
+
+	magic := make([]byte, len(memorySnapshotMagic))
+	_, err := io.ReadFull(sr, magic)
+	if err != nil {
+		return sr.n, err
+	}
+
+	if !bytes.Equal(magic, []byte(memorySnapshotMagic)) {
+		return sr.n, errInvalidSnapshot
+	}
+
+	length, err := sr.readUvarint()
+	if err != nil {
+		return sr.n, err
+	}
+
+	// Don't trust the length too much when allocating.
+	capacity := int(length)
+	if capacity > 1<<16 {
+		capacity = 1 << 16
+	}
+
+	valueIndex := make(map[interface{}]int, capacity)
+	values := make([]interface{}, 0, capacity)
+	links := make([]linkCountSlice, 0, capacity)
+
+	for i := uint64(0); i < length; i++ {
+		buf, err := sr.readBytes()
+		if err != nil {
+			return sr.n, err
+		}
+
+		value, err := unmarshalValue(buf)
+		if err != nil {
+			return sr.n, err
+		}
+
+		if _, ok := valueIndex[value]; ok {
+			return sr.n, fmt.Errorf("markov: duplicate value in snapshot: %v", value)
+		}
+
+		valueIndex[value] = len(values)
+		values = append(values, value)
+	}
+
+	for i := uint64(0); i < length; i++ {
+		linkLen, err := sr.readUvarint()
+		if err != nil {
+			return sr.n, err
+		}
+
+		if linkLen > length {
+			return sr.n, errInvalidSnapshot
+		}
+
+		lcs := make(linkCountSlice, linkLen)
+		for j := range lcs {
+			id, err := sr.readUvarint()
+			if err != nil {
+				return sr.n, err
+			}
+
+			if id >= length {
+				return sr.n, errInvalidSnapshot
+			}
+
+			count, err := sr.readVarint()
+			if err != nil {
+				return sr.n, err
+			}
+
+			lcs[j] = linkCount{ID: int(id), Count: int(count)}
+		}
+
+		links = append(links, lcs)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.valueIndex = valueIndex
+	c.values = values
+	c.links = links
+
+	return sr.n, nil
+}
+
+// MarshalBinary returns a snapshot of the chain. See WriteTo.
+//
+// MarshalBinary satisfies the encoding.BinaryMarshaler interface, which also
+// allows a MemoryChain to be encoded with encoding/gob.
+func (c *MemoryChain) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := c.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary replaces the contents of the chain with a snapshot. See
+// ReadFrom.
+//
+// UnmarshalBinary satisfies the encoding.BinaryUnmarshaler interface.
+func (c *MemoryChain) UnmarshalBinary(data []byte) error {
+	_, err := c.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (sw *snapshotWriter) write(buf []byte) {
+	if sw.err != nil {
+		return
+	}
+
+	var n int
+	n, sw.err = sw.w.Write(buf)
+	sw.n += int64(n)
+}
+
+func (sw *snapshotWriter) writeUvarint(x uint64) {
+	n := binary.PutUvarint(sw.buf[:], x)
+	sw.write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) writeVarint(x int64) {
+	n := binary.PutVarint(sw.buf[:], x)
+	sw.write(sw.buf[:n])
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// snapshotReader counts the bytes read from r.
+type snapshotReader struct {
+	r byteReader
+	n int64
+}
+
+func (sr *snapshotReader) Read(buf []byte) (int, error) {
+	n, err := sr.r.Read(buf)
+	sr.n += int64(n)
+	return n, err
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.n++
+	}
+	return b, err
+}
+
+func (sr *snapshotReader) readUvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(sr)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return x, err
+}
+
+func (sr *snapshotReader) readVarint() (int64, error) {
+	x, err := binary.ReadVarint(sr)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return x, err
+}
+
+func (sr *snapshotReader) readBytes() ([]byte, error) {
+	length, err := sr.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	// Values are limited by the size of a disk record.
+	if length > 1<<24 {
+		return nil, errInvalidSnapshot
+	}
+
+	buf := make([]byte, length)
+	_, err = io.ReadFull(sr, buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
@@ -0,0 +1,89 @@
+package markov
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryChainSnapshot(t *testing.T) {
+	src := &MemoryChain{}
+	testWriteChain(t, src)
+	src.Add(Tuple("a", 1))
+
+	var buf bytes.Buffer
+	n, err := src.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+
+	size := buf.Len()
+
+	dest := NewMemoryChain(0)
+	n, err = dest.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+
+	if n != int64(size) {
+		t.Errorf("ReadFrom returned %d, want %d", n, size)
+	}
+
+	testReadChain(t, dest)
+	assertSameMemoryChain(t, dest, src)
+
+	_, err = dest.ReadFrom(bytes.NewReader([]byte("MKV\u0004")))
+	if err == nil {
+		t.Error("got nil error for an invalid snapshot")
+	}
+
+	data, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	_, err = NewMemoryChain(0).ReadFrom(bytes.NewReader(data[:len(data)-1]))
+	if err == nil {
+		t.Error("got nil error for a truncated snapshot")
+	}
+}
+
+func TestMemoryChainGob(t *testing.T) {
+	src := &MemoryChain{}
+	testWriteChain(t, src)
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(src)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var dest MemoryChain
+	err = gob.NewDecoder(&buf).Decode(&dest)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	assertSameMemoryChain(t, &dest, src)
+}
+
+func assertSameMemoryChain(t *testing.T, actual, expected *MemoryChain) {
+	t.Helper()
+
+	if !reflect.DeepEqual(actual.values, expected.values) {
+		t.Errorf("values differ")
+	}
+
+	if !reflect.DeepEqual(actual.links, expected.links) {
+		t.Errorf("links differ")
+	}
+
+	if !reflect.DeepEqual(actual.valueIndex, expected.valueIndex) {
+		t.Errorf("value index differs")
+	}
+}
@@ -5,3 +5,30 @@ import "testing"
 func TestMemoryChain(t *testing.T) {
 	testReadWriteChain(t, &MemoryChain{})
 }
+
+func TestMemoryChainConcurrent(t *testing.T) {
+	testConcurrentWrites(t, NewMemoryChain(0))
+}
+
+func TestMemoryChainNotFound(t *testing.T) {
+	chain := NewMemoryChain(0)
+
+	id, err := chain.Add("a")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	for _, bad := range []int{-1, id + 1} {
+		if _, err := chain.Links(bad); err != ErrNotFound {
+			t.Errorf("Links(%d): got %v, want %v", bad, err, ErrNotFound)
+		}
+
+		if err := chain.Relate(bad, id, 1); err != ErrNotFound {
+			t.Errorf("Relate(%d): got %v, want %v", bad, err, ErrNotFound)
+		}
+
+		if _, err := LinkCounts(chain, bad); err != ErrNotFound {
+			t.Errorf("LinkCounts(%d): got %v, want %v", bad, err, ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package markov
+
+// SamplerChain is optionally implemented by a Chain that keeps precomputed
+// Samplers. RandomWalker uses it when available.
+type SamplerChain interface {
+	// Sampler returns a Sampler for the items linked to id.
+	//
+	// Returns ErrNotFound if the ID doesn't exist.
+	Sampler(id int) (*Sampler, error)
+}
+
+// Sampler picks a linked item, weighted by it's probability, in constant
+// time. Building a Sampler takes time proportional to the number of links,
+// so it's faster than searching the links only when the same links are
+// sampled repeatedly.
+//
+// Samplers use Vose's alias method: each link has a slot with an equal
+// chance of being picked, and each slot holds the link's share of the
+// probability and an "alias" link that takes the rest.
+type Sampler struct {
+	ids   []int
+	prob  []float64
+	alias []int
+}
+
+// NewSampler returns a Sampler for links.
+func NewSampler(links []Link) *Sampler {
+	ids := make([]int, len(links))
+	weights := make([]float64, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+		weights[i] = link.Probability
+	}
+
+	return newSampler(ids, weights)
+}
+
+// countSampler returns a Sampler for links with counts.
+func countSampler(counts linkCountSlice) *Sampler {
+	ids := make([]int, len(counts))
+	weights := make([]float64, len(counts))
+	for i, count := range counts {
+		ids[i] = count.ID
+		weights[i] = float64(count.Count)
+	}
+
+	return newSampler(ids, weights)
+}
+
+// newSampler returns a Sampler that picks ids[i] with a probability
+// proportional to weights[i].
+func newSampler(ids []int, weights []float64) *Sampler {
+	n := len(weights)
+	s := &Sampler{
+		ids:   ids,
+		prob:  make([]float64, n),
+		alias: make([]int, n),
+	}
+
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+
+	if n == 0 || total <= 0 {
+		for i := range s.prob {
+			s.prob[i] = 1
+		}
+		return s
+	}
+
+	// Scale the weights so the average is 1, and split them into
+	// those that fit in a slot and those that are too big.
+	var small, large []int
+	scaled := make([]float64, n)
+	for i, w := range weights {
+		scaled[i] = w * float64(n) / total
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	// Fill each small slot with part of a large one.
+	for len(small) > 0 && len(large) > 0 {
+		l := small[len(small)-1]
+		small = small[:len(small)-1]
+		g := large[len(large)-1]
+		large = large[:len(large)-1]
+
+		s.prob[l] = scaled[l]
+		s.alias[l] = g
+
+		scaled[g] += scaled[l] - 1
+		if scaled[g] < 1 {
+			small = append(small, g)
+		} else {
+			large = append(large, g)
+		}
+	}
+
+	// Anything left over is 1, give or take rounding errors.
+	for _, i := range large {
+		s.prob[i] = 1
+	}
+	for _, i := range small {
+		s.prob[i] = 1
+	}
+
+	return s
+}
+
+// Len returns the number of links.
+func (s *Sampler) Len() int {
+	return len(s.ids)
+}
+
+// Sample returns the ID of a link. r must be a random number in [0, 1), e.g.
+// from rand.Float64.
+//
+// Sample panics if there are no links.
+func (s *Sampler) Sample(r float64) int {
+	n := len(s.ids)
+
+	// The integer part of r*n picks the slot and the fraction picks
+	// between the slot's link and it's alias.
+	x := r * float64(n)
+	i := int(x)
+	if i >= n {
+		i = n - 1
+	}
+
+	if x-float64(i) < s.prob[i] {
+		return s.ids[i]
+	}
+
+	return s.ids[s.alias[i]]
+}
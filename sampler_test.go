@@ -0,0 +1,120 @@
+package markov
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	cases := [][]Link{
+		{{ID: 7, Probability: 1}},
+		{{ID: 1, Probability: 0.5}, {ID: 2, Probability: 0.25}, {ID: 3, Probability: 0.25}},
+		{{ID: 1, Probability: 0.9}, {ID: 2, Probability: 0}, {ID: 3, Probability: 0.1}},
+		{{ID: 1, Probability: 0.01}, {ID: 2, Probability: 0.02}, {ID: 3, Probability: 0.03}, {ID: 4, Probability: 0.94}},
+	}
+
+	// Sampling at evenly spaced points gives each link a share of the
+	// points equal to it's probability.
+	const points = 100000
+
+	for _, links := range cases {
+		s := NewSampler(links)
+		if s.Len() != len(links) {
+			t.Errorf("%v: got len %d, want %d", links, s.Len(), len(links))
+		}
+
+		counts := map[int]int{}
+		for i := 0; i < points; i++ {
+			counts[s.Sample((float64(i)+0.5)/points)]++
+		}
+
+		for _, link := range links {
+			actual := float64(counts[link.ID]) / points
+			if math.Abs(actual-link.Probability) > 0.001 {
+				t.Errorf("%v: ID %d picked %0.4f of the time, want %0.4f", links, link.ID, actual, link.Probability)
+			}
+		}
+
+		if len(counts) > len(links) {
+			t.Errorf("%v: got IDs %v", links, counts)
+		}
+
+		// The ends of the range.
+		for _, r := range []float64{0, math.Nextafter(1, 0)} {
+			id := s.Sample(r)
+			if counts[id] == 0 {
+				t.Errorf("%v: Sample(%v) returned %d", links, r, id)
+			}
+		}
+	}
+}
+
+func TestSamplerEmpty(t *testing.T) {
+	s := NewSampler(nil)
+	if s.Len() != 0 {
+		t.Errorf("got len %d, want 0", s.Len())
+	}
+}
+
+func TestDiskChainSampler(t *testing.T) {
+	src := NewMemoryChain(0)
+	Feed(src, split(testText))
+
+	for _, cacheSize := range []int{0, -1} {
+		f, cleanup := tempFile(t)
+		defer cleanup()
+
+		writer, err := NewDiskChainWriter(f)
+		if err != nil {
+			t.Fatalf("NewDiskChainWriter failed: %v", err)
+		}
+
+		err = Copy(writer, src)
+		if err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+
+		chain, err := ReadDiskChainWithOptions(f, &DiskChainOptions{CacheSize: cacheSize})
+		if err != nil {
+			t.Fatalf("ReadDiskChainWithOptions failed: %v", err)
+		}
+
+		const iterations = 100000
+
+		counts := map[interface{}]int{}
+		for i := 0; i < iterations; i++ {
+			value, err := RandomWalker(chain, 0).Next()
+			if err != nil {
+				t.Fatalf("got error: %v", err)
+			}
+			counts[value]++
+		}
+
+		links, err := chain.Links(0)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+
+		for _, link := range links {
+			value, err := chain.Get(link.ID)
+			if err != nil {
+				t.Fatalf("got error: %v", err)
+			}
+
+			actual := counts[value]
+			xp := int(link.Probability * float64(iterations))
+			if !fuzzyEquals(actual, xp, 0.1) {
+				t.Errorf("cache size %d: %q: got %d, want ~%d", cacheSize, value, actual, xp)
+			}
+		}
+
+		if keepsSamplers(chain) != (cacheSize >= 0) {
+			t.Errorf("cache size %d: got keepsSamplers %v", cacheSize, keepsSamplers(chain))
+		}
+
+		_, err = chain.Sampler(1)
+		if err == nil {
+			t.Errorf("cache size %d: got no error for an invalid ID", cacheSize)
+		}
+	}
+}
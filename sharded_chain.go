@@ -0,0 +1,415 @@
+package markov
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+var _ Chain = &ShardedChain{}
+
+// ShardedChain is a ReadWriteChain kept in memory that can be written from
+// multiple goroutines at once.
+//
+// Values are split between shards by a hash of the value. Each shard has its
+// own lock, so writes to different shards don't wait for each other. This
+// makes ShardedChain faster than MemoryChain when feeding multiple channels,
+// but slightly slower when only one goroutine writes to it.
+//
+// IDs are not sequential. Use IterativeWalker to visit every value. As with
+// DiskChain, ID 0 refers to the first value even if no value has that ID.
+type ShardedChain struct {
+	seed   maphash.Seed
+	shards []memoryShard
+}
+
+type memoryShard struct {
+	mu         sync.RWMutex
+	valueIndex map[interface{}]int
+	values     []interface{}
+	links      []linkCountSlice
+
+	// Pad shards to separate cache lines, so the locks don't contend.
+	_ [64]byte
+}
+
+// NewShardedChain creates a new ShardedChain with the given number of
+// shards. More shards make it less likely that two writers need the same
+// shard at once. If shards is 0 or less, four shards per CPU are used.
+func NewShardedChain(shards int) *ShardedChain {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+
+	c := &ShardedChain{
+		seed:   maphash.MakeSeed(),
+		shards: make([]memoryShard, shards),
+	}
+
+	for i := range c.shards {
+		c.shards[i].valueIndex = map[interface{}]int{}
+	}
+
+	return c
+}
+
+// id returns the ID of a value from its shard and index in the shard. An ID
+// is the index multiplied by the number of shards, plus the shard number.
+func (c *ShardedChain) id(shard, index int) int {
+	return index*len(c.shards) + shard
+}
+
+// shardOf returns the shard and index for an ID. The shard is nil if the ID
+// is invalid.
+func (c *ShardedChain) shardOf(id int) (*memoryShard, int) {
+	if id < 0 {
+		return nil, -1
+	}
+
+	if id == 0 {
+		id = c.firstID()
+	}
+
+	return &c.shards[id%len(c.shards)], id / len(c.shards)
+}
+
+// Get returns a value by it's ID. Returns nil if the ID doesn't exist.
+func (c *ShardedChain) Get(id int) (interface{}, error) {
+	s, index := c.shardOf(id)
+	if s == nil {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if index >= len(s.values) {
+		return nil, nil
+	}
+
+	return s.values[index], nil
+}
+
+// Links returns the items linked to the given item.
+//
+// Returns ErrNotFound if the ID doesn't exist.
+func (c *ShardedChain) Links(id int) ([]Link, error) {
+	s, index := c.shardOf(id)
+	if s == nil {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if index >= len(s.links) {
+		return nil, ErrNotFound
+	}
+
+	return s.links[index].LinkSlice(), nil
+}
+
+// Find returns the ID for the given value.
+//
+// Returns ErrNotFound if the value doesn't exist.
+func (c *ShardedChain) Find(value interface{}) (int, error) {
+	err := checkComparable(value)
+	if err != nil {
+		return 0, err
+	}
+
+	shard := c.shardFor(value)
+	s := &c.shards[shard]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index, ok := s.valueIndex[value]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return c.id(shard, index), nil
+}
+
+// Add conditionally inserts a new value to the chain.
+//
+// If the value exists it's ID is returned.
+func (c *ShardedChain) Add(value interface{}) (int, error) {
+	err := checkComparable(value)
+	if err != nil {
+		return 0, err
+	}
+
+	shard := c.shardFor(value)
+	s := &c.shards[shard]
+
+	s.mu.RLock()
+	index, ok := s.valueIndex[value]
+	s.mu.RUnlock()
+
+	if ok {
+		return c.id(shard, index), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another goroutine may have added the value since the read lock was
+	// released.
+	if index, ok := s.valueIndex[value]; ok {
+		return c.id(shard, index), nil
+	}
+
+	index = len(s.values)
+	s.values = append(s.values, value)
+	s.links = append(s.links, make(linkCountSlice, 0, 1))
+	s.valueIndex[value] = index
+
+	return c.id(shard, index), nil
+}
+
+// Relate increases the number of times child occurs after parent.
+//
+// Returns ErrNotFound if the parent doesn't exist.
+func (c *ShardedChain) Relate(parent, child int, delta int) error {
+	s, index := c.shardOf(parent)
+	if s == nil {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index >= len(s.links) {
+		return ErrNotFound
+	}
+
+	links := s.links[index]
+
+	childIndex := links.Find(child)
+	if childIndex < 0 {
+		s.links[index] = append(links, linkCount{ID: child})
+		childIndex = len(links)
+	}
+
+	s.links[index][childIndex].Count += delta
+
+	return nil
+}
+
+// firstID returns the lowest ID in use, which is the index 0 of the first
+// shard that isn't empty. It returns 0 if the chain is empty.
+func (c *ShardedChain) firstID() int {
+	for i := range c.shards {
+		s := &c.shards[i]
+
+		s.mu.RLock()
+		n := len(s.values)
+		s.mu.RUnlock()
+
+		if n > 0 {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// Next returns the id after the given id. Satisfies the IterativeChain
+// interface.
+func (c *ShardedChain) Next(last int) (int, error) {
+	if last < -1 {
+		last = -1
+	} else if last == 0 {
+		last = c.firstID()
+	}
+
+	// Shards have different lengths, so the IDs have gaps where a shorter
+	// shard has run out.
+	for id := last + 1; ; id++ {
+		s, index := c.shardOf(id)
+
+		s.mu.RLock()
+		n := len(s.values)
+		s.mu.RUnlock()
+
+		if index < n {
+			return id, nil
+		}
+
+		if index >= c.maxLen() {
+			return 0, ErrBrokenChain
+		}
+	}
+}
+
+// maxLen returns the length of the longest shard.
+func (c *ShardedChain) maxLen() int {
+	max := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+
+		s.mu.RLock()
+		if len(s.values) > max {
+			max = len(s.values)
+		}
+		s.mu.RUnlock()
+	}
+
+	return max
+}
+
+// Random pseudo-randomly picks a value and returns it. Satisfies the
+// RandomChain interface.
+func (c *ShardedChain) Random() (interface{}, error) {
+	for i := range c.shards {
+		c.shards[i].mu.RLock()
+		defer c.shards[i].mu.RUnlock()
+	}
+
+	total := 0
+	for i := range c.shards {
+		total += len(c.shards[i].values)
+	}
+
+	if total == 0 {
+		return nil, ErrNotFound
+	}
+
+	n := rand.Intn(total)
+	for i := range c.shards {
+		values := c.shards[i].values
+		if n < len(values) {
+			return values[n], nil
+		}
+		n -= len(values)
+	}
+
+	// Not reached.
+	return nil, ErrNotFound
+}
+
+func (c *ShardedChain) linkCounts(id int) (linkCountSlice, error) {
+	s, index := c.shardOf(id)
+	if s == nil {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if index >= len(s.links) {
+		return nil, ErrNotFound
+	}
+
+	return append(linkCountSlice(nil), s.links[index]...), nil
+}
+
+// shardFor returns the shard a value belongs in.
+func (c *ShardedChain) shardFor(value interface{}) int {
+	if len(c.shards) == 1 {
+		return 0
+	}
+
+	// Equal values must have equal hashes. The common types are hashed
+	// directly and everything else by walking it with reflection.
+	var hash uint64
+	switch v := value.(type) {
+	case int:
+		hash = mixHash(uint64(v))
+	case rune:
+		hash = mixHash(uint64(v))
+	case float64:
+		hash = mixHash(floatBits(v))
+	case string:
+		var h maphash.Hash
+		h.SetSeed(c.seed)
+		h.WriteString(v)
+		hash = h.Sum64()
+	default:
+		var h maphash.Hash
+		h.SetSeed(c.seed)
+		hashValue(&h, reflect.ValueOf(value))
+		hash = h.Sum64()
+	}
+
+	return int(hash % uint64(len(c.shards)))
+}
+
+// hashValue writes v to h so that values that are equal with == write the
+// same bytes, e.g. 0.0 and -0.0 in a tuple. v must be comparable.
+func hashValue(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	writeUint := func(n uint64) {
+		binary.LittleEndian.PutUint64(buf[:], n)
+		h.Write(buf[:])
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		h.WriteByte(0)
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeUint(floatBits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeUint(floatBits(real(c)))
+		writeUint(floatBits(imag(c)))
+	case reflect.String:
+		h.WriteString(v.String())
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		writeUint(uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+			return
+		}
+		// Interfaces are only equal if their dynamic types are.
+		h.WriteString(v.Elem().Type().String())
+		hashValue(h, v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			// Blank fields are ignored by ==.
+			if t.Field(i).Name == "_" {
+				continue
+			}
+			hashValue(h, v.Field(i))
+		}
+	}
+}
+
+// floatBits returns the bits of f, with -0 changed to 0 since -0 == 0.
+func floatBits(f float64) uint64 {
+	if f == 0 {
+		return 0
+	}
+	return math.Float64bits(f)
+}
+
+// mixHash spreads the bits of n so that sequential numbers land in different
+// shards.
+func mixHash(n uint64) uint64 {
+	n ^= n >> 33
+	n *= 0xff51afd7ed558ccd
+	n ^= n >> 33
+	return n
+}
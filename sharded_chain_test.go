@@ -0,0 +1,260 @@
+package markov
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestShardedChain(t *testing.T) {
+	testReadWriteChain(t, NewShardedChain(4))
+}
+
+func TestShardedChainSingleShard(t *testing.T) {
+	testReadWriteChain(t, NewShardedChain(1))
+}
+
+func TestShardedChainIterate(t *testing.T) {
+	chain := NewShardedChain(7)
+
+	want := map[interface{}]bool{}
+	for i := 0; i < 100; i++ {
+		want[i] = true
+		_, err := chain.Add(i)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	walker := IterativeWalker(chain)
+	for {
+		value, err := walker.Next()
+		if err == ErrBrokenChain {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+
+		if !want[value] {
+			t.Errorf("got unexpected or repeated value %v", value)
+		}
+		delete(want, value)
+	}
+
+	if len(want) > 0 {
+		t.Errorf("%d values weren't visited", len(want))
+	}
+
+	value, err := Random(chain)
+	if err != nil {
+		t.Fatalf("Random failed: %v", err)
+	}
+	if _, err := chain.Find(value); err != nil {
+		t.Errorf("Random returned %v, which can't be found: %v", value, err)
+	}
+}
+
+func TestShardedChainNotFound(t *testing.T) {
+	chain := NewShardedChain(4)
+
+	id, err := chain.Add("a")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	for _, bad := range []int{-1, id + 4} {
+		if _, err := chain.Links(bad); err != ErrNotFound {
+			t.Errorf("Links(%d): got %v, want %v", bad, err, ErrNotFound)
+		}
+
+		if err := chain.Relate(bad, id, 1); err != ErrNotFound {
+			t.Errorf("Relate(%d): got %v, want %v", bad, err, ErrNotFound)
+		}
+
+		if value, _ := chain.Get(bad); value != nil {
+			t.Errorf("Get(%d): got %v, want nil", bad, value)
+		}
+	}
+
+	if _, err := chain.Find("b"); err != ErrNotFound {
+		t.Errorf("Find: got %v, want %v", err, ErrNotFound)
+	}
+
+	if _, err := NewShardedChain(4).Random(); err != ErrNotFound {
+		t.Errorf("Random on empty chain: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestShardedChainEqualValues(t *testing.T) {
+	type point struct {
+		X, Y float32
+		_    int
+	}
+	var value interface{} = 1.5
+
+	cases := []struct {
+		a, b interface{}
+	}{
+		{0.0, math.Copysign(0, -1)},
+		{Tuple(0.0, "a"), Tuple(math.Copysign(0, -1), "a")},
+		{Tuple(Tuple(1, 0.0)), Tuple(Tuple(1, math.Copysign(0, -1)))},
+		{point{X: 0, Y: 1}, point{X: float32(math.Copysign(0, -1)), Y: 1}},
+		{[2]complex128{0}, [2]complex128{complex(math.Copysign(0, -1), 0)}},
+		{Tuple(value, nil), Tuple(1.5, nil)},
+	}
+
+	for _, tc := range cases {
+		if tc.a != tc.b {
+			t.Fatalf("%#v != %#v", tc.a, tc.b)
+		}
+
+		// The seed changes with each chain, so try a few.
+		for i := 0; i < 20; i++ {
+			chain := NewShardedChain(64)
+			if a, b := chain.shardFor(tc.a), chain.shardFor(tc.b); a != b {
+				t.Fatalf("%#v and %#v are in shards %d and %d", tc.a, tc.b, a, b)
+			}
+
+			id, err := chain.Add(tc.a)
+			if err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+
+			found, err := chain.Find(tc.b)
+			if err != nil || found != id {
+				t.Fatalf("Find(%#v): got %d, %v, want %d", tc.b, found, err, id)
+			}
+		}
+	}
+}
+
+func TestShardedChainConcurrent(t *testing.T) {
+	testConcurrentWrites(t, NewShardedChain(0))
+}
+
+// testConcurrentWrites adds the same values and links to chain from several
+// goroutines at once, and checks none were lost or duplicated. Run with -race.
+func testConcurrentWrites(t *testing.T, chain ReadWriteChain) {
+	const (
+		writers = 8
+		values  = 200
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(writers)
+
+	errs := make(chan error, writers)
+
+	for w := 0; w < writers; w++ {
+		go func() {
+			defer wg.Done()
+
+			last, err := chain.Add(0)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for i := 1; i < values; i++ {
+				id, err := chain.Add(i)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				err = chain.Relate(last, id, 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// Read while others are writing.
+				_, err = chain.Links(last)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				last = id
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	ids := map[int]bool{}
+	for i := 0; i < values; i++ {
+		id, err := chain.Find(i)
+		if err != nil {
+			t.Fatalf("Find(%d) failed: %v", i, err)
+		}
+
+		if ids[id] {
+			t.Errorf("ID %d is used by more than one value", id)
+		}
+		ids[id] = true
+
+		if i == values-1 {
+			continue
+		}
+
+		counts, err := LinkCounts(chain, id)
+		if err != nil {
+			t.Fatalf("LinkCounts(%d) failed: %v", id, err)
+		}
+
+		if len(counts) != 1 || counts[0].Count != writers {
+			t.Errorf("value %d: got links %v, want one link with count %d", i, counts, writers)
+		}
+	}
+}
+
+func TestShardedChainFirstID(t *testing.T) {
+	chain := NewShardedChain(16)
+
+	// Add values until one lands outside the first shard.
+	var value, id int
+	for ; ; value++ {
+		var err error
+		id, err = chain.Add(value)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+
+		if id != 0 {
+			break
+		}
+
+		chain = NewShardedChain(16)
+	}
+
+	got, err := chain.Get(0)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got != value {
+		t.Errorf("Get(0): got %v, want %v", got, value)
+	}
+
+	walker := IterativeWalker(chain)
+	count := 0
+	for {
+		_, err := walker.Next()
+		if err == ErrBrokenChain {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		count++
+	}
+
+	if count != 1 {
+		t.Errorf("walked %d values, want 1", count)
+	}
+}
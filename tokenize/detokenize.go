@@ -0,0 +1,179 @@
+package tokenize
+
+import (
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Detokenizer joins tokens into text. It reverses what a Tokenizer using
+// ScanWords does, putting spaces between words but not before closing
+// punctuation or after opening punctuation.
+type Detokenizer struct {
+	// Capitalize capitalizes the first word of each sentence and the
+	// word "I", which restores most of the capitals removed by
+	// Tokenizer.FoldCase.
+	Capitalize bool
+}
+
+// NewWriter returns a TokenWriter that writes text to w.
+func (d *Detokenizer) NewWriter(w io.Writer) *TokenWriter {
+	return &TokenWriter{
+		w:          w,
+		capitalize: d.Capitalize,
+	}
+}
+
+// DetokenizeString returns the text for tokens.
+func (d *Detokenizer) DetokenizeString(tokens []string) string {
+	var b strings.Builder
+
+	tw := d.NewWriter(&b)
+	for _, token := range tokens {
+		// strings.Builder doesn't return errors.
+		tw.WriteToken(token)
+	}
+
+	return b.String()
+}
+
+// TokenWriter writes tokens as text. It's returned by Detokenizer.NewWriter.
+type TokenWriter struct {
+	w          io.Writer
+	capitalize bool
+
+	started bool
+
+	// space is true if the next token needs a space before it.
+	space bool
+
+	// sentenceEnd is true after a token that ends a sentence.
+	sentenceEnd bool
+
+	// open holds the straight quotes (" and ') that have been opened but
+	// not closed, innermost last.
+	open []string
+}
+
+// WriteToken writes a token, and the space before it if one is needed.
+func (tw *TokenWriter) WriteToken(token string) error {
+	if token == "" {
+		return nil
+	}
+
+	space, spaceAfter := tw.spacing(token)
+
+	if tw.capitalize && isWord(token) {
+		if !tw.started || tw.sentenceEnd {
+			token = capitalize(token)
+		} else if token == "i" || strings.HasPrefix(token, "i'") || strings.HasPrefix(token, "i’") {
+			token = "I" + token[1:]
+		}
+	}
+
+	if space && tw.started {
+		_, err := io.WriteString(tw.w, " ")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(tw.w, token)
+	if err != nil {
+		return err
+	}
+
+	tw.started = true
+	tw.space = spaceAfter
+
+	switch {
+	case isSentenceEnd(token):
+		tw.sentenceEnd = true
+	case isWord(token):
+		tw.sentenceEnd = false
+	}
+
+	return nil
+}
+
+// spacing returns whether token needs a space before and after it.
+func (tw *TokenWriter) spacing(token string) (before, after bool) {
+	switch {
+	case token == `"` || token == "'":
+		// Straight quotes close the last quote of the same kind,
+		// otherwise they open a new one.
+		if n := len(tw.open); n > 0 && tw.open[n-1] == token {
+			tw.open = tw.open[:n-1]
+			return false, true
+		}
+
+		tw.open = append(tw.open, token)
+		return tw.space, false
+
+	case isOpening(token):
+		return tw.space, false
+
+	case isClosing(token):
+		return false, true
+
+	case isJoining(token):
+		return false, false
+	}
+
+	return tw.space, true
+}
+
+// isOpening reports whether token is punctuation that attaches to the
+// following token, e.g. "(" or "“".
+func isOpening(token string) bool {
+	r, size := utf8.DecodeRuneInString(token)
+	if size != len(token) {
+		return false
+	}
+
+	return unicode.In(r, unicode.Ps, unicode.Pi) || r == '¿' || r == '¡'
+}
+
+// isClosing reports whether token is punctuation that attaches to the
+// preceding token, e.g. "," or ")".
+func isClosing(token string) bool {
+	r, size := utf8.DecodeRuneInString(token)
+	if size != len(token) {
+		// Contraction endings, e.g. "'s" or "n't", attach too.
+		return isApostrophe(r) || strings.HasPrefix(token, "n'") || strings.HasPrefix(token, "n’")
+	}
+
+	if unicode.In(r, unicode.Pe, unicode.Pf) {
+		return true
+	}
+
+	return strings.ContainsRune(",;:%", r) || isSentenceTerminator(r)
+}
+
+// isJoining reports whether token is punctuation that attaches to the tokens
+// on both sides, e.g. "-" or "/".
+func isJoining(token string) bool {
+	r, size := utf8.DecodeRuneInString(token)
+	if size != len(token) {
+		return false
+	}
+
+	return unicode.Is(unicode.Pd, r) || r == '/'
+}
+
+func isSentenceEnd(token string) bool {
+	r, size := utf8.DecodeRuneInString(token)
+	return size == len(token) && isSentenceTerminator(r)
+}
+
+// isWord reports whether token starts with a letter or digit.
+func isWord(token string) bool {
+	r, _ := utf8.DecodeRuneInString(token)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func capitalize(token string) string {
+	r, size := utf8.DecodeRuneInString(token)
+	return string(unicode.ToTitle(r)) + token[size:]
+}
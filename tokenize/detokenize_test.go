@@ -0,0 +1,90 @@
+package tokenize
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetokenizer(t *testing.T) {
+	cases := []struct {
+		tokens     []string
+		want       string
+		capitalize bool
+	}{
+		{
+			tokens: nil,
+			want:   "",
+		},
+		{
+			tokens: []string{"Hello", ",", "world", "."},
+			want:   "Hello, world.",
+		},
+		{
+			tokens: []string{"she", "said", `"`, "stop", "!", `"`, "and", "left", "."},
+			want:   `she said "stop!" and left.`,
+		},
+		{
+			tokens: []string{`"`, "a", "'", "b", "'", "c", `"`, "d"},
+			want:   `"a 'b' c" d`,
+		},
+		{
+			tokens: []string{"a", "(", "b", ")", "c", "[", "d", "]", "."},
+			want:   "a (b) c [d].",
+		},
+		{
+			tokens: []string{"“", "well", "-", "known", "”", "—", "or", "not", "?"},
+			want:   "“well-known”—or not?",
+		},
+		{
+			tokens: []string{"it", "is", "100", "%", "done", "…"},
+			want:   "it is 100% done…",
+		},
+		{
+			tokens:     []string{"the", "cat", "sat", ".", "then", "i", "left", "!", `"`, "why", "?", `"`, "i'm", "not", "sure", "."},
+			want:       `The cat sat. Then I left! "Why?" I'm not sure.`,
+			capitalize: true,
+		},
+		{
+			tokens:     []string{"éclair", "time"},
+			want:       "Éclair time",
+			capitalize: true,
+		},
+	}
+
+	for _, c := range cases {
+		d := Detokenizer{Capitalize: c.capitalize}
+		got := d.DetokenizeString(c.tokens)
+		if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.tokens, got, c.want)
+		}
+	}
+}
+
+func TestDetokenizerRoundTrip(t *testing.T) {
+	const text = `"Hello, world," she said (quietly). It's 100% done—or is it?`
+
+	tokens, err := (&Tokenizer{}).TokenizeString(text)
+	if err != nil {
+		t.Fatalf("TokenizeString failed: %v", err)
+	}
+
+	got := (&Detokenizer{}).DetokenizeString(tokens)
+	if got != text {
+		t.Errorf("got %q, want %q", got, text)
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestTokenWriterError(t *testing.T) {
+	tw := (&Detokenizer{}).NewWriter(errWriter{})
+
+	err := tw.WriteToken("a")
+	if err == nil {
+		t.Error("want error")
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/pboyd/markov/tokenize/internal/tablegen
+
+go 1.26.0
+
+require golang.org/x/text v0.42.0
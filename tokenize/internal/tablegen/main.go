@@ -0,0 +1,162 @@
+// tablegen writes the normalization tables in tokenize/tables.go.
+//
+// The tables are taken from golang.org/x/text/unicode/norm, which must be
+// built from the same version of Unicode as the unicode package. Update
+// golang.org/x/text in go.mod when Go's Unicode version changes, then run go
+// generate in the tokenize package:
+//
+//	go run -C internal/tablegen . -o ../../tables.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Hangul syllables are decomposed and composed algorithmically by the tokenize
+// package, so they aren't in the tables.
+const (
+	hangulFirst = 0xAC00
+	hangulLast  = 0xD7A3
+)
+
+func main() {
+	out := flag.String("o", "tables.go", "output `file`")
+	flag.Parse()
+
+	if norm.Version != unicode.Version {
+		log.Fatalf("golang.org/x/text/unicode/norm has Unicode %s but the unicode package has %s, update golang.org/x/text", norm.Version, unicode.Version)
+	}
+
+	classes := map[rune]uint8{}
+	decompositions := map[rune]string{}
+
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		if !utf8.ValidRune(r) {
+			continue
+		}
+
+		s := string(r)
+		if class := norm.NFD.PropertiesString(s).CCC(); class != 0 {
+			classes[r] = class
+		}
+
+		if r >= hangulFirst && r <= hangulLast {
+			continue
+		}
+		if d := norm.NFD.String(s); d != s {
+			decompositions[r] = d
+		}
+	}
+
+	runes := sortedKeys(decompositions)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by internal/tablegen from golang.org/x/text/unicode/norm. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package tokenize\n\n")
+
+	fmt.Fprintf(&buf, "// tablesVersion is the version of Unicode the tables are from.\n")
+	fmt.Fprintf(&buf, "const tablesVersion = %q\n\n", unicode.Version)
+
+	fmt.Fprintf(&buf, "// decompositions maps runes to their full canonical decomposition.\n")
+	fmt.Fprintf(&buf, "var decompositions = map[rune]string{\n")
+	for _, r := range runes {
+		fmt.Fprintf(&buf, "0x%04X: %s,\n", r, quote(decompositions[r]))
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "// compositions maps pairs of runes to the rune they compose to. Composition\n")
+	fmt.Fprintf(&buf, "// exclusions, singletons and non-starter decompositions are omitted.\n")
+	fmt.Fprintf(&buf, "var compositions = map[[2]rune]rune{\n")
+	for _, r := range runes {
+		pair, ok := composition(r, decompositions[r], classes)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&buf, "{0x%04X, 0x%04X}: 0x%04X,\n", pair[0], pair[1], r)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "// combiningClasses maps runes to their canonical combining class. Runes that\n")
+	fmt.Fprintf(&buf, "// aren't present have class 0.\n")
+	fmt.Fprintf(&buf, "var combiningClasses = map[rune]uint8{\n")
+	for _, r := range sortedKeys(classes) {
+		fmt.Fprintf(&buf, "0x%04X: %d,\n", r, classes[r])
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile(*out, src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// composition returns the pair of runes that compose to r, which has the full
+// decomposition d. ok is false if r isn't a primary composite.
+//
+// norm doesn't expose the single level decompositions, but a primary composite
+// is always its last combining mark composed with the composition of
+// everything before it.
+func composition(r rune, d string, classes map[rune]uint8) (pair [2]rune, ok bool) {
+	// Excluded and singleton decompositions don't recompose.
+	if norm.NFC.String(string(r)) != string(r) {
+		return pair, false
+	}
+
+	first, _ := utf8.DecodeRuneInString(d)
+	if classes[r] != 0 || classes[first] != 0 {
+		return pair, false
+	}
+
+	last, size := utf8.DecodeLastRuneInString(d)
+	prefix := norm.NFC.String(d[:len(d)-size])
+	if utf8.RuneCountInString(prefix) != 1 {
+		log.Fatalf("U+%04X: can't find the pair for %s", r, quote(d))
+	}
+
+	pair[0], _ = utf8.DecodeRuneInString(prefix)
+	pair[1] = last
+	if norm.NFC.String(string(pair[:])) != string(r) {
+		log.Fatalf("U+%04X: %s doesn't compose", r, quote(string(pair[:])))
+	}
+
+	return pair, true
+}
+
+func sortedKeys[V any](m map[rune]V) []rune {
+	runes := make([]rune, 0, len(m))
+	for r := range m {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
+
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if r > 0xFFFF {
+			fmt.Fprintf(&b, `\U%08X`, r)
+		} else {
+			fmt.Fprintf(&b, `\u%04X`, r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
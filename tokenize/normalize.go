@@ -0,0 +1,181 @@
+package tokenize
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:generate go run -C internal/tablegen . -o ../../tables.go
+
+// Form is a Unicode normalization form.
+type Form int
+
+const (
+	// None leaves text unchanged.
+	None Form = iota
+
+	// NFC composes runes into precomposed characters where possible,
+	// e.g. "é" becomes "é".
+	NFC
+
+	// NFD decomposes precomposed characters, e.g. "é" becomes "é".
+	NFD
+)
+
+// ParseForm returns the Form with the given name ("nfc", "nfd" or "none").
+func ParseForm(name string) (Form, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return None, nil
+	case "nfc":
+		return NFC, nil
+	case "nfd":
+		return NFD, nil
+	}
+
+	return None, fmt.Errorf("unknown normalization form %q", name)
+}
+
+// Normalize returns s in normalization form f.
+func (f Form) Normalize(s string) string {
+	if isASCII(s) {
+		return s
+	}
+
+	switch f {
+	case NFC:
+		return string(compose(decompose(s)))
+	case NFD:
+		return string(decompose(s))
+	}
+
+	return s
+}
+
+// Hangul syllables are composed algorithmically, see section 3.12 of the
+// Unicode standard.
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// decompose returns the canonical decomposition of s, with combining marks in
+// canonical order.
+func decompose(s string) []rune {
+	runes := make([]rune, 0, len(s))
+
+	for _, r := range s {
+		if d, ok := decompositions[r]; ok {
+			for _, dr := range d {
+				runes = append(runes, dr)
+			}
+			continue
+		}
+
+		if r >= hangulSBase && r < hangulSBase+hangulSCount {
+			i := r - hangulSBase
+			runes = append(runes, hangulLBase+i/hangulNCount, hangulVBase+(i%hangulNCount)/hangulTCount)
+			if t := i % hangulTCount; t != 0 {
+				runes = append(runes, hangulTBase+t)
+			}
+			continue
+		}
+
+		runes = append(runes, r)
+	}
+
+	// Sort each run of combining marks by combining class. The sort must
+	// be stable, marks with the same class stay in the order they were
+	// written.
+	for start := 0; start < len(runes); {
+		if combiningClasses[runes[start]] == 0 {
+			start++
+			continue
+		}
+
+		end := start + 1
+		for end < len(runes) && combiningClasses[runes[end]] != 0 {
+			end++
+		}
+
+		marks := runes[start:end]
+		sort.SliceStable(marks, func(i, j int) bool {
+			return combiningClasses[marks[i]] < combiningClasses[marks[j]]
+		})
+		start = end
+	}
+
+	return runes
+}
+
+// compose canonically composes decomposed runes. The slice is modified in
+// place.
+func compose(runes []rune) []rune {
+	if len(runes) == 0 {
+		return runes
+	}
+
+	starter := 0
+	lastClass := combiningClasses[runes[0]]
+	if lastClass != 0 {
+		// There's nothing to compose with until the next starter.
+		lastClass = 255
+	}
+
+	out := 1
+	for _, r := range runes[1:] {
+		class := combiningClasses[r]
+
+		// A rune composes with the last starter unless another rune
+		// between them has the same or higher combining class.
+		if lastClass < class || lastClass == 0 {
+			if composed, ok := composePair(runes[starter], r); ok {
+				runes[starter] = composed
+				continue
+			}
+		}
+
+		if class == 0 {
+			starter = out
+		}
+		lastClass = class
+		runes[out] = r
+		out++
+	}
+
+	return runes[:out]
+}
+
+func composePair(a, b rune) (rune, bool) {
+	if a >= hangulLBase && a < hangulLBase+hangulLCount && b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+(b-hangulVBase))*hangulTCount, true
+	}
+
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + (b - hangulTBase), true
+	}
+
+	r, ok := compositions[[2]rune{a, b}]
+	return r, ok
+}
+
+// isASCII reports whether s is entirely ASCII, which is the same in every
+// normalization form.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package tokenize
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in, nfc, nfd string
+	}{
+		{"plain", "plain", "plain"},
+		{"caf\u00e9", "caf\u00e9", "cafe\u0301"},
+		{"cafe\u0301", "caf\u00e9", "cafe\u0301"},
+		// Marks are put in canonical order, dot below (220) before
+		// dot above (230).
+		{"q\u0307\u0323", "q\u0323\u0307", "q\u0323\u0307"},
+		{"\u1e0b\u0323", "\u1e0d\u0307", "d\u0323\u0307"},
+		// Singletons decompose but aren't recomposed.
+		{"\u212b", "\u00c5", "A\u030a"},
+		{"\u2126", "\u03a9", "\u03a9"},
+		// Hangul syllables are composed algorithmically.
+		{"\ud55c", "\ud55c", "\u1112\u1161\u11ab"},
+		{"\u1112\u1161\u11ab", "\ud55c", "\u1112\u1161\u11ab"},
+		// A mark at the start has nothing to compose with.
+		{"\u0301e", "\u0301e", "\u0301e"},
+	}
+
+	for _, c := range cases {
+		if got := NFC.Normalize(c.in); got != c.nfc {
+			t.Errorf("NFC %+q: got %+q, want %+q", c.in, got, c.nfc)
+		}
+
+		if got := NFD.Normalize(c.in); got != c.nfd {
+			t.Errorf("NFD %+q: got %+q, want %+q", c.in, got, c.nfd)
+		}
+
+		if got := None.Normalize(c.in); got != c.in {
+			t.Errorf("None %+q: got %+q", c.in, got)
+		}
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	for name, want := range map[string]Form{"": None, "none": None, "NFC": NFC, "nfd": NFD} {
+		got, err := ParseForm(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+		} else if got != want {
+			t.Errorf("%q: got %d, want %d", name, got, want)
+		}
+	}
+
+	_, err := ParseForm("nfkc")
+	if err == nil {
+		t.Error("want error for nfkc")
+	}
+}
+
+// TestTablesVersion fails when Go's Unicode version is newer than the
+// normalization tables, which need to be regenerated with go generate.
+func TestTablesVersion(t *testing.T) {
+	if compareVersions(unicode.Version, tablesVersion) > 0 {
+		t.Errorf("tables are from Unicode %s but Go has Unicode %s, update internal/tablegen and run go generate", tablesVersion, unicode.Version)
+	}
+}
+
+// compareVersions compares two dotted version numbers.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
@@ -0,0 +1,323 @@
+package tokenize
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ScanWords is a bufio.SplitFunc that returns words. A word is a run of
+// letters, digits and combining marks, and may contain apostrophes (e.g.
+// "don't"). Each punctuation or symbol character is returned as a separate
+// token. Whitespace and other characters are skipped.
+func ScanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) {
+		r, size, ok := decodeRune(data[start:], atEOF)
+		if !ok {
+			return start, nil, nil
+		}
+
+		if isWordRune(r) {
+			break
+		}
+
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return start + size, data[start : start+size], nil
+		}
+
+		start += size
+	}
+
+	for i := start; i < len(data); {
+		r, size, ok := decodeRune(data[i:], atEOF)
+		if !ok {
+			return start, nil, nil
+		}
+
+		if isApostrophe(r) {
+			// Apostrophes are only part of the word when they're
+			// followed by another letter.
+			next, _, ok := decodeRune(data[i+size:], atEOF)
+			if !ok {
+				if atEOF {
+					return i, data[start:i], nil
+				}
+				return start, nil, nil
+			}
+
+			if !isWordRune(next) {
+				return i, data[start:i], nil
+			}
+		} else if !isWordRune(r) {
+			return i, data[start:i], nil
+		}
+
+		i += size
+	}
+
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+
+	return start, nil, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’'
+}
+
+// decodeRune decodes the first rune in data. ok is false if more data is
+// needed to decode it.
+func decodeRune(data []byte, atEOF bool) (r rune, size int, ok bool) {
+	if len(data) == 0 || (!atEOF && !utf8.FullRune(data)) {
+		return 0, 0, false
+	}
+
+	r, size = utf8.DecodeRune(data)
+	return r, size, true
+}
+
+// ScanGraphemes is a bufio.SplitFunc that returns each user-perceived
+// character, i.e. a base character followed by any combining marks.
+//
+// It follows the rules for extended grapheme clusters in Unicode Standard
+// Annex #29 for combining marks, Hangul syllables, regional indicator (flag)
+// pairs and emoji joined with zero-width joiners, but doesn't implement the
+// full set of rules (e.g. prepended concatenation marks aren't joined to the
+// following character).
+func ScanGraphemes(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	prev, size, ok := decodeRune(data, atEOF)
+	if !ok {
+		return 0, nil, nil
+	}
+
+	regional := 0
+	if isRegionalIndicator(prev) {
+		regional = 1
+	}
+
+	for i := size; ; {
+		r, size, ok := decodeRune(data[i:], atEOF)
+		if !ok {
+			if atEOF {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		}
+
+		if graphemeBreak(prev, r, regional) {
+			return i, data[:i], nil
+		}
+
+		if isRegionalIndicator(r) {
+			regional++
+		}
+
+		prev = r
+		i += size
+	}
+}
+
+// graphemeBreak reports whether there's a grapheme cluster boundary between
+// a and b. regional is the number of regional indicators before b.
+func graphemeBreak(a, b rune, regional int) bool {
+	switch {
+	case a == '\r' && b == '\n':
+		return false
+	case isControl(a) || isControl(b):
+		return true
+	case isHangulL(a) && (isHangulL(b) || isHangulV(b) || isHangulLV(b) || isHangulLVT(b)):
+		return false
+	case (isHangulLV(a) || isHangulV(a)) && (isHangulV(b) || isHangulT(b)):
+		return false
+	case (isHangulLVT(a) || isHangulT(a)) && isHangulT(b):
+		return false
+	case unicode.IsMark(b) || b == zeroWidthJoiner || isEmojiModifier(b):
+		return false
+	case a == zeroWidthJoiner && isPictographic(b):
+		return false
+	case isRegionalIndicator(a) && isRegionalIndicator(b):
+		return regional%2 == 0
+	}
+
+	return true
+}
+
+const zeroWidthJoiner = '\u200D'
+
+func isControl(r rune) bool {
+	return r == '\r' || r == '\n' || unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+// isPictographic approximates the Extended_Pictographic property, which
+// isn't in the unicode package.
+func isPictographic(r rune) bool {
+	return unicode.Is(unicode.So, r) || (r >= 0x1F000 && r <= 0x1FAFF)
+}
+
+func isHangulL(r rune) bool {
+	return (r >= 0x1100 && r <= 0x115F) || (r >= 0xA960 && r <= 0xA97C)
+}
+
+func isHangulV(r rune) bool {
+	return (r >= 0x1160 && r <= 0x11A7) || (r >= 0xD7B0 && r <= 0xD7C6)
+}
+
+func isHangulT(r rune) bool {
+	return (r >= 0x11A8 && r <= 0x11FF) || (r >= 0xD7CB && r <= 0xD7FB)
+}
+
+func isHangulLV(r rune) bool {
+	return r >= hangulSBase && r < hangulSBase+hangulSCount && (r-hangulSBase)%hangulTCount == 0
+}
+
+func isHangulLVT(r rune) bool {
+	return r >= hangulSBase && r < hangulSBase+hangulSCount && (r-hangulSBase)%hangulTCount != 0
+}
+
+// ScanSentences is a bufio.SplitFunc that returns sentences. A sentence ends
+// with a full stop, question mark or exclamation mark (and any closing quotes
+// or brackets) followed by white space and a character that isn't a lower
+// case letter, or with a blank line. Runs of white space, including line
+// breaks, are replaced with a single space.
+//
+// Abbreviations followed by a capitalized word (e.g. "Mr. Smith") end a
+// sentence.
+func ScanSentences(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) {
+		r, size, ok := decodeRune(data[start:], atEOF)
+		if !ok {
+			return start, nil, nil
+		}
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += size
+	}
+
+	terminated := false
+	newlines := 0
+
+	for i := start; i < len(data); {
+		r, size, ok := decodeRune(data[i:], atEOF)
+		if !ok {
+			break
+		}
+
+		switch {
+		case isSentenceTerminator(r):
+			terminated = true
+			newlines = 0
+		case terminated && isClosingPunctuation(r):
+		case unicode.IsSpace(r):
+			if r == '\n' {
+				newlines++
+			}
+
+			if newlines >= 2 {
+				return i + size, collapseSpace(data[start:i]), nil
+			}
+
+			if terminated {
+				next, ok := nextNonSpace(data[i:], atEOF)
+				if !ok {
+					return start, nil, nil
+				}
+
+				if !unicode.IsLower(next) {
+					return i + size, collapseSpace(data[start:i]), nil
+				}
+			}
+			terminated = false
+		default:
+			terminated = false
+			newlines = 0
+		}
+
+		i += size
+	}
+
+	if atEOF && start < len(data) {
+		return len(data), collapseSpace(data[start:]), nil
+	}
+
+	return start, nil, nil
+}
+
+func isSentenceTerminator(r rune) bool {
+	return strings.ContainsRune(".!?…。！？", r)
+}
+
+func isClosingPunctuation(r rune) bool {
+	return unicode.In(r, unicode.Pe, unicode.Pf) || r == '"' || r == '\''
+}
+
+// nextNonSpace returns the first rune in data that isn't white space. At EOF,
+// it returns 0 if there isn't one. ok is false if more data is needed.
+func nextNonSpace(data []byte, atEOF bool) (rune, bool) {
+	for i := 0; i < len(data); {
+		r, size, ok := decodeRune(data[i:], atEOF)
+		if !ok {
+			return 0, false
+		}
+
+		if !unicode.IsSpace(r) {
+			return r, true
+		}
+		i += size
+	}
+
+	return 0, atEOF
+}
+
+func collapseSpace(data []byte) []byte {
+	return []byte(strings.Join(strings.Fields(string(data)), " "))
+}
+
+// ScanRegexp returns a bufio.SplitFunc that returns each match of re. Text
+// between matches is skipped. Matches can't span lines and empty matches are
+// ignored.
+func ScanRegexp(re *regexp.Regexp) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		for len(data) > 0 {
+			end := bytes.IndexByte(data, '\n')
+			if end < 0 {
+				if !atEOF {
+					return advance, nil, nil
+				}
+				end = len(data)
+			}
+
+			for _, match := range re.FindAllIndex(data[:end], -1) {
+				if match[1] > match[0] {
+					return advance + match[1], data[match[0]:match[1]], nil
+				}
+			}
+
+			if end < len(data) {
+				end++
+			}
+			advance += end
+			data = data[end:]
+		}
+
+		return advance, nil, nil
+	}
+}
@@ -0,0 +1,116 @@
+package tokenize
+
+import (
+	"bufio"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scan splits s with split. The input is read one byte at a time, so split
+// functions have to handle runes and tokens that cross reads.
+func scan(t *testing.T, split bufio.SplitFunc, s string) []string {
+	t.Helper()
+
+	scanner := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(s)))
+	scanner.Split(split)
+
+	var tokens []string
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan %q failed: %v", s, err)
+	}
+
+	return tokens
+}
+
+func TestScanWords(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"the cat", []string{"the", "cat"}},
+		{"Don't stop, 'til you're done.", []string{"Don't", "stop", ",", "'", "til", "you're", "done", "."}},
+		{"the dogs' bowls", []string{"the", "dogs", "'", "bowls"}},
+		{"café 42 naïve", []string{"café", "42", "naïve"}},
+		{"a—b", []string{"a", "—", "b"}},
+		{"$5", []string{"$", "5"}},
+		{"it’s", []string{"it’s"}},
+		{"end'", []string{"end", "'"}},
+	}
+
+	for _, c := range cases {
+		got := scan(t, ScanWords, c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestScanGraphemes(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"abc", []string{"a", "b", "c"}},
+		{"e\u0301a", []string{"e\u0301", "a"}},
+		{"\r\nx\n\r", []string{"\r\n", "x", "\n", "\r"}},
+		{"\u1100\u1161\u11a8\u1100", []string{"\u1100\u1161\u11a8", "\u1100"}},
+		{"한국", []string{"한", "국"}},
+		{"🇨🇦🇫🇷🇩", []string{"🇨🇦", "🇫🇷", "🇩"}},
+		{"👍🏽!", []string{"👍🏽", "!"}},
+		{"👩\u200d💻x", []string{"👩\u200d💻", "x"}},
+	}
+
+	for _, c := range cases {
+		got := scan(t, ScanGraphemes, c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+q: got %+q, want %+q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestScanSentences(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"One. Two!  Three?", []string{"One.", "Two!", "Three?"}},
+		{"No terminator", []string{"No terminator"}},
+		{"It said \"Stop.\" Then it\nstopped.", []string{"It said \"Stop.\"", "Then it stopped."}},
+		{"Version 1.2 is out. See e.g. the notes.", []string{"Version 1.2 is out.", "See e.g. the notes."}},
+		{"A heading\n\nThe text.", []string{"A heading", "The text."}},
+		{"Wait... what?", []string{"Wait... what?"}},
+		{"Really?! Yes.", []string{"Really?!", "Yes."}},
+	}
+
+	for _, c := range cases {
+		got := scan(t, ScanSentences, c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestScanRegexp(t *testing.T) {
+	split := ScanRegexp(regexp.MustCompile(`[0-9]+|x*`))
+
+	got := scan(t, split, "a1 22\nb333 c\n\n4")
+	want := []string{"1", "22", "333", "4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = scan(t, split, "no numbers\n")
+	if got != nil {
+		t.Errorf("got %q, want nothing", got)
+	}
+}
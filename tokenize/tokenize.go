@@ -0,0 +1,208 @@
+// Package tokenize splits text into tokens for building chains.
+//
+// A Tokenizer reads text with a bufio.SplitFunc, such as ScanWords or
+// ScanSentences in this package or bufio.ScanRunes and bufio.ScanWords (which
+// splits on whitespace) in the standard library. Each token is cleaned up
+// according to the Tokenizer's options and sent on a channel, which can be
+// passed to markov.Feed:
+//
+//	t := &tokenize.Tokenizer{FoldCase: true, Punctuation: tokenize.DropPunctuation}
+//	tokens := t.Tokenize(r)
+//	err := markov.Feed(chain, tokens.C)
+//	if err == nil {
+//		err = tokens.Err()
+//	}
+//
+// Tokens are sent as strings.
+package tokenize
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Punctuation controls how a Tokenizer handles punctuation.
+type Punctuation int
+
+const (
+	// KeepPunctuation leaves tokens as they were split.
+	KeepPunctuation Punctuation = iota
+
+	// SplitPunctuation separates each punctuation character at the start
+	// or end of a token into a token of its own, e.g. `"Hello,` becomes
+	// `"`, `Hello` and `,`.
+	SplitPunctuation
+
+	// DropPunctuation removes punctuation from the start and end of
+	// tokens. Tokens that are only punctuation are dropped.
+	DropPunctuation
+)
+
+// ParsePunctuation returns the Punctuation with the given name ("keep",
+// "split" or "drop").
+func ParsePunctuation(name string) (Punctuation, error) {
+	switch strings.ToLower(name) {
+	case "keep":
+		return KeepPunctuation, nil
+	case "split":
+		return SplitPunctuation, nil
+	case "drop":
+		return DropPunctuation, nil
+	}
+
+	return KeepPunctuation, fmt.Errorf("unknown punctuation mode %q", name)
+}
+
+// Tokenizer splits text into tokens.
+type Tokenizer struct {
+	// Split splits the text into tokens. If it's nil, ScanWords is used.
+	Split bufio.SplitFunc
+
+	// Form is the Unicode normalization form tokens are converted to.
+	// Tokens are normalized after they're split, so combining marks
+	// split from their base character (e.g. by bufio.ScanRunes) won't be
+	// composed. ScanGraphemes keeps them together.
+	Form Form
+
+	// FoldCase converts tokens to lower case.
+	FoldCase bool
+
+	// Punctuation controls what happens to punctuation in tokens.
+	Punctuation Punctuation
+
+	// MaxTokenSize is the largest token Split can return, in bytes. If
+	// it's 0, bufio.MaxScanTokenSize is used.
+	MaxTokenSize int
+}
+
+// Tokens is a stream of tokens returned by Tokenize.
+type Tokens struct {
+	// C receives each token. It's closed after the last token, or when
+	// an error occurs.
+	C <-chan interface{}
+
+	err error
+}
+
+// Err returns the error that stopped the stream, if any. It must not be
+// called until C has been closed.
+func (t *Tokens) Err() error {
+	return t.err
+}
+
+// Tokenize reads r in a new goroutine and sends its tokens to the returned
+// stream. If r is an io.Closer it's closed after it's been read.
+//
+// Tokens must be read from the stream until it's closed, or the goroutine
+// will leak.
+func (t *Tokenizer) Tokenize(r io.Reader) *Tokens {
+	c := make(chan interface{})
+	tokens := &Tokens{C: c}
+
+	go func() {
+		defer close(c)
+
+		if closer, ok := r.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		scanner := t.scanner(r)
+		for scanner.Scan() {
+			for _, token := range t.clean(scanner.Text()) {
+				c <- token
+			}
+		}
+
+		tokens.err = scanner.Err()
+	}()
+
+	return tokens
+}
+
+// TokenizeString returns the tokens in s.
+func (t *Tokenizer) TokenizeString(s string) ([]string, error) {
+	var tokens []string
+
+	scanner := t.scanner(strings.NewReader(s))
+	for scanner.Scan() {
+		tokens = append(tokens, t.clean(scanner.Text())...)
+	}
+
+	return tokens, scanner.Err()
+}
+
+func (t *Tokenizer) scanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+
+	if t.Split != nil {
+		scanner.Split(t.Split)
+	} else {
+		scanner.Split(ScanWords)
+	}
+
+	if t.MaxTokenSize > 0 {
+		scanner.Buffer(nil, t.MaxTokenSize)
+	}
+
+	return scanner
+}
+
+// clean applies the options to a token. It returns the tokens to send, which
+// may be more than one if punctuation is split off.
+func (t *Tokenizer) clean(token string) []string {
+	token = t.Form.Normalize(token)
+
+	if t.FoldCase {
+		token = strings.ToLower(token)
+	}
+
+	switch t.Punctuation {
+	case SplitPunctuation:
+		return splitPunctuation(token)
+	case DropPunctuation:
+		token = strings.TrimFunc(token, unicode.IsPunct)
+	}
+
+	if token == "" {
+		return nil
+	}
+	return []string{token}
+}
+
+// splitPunctuation splits punctuation from the start and end of token.
+func splitPunctuation(token string) []string {
+	var tokens []string
+
+	for token != "" {
+		r, size := utf8.DecodeRuneInString(token)
+		if !unicode.IsPunct(r) {
+			break
+		}
+		tokens = append(tokens, token[:size])
+		token = token[size:]
+	}
+
+	var trailing []string
+	for token != "" {
+		r, size := utf8.DecodeLastRuneInString(token)
+		if !unicode.IsPunct(r) {
+			break
+		}
+		trailing = append(trailing, token[len(token)-size:])
+		token = token[:len(token)-size]
+	}
+
+	if token != "" {
+		tokens = append(tokens, token)
+	}
+
+	for i := len(trailing) - 1; i >= 0; i-- {
+		tokens = append(tokens, trailing[i])
+	}
+
+	return tokens
+}
@@ -0,0 +1,160 @@
+package tokenize
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTokenizer(t *testing.T) {
+	const text = `"Hello," she said. The café's open.`
+
+	cases := []struct {
+		name      string
+		tokenizer Tokenizer
+		want      []string
+	}{
+		{
+			name:      "default",
+			tokenizer: Tokenizer{},
+			want:      []string{`"`, "Hello", ",", `"`, "she", "said", ".", "The", "café's", "open", "."},
+		},
+		{
+			name:      "drop",
+			tokenizer: Tokenizer{FoldCase: true, Punctuation: DropPunctuation},
+			want:      []string{"hello", "she", "said", "the", "café's", "open"},
+		},
+		{
+			name:      "whitespace",
+			tokenizer: Tokenizer{Split: bufio.ScanWords},
+			want:      []string{`"Hello,"`, "she", "said.", "The", "café's", "open."},
+		},
+		{
+			name:      "whitespace split",
+			tokenizer: Tokenizer{Split: bufio.ScanWords, Punctuation: SplitPunctuation},
+			want:      []string{`"`, "Hello", ",", `"`, "she", "said", ".", "The", "café's", "open", "."},
+		},
+		{
+			name:      "whitespace drop",
+			tokenizer: Tokenizer{Split: bufio.ScanWords, Punctuation: DropPunctuation},
+			want:      []string{"Hello", "she", "said", "The", "café's", "open"},
+		},
+		{
+			name:      "sentences",
+			tokenizer: Tokenizer{Split: ScanSentences, FoldCase: true},
+			want:      []string{`"hello," she said.`, "the café's open."},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := c.tokenizer.TokenizeString(text)
+		if err != nil {
+			t.Errorf("%s: TokenizeString failed: %v", c.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestTokenizerNormalize(t *testing.T) {
+	tokenizer := Tokenizer{Split: ScanGraphemes, Form: NFC}
+
+	got, err := tokenizer.TokenizeString("e\u0301a")
+	if err != nil {
+		t.Fatalf("TokenizeString failed: %v", err)
+	}
+
+	want := []string{"é", "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+q, want %+q", got, want)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	var tokenizer Tokenizer
+
+	tokens := tokenizer.Tokenize(strings.NewReader("the cat sat on the mat"))
+
+	var got []interface{}
+	for token := range tokens.C {
+		got = append(got, token)
+	}
+
+	if err := tokens.Err(); err != nil {
+		t.Fatalf("Tokenize failed: %v", err)
+	}
+
+	want := []interface{}{"the", "cat", "sat", "on", "the", "mat"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestTokenizeError(t *testing.T) {
+	errRead := errors.New("read failed")
+	r := &closeRecorder{
+		Reader: io.MultiReader(strings.NewReader("one two "), iotest.ErrReader(errRead)),
+	}
+
+	var tokenizer Tokenizer
+	tokens := tokenizer.Tokenize(r)
+
+	count := 0
+	for range tokens.C {
+		count++
+	}
+
+	if count != 2 {
+		t.Errorf("got %d tokens, want 2", count)
+	}
+
+	if tokens.Err() != errRead {
+		t.Errorf("got error %v, want %v", tokens.Err(), errRead)
+	}
+
+	if !r.closed {
+		t.Error("reader wasn't closed")
+	}
+}
+
+func TestTokenizerMaxTokenSize(t *testing.T) {
+	tokenizer := Tokenizer{Split: bufio.ScanLines, MaxTokenSize: 16}
+
+	_, err := tokenizer.TokenizeString(strings.Repeat("x", 32))
+	if err != bufio.ErrTooLong {
+		t.Errorf("got error %v, want %v", err, bufio.ErrTooLong)
+	}
+}
+
+func TestParsePunctuation(t *testing.T) {
+	for name, want := range map[string]Punctuation{"keep": KeepPunctuation, "split": SplitPunctuation, "Drop": DropPunctuation} {
+		got, err := ParsePunctuation(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+		} else if got != want {
+			t.Errorf("%q: got %d, want %d", name, got, want)
+		}
+	}
+
+	_, err := ParsePunctuation("")
+	if err == nil {
+		t.Error("want error for empty name")
+	}
+}
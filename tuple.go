@@ -0,0 +1,122 @@
+package markov
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Tuple returns the values as an array ([N]interface{}), which can be used as
+// a single value in a chain. Each value must be a type supported by the
+// chain. For example, an n-gram chain might use Tuple("the", "cat").
+//
+// Tuples are compared element by element, so a tuple can be found in a chain
+// with another Tuple call with the same values.
+func Tuple(values ...interface{}) interface{} {
+	tuple := reflect.New(reflect.ArrayOf(len(values), interfaceType)).Elem()
+	for i, v := range values {
+		if v != nil {
+			tuple.Index(i).Set(reflect.ValueOf(v))
+		}
+	}
+	return tuple.Interface()
+}
+
+const (
+	// interfaceArray marks an array of interface{} elements, e.g. from
+	// Tuple.
+	interfaceArray byte = iota
+
+	// typedArray marks an array where every element has the same
+	// concrete type, e.g. [3]string.
+	typedArray
+)
+
+// marshalArray encodes an array. The encoding is the number of elements, the
+// array kind (interfaceArray or typedArray), then the length of each encoded
+// element followed by the element.
+func marshalArray(v reflect.Value) ([]byte, error) {
+	if v.Len() == 0 {
+		return nil, errors.New("unsupported type: empty array")
+	}
+
+	buf := make([]byte, 1+binary.MaxVarintLen64+1)
+	buf[0] = arrayValue
+	n := 1 + binary.PutUvarint(buf[1:], uint64(v.Len()))
+
+	buf[n] = typedArray
+	if v.Type().Elem().Kind() == reflect.Interface {
+		buf[n] = interfaceArray
+	}
+	buf = buf[:n+1]
+
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for i := 0; i < v.Len(); i++ {
+		elem, err := marshalValue(v.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("array element %d: %v", i, err)
+		}
+
+		n := binary.PutUvarint(lenBuf, uint64(len(elem)))
+		buf = append(buf, lenBuf[:n]...)
+		buf = append(buf, elem...)
+	}
+
+	return buf, nil
+}
+
+func unmarshalArray(buf []byte) (interface{}, error) {
+	buf = buf[1:]
+
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || length == 0 || n >= len(buf) {
+		return nil, errors.New("invalid array")
+	}
+	buf = buf[n:]
+
+	kind := buf[0]
+	buf = buf[1:]
+
+	// Each element takes at least two bytes.
+	if length > uint64(len(buf)/2) {
+		return nil, errors.New("invalid array")
+	}
+
+	elems := make([]interface{}, length)
+	for i := range elems {
+		elemLen, n := binary.Uvarint(buf)
+		if n <= 0 || elemLen > uint64(len(buf)-n) {
+			return nil, errors.New("invalid array")
+		}
+		buf = buf[n:]
+
+		var err error
+		elems[i], err = unmarshalValue(buf[:elemLen])
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[elemLen:]
+	}
+
+	if kind == interfaceArray {
+		return Tuple(elems...), nil
+	}
+
+	// Named element types that aren't registered were rejected by
+	// marshalValue, so each element was decoded with the array's element
+	// type.
+	elemType := reflect.TypeOf(elems[0])
+	array := reflect.New(reflect.ArrayOf(len(elems), elemType)).Elem()
+	for i, elem := range elems {
+		ev := reflect.ValueOf(elem)
+		if ev.Type() != elemType {
+			return nil, errors.New("invalid array: mixed element types")
+		}
+		array.Index(i).Set(ev)
+	}
+
+	return array.Interface(), nil
+}
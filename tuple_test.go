@@ -0,0 +1,74 @@
+package markov
+
+import "testing"
+
+func TestTuple(t *testing.T) {
+	if Tuple("a", "b") != Tuple("a", "b") {
+		t.Error("equal tuples are not equal")
+	}
+
+	if Tuple("a", "b") == Tuple("a b") {
+		t.Error("different tuples are equal")
+	}
+
+	words := []string{"the", "cat", "sat", "on", "the", "cat", "mat"}
+
+	ngrams := make(chan interface{})
+	go func() {
+		defer close(ngrams)
+		for i := 0; i < len(words)-1; i++ {
+			ngrams <- Tuple(words[i], words[i+1])
+		}
+	}()
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	memory := &MemoryChain{}
+	err = Feed(memory, ngrams)
+	if err != nil {
+		t.Fatalf("Feed failed: %v", err)
+	}
+
+	err = Copy(writer, memory)
+	if err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	reader, err := ReadDiskChain(f)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	for _, chain := range []Chain{memory, reader} {
+		id, err := chain.Find(Tuple("the", "cat"))
+		if err != nil {
+			t.Fatalf("%T: got error: %v", chain, err)
+		}
+
+		links, err := chain.Links(id)
+		if err != nil {
+			t.Fatalf("%T: got error: %v", chain, err)
+		}
+
+		if len(links) != 2 {
+			t.Fatalf("%T: got %d links, want 2", chain, len(links))
+		}
+
+		for _, link := range links {
+			value, err := chain.Get(link.ID)
+			if err != nil {
+				t.Fatalf("%T: got error: %v", chain, err)
+			}
+
+			if value != Tuple("cat", "sat") && value != Tuple("cat", "mat") {
+				t.Errorf("%T: got unexpected link to %v", chain, value)
+			}
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"reflect"
+	"time"
 )
 
 const (
@@ -16,8 +18,40 @@ const (
 	int32Value
 	float32Value
 	float64Value
+	boolValue
+	timeValue
+	arrayValue
+	uint16Value
+	int16Value
+	uint8Value
+	int8Value
 )
 
+// checkComparable returns ErrNotComparable if value can't be compared with ==,
+// including arrays (e.g. tuples) that hold values that can't be.
+func checkComparable(value interface{}) error {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return nil
+	}
+
+	if !t.Comparable() {
+		return ErrNotComparable
+	}
+
+	if t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Interface {
+		rv := reflect.ValueOf(value)
+		for i := 0; i < rv.Len(); i++ {
+			err := checkComparable(rv.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func marshalValue(value interface{}) ([]byte, error) {
 	switch v := value.(type) {
 	case string:
@@ -40,13 +74,42 @@ func marshalValue(value interface{}) ([]byte, error) {
 		// also covers rune
 		return marshalUint32(uint32(v), int32Value)
 
+	case uint16:
+		return marshalUint16(v, uint16Value)
+	case int16:
+		return marshalUint16(uint16(v), int16Value)
+
+	// also covers byte
+	case uint8:
+		return []byte{uint8Value, v}, nil
+	case int8:
+		return []byte{int8Value, uint8(v)}, nil
+
 	case float32:
 		return marshalFloat32(v)
 	case float64:
 		return marshalFloat64(v)
 
+	case []byte:
+		return nil, ErrNotComparable
+
+	case bool:
+		return marshalBool(v)
+	case time.Time:
+		return marshalTime(v)
+
 	default:
-		return nil, fmt.Errorf("unsupported type: %T", v)
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Array && customCodec(rv.Type()) == nil {
+			// Arrays are read back as unnamed types, which aren't
+			// equal to a named type.
+			if rv.Type().Name() != "" {
+				return nil, fmt.Errorf("unsupported type: %T (named array types must be registered with RegisterValue)", v)
+			}
+			return marshalArray(rv)
+		}
+
+		return marshalCustomValue(v)
 	}
 }
 
@@ -91,13 +154,38 @@ func unmarshalValue(buf []byte) (interface{}, error) {
 		}
 		return int32(v), nil
 
+	case uint16Value:
+		return unmarshalUint16(buf)
+	case int16Value:
+		v, err := unmarshalUint16(buf)
+		if err != nil {
+			return nil, err
+		}
+		return int16(v), nil
+
+	case uint8Value:
+		return unmarshalUint8(buf)
+	case int8Value:
+		v, err := unmarshalUint8(buf)
+		if err != nil {
+			return nil, err
+		}
+		return int8(v), nil
+
 	case float32Value:
 		return unmarshalFloat32(buf)
 	case float64Value:
 		return unmarshalFloat64(buf)
 
+	case boolValue:
+		return unmarshalBool(buf)
+	case timeValue:
+		return unmarshalTime(buf)
+	case arrayValue:
+		return unmarshalArray(buf)
+
 	default:
-		return nil, fmt.Errorf("unsupported type id %d", buf[0])
+		return unmarshalCustomValue(buf)
 	}
 }
 
@@ -134,6 +222,27 @@ func unmarshalUint32(buf []byte) (uint32, error) {
 	return binary.BigEndian.Uint32(buf[1:]), nil
 }
 
+func marshalUint16(i uint16, t byte) ([]byte, error) {
+	buf := make([]byte, 3)
+	buf[0] = t
+	binary.BigEndian.PutUint16(buf[1:], i)
+	return buf, nil
+}
+
+func unmarshalUint16(buf []byte) (uint16, error) {
+	if len(buf) != 3 {
+		return 0, fmt.Errorf("invalid uint16 length %d", len(buf))
+	}
+	return binary.BigEndian.Uint16(buf[1:]), nil
+}
+
+func unmarshalUint8(buf []byte) (uint8, error) {
+	if len(buf) != 2 {
+		return 0, fmt.Errorf("invalid uint8 length %d", len(buf))
+	}
+	return buf[1], nil
+}
+
 func marshalFloat32(f float32) ([]byte, error) {
 	return marshalUint32(math.Float32bits(f), float32Value)
 }
@@ -151,3 +260,33 @@ func unmarshalFloat64(buf []byte) (float64, error) {
 	bits, _ := unmarshalUint64(buf)
 	return math.Float64frombits(bits), nil
 }
+
+func marshalBool(b bool) ([]byte, error) {
+	buf := []byte{boolValue, 0}
+	if b {
+		buf[1] = 1
+	}
+	return buf, nil
+}
+
+func unmarshalBool(buf []byte) (bool, error) {
+	if len(buf) != 2 {
+		return false, fmt.Errorf("invalid bool length %d", len(buf))
+	}
+	return buf[1] != 0, nil
+}
+
+func marshalTime(t time.Time) ([]byte, error) {
+	tbuf, err := t.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{timeValue}, tbuf...), nil
+}
+
+func unmarshalTime(buf []byte) (time.Time, error) {
+	var t time.Time
+	err := t.UnmarshalBinary(buf[1:])
+	return t, err
+}
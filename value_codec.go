@@ -0,0 +1,146 @@
+package markov
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// MinCustomValueID is the lowest type ID that can be passed to RegisterValue.
+// Lower IDs are reserved for builtin types.
+const MinCustomValueID = 64
+
+// ValueMarshaler encodes a value of a registered type.
+type ValueMarshaler func(value interface{}) ([]byte, error)
+
+// ValueUnmarshaler decodes a value encoded by the ValueMarshaler for the same
+// type.
+type ValueUnmarshaler func(buf []byte) (interface{}, error)
+
+type valueCodec struct {
+	id        uint8
+	marshal   ValueMarshaler
+	unmarshal ValueUnmarshaler
+}
+
+var (
+	customValuesMutex sync.RWMutex
+	customValueTypes  = map[reflect.Type]*valueCodec{}
+	customValueIDs    [256]*valueCodec
+)
+
+// RegisterValue allows values of the same type as value to be stored in
+// disk chains.
+//
+// id identifies the type in files. It must be at least MinCustomValueID and
+// can't be changed once a file has been written, or the file won't be
+// readable. marshal is called with values of the registered type and
+// unmarshal must return a value of that type.
+//
+// Chains compare values with ==, so the type must be comparable, and
+// unmarshal must return values equal to the originals. Slices, maps and
+// functions aren't comparable, so they can't be registered. In particular,
+// []byte isn't supported: store bytes as a string, or as an array if they
+// have a fixed length.
+//
+// Unnamed arrays (e.g. [4]int32) are stored without registering them, as
+// long as their elements can be. Named array types (e.g. type IP [4]int32)
+// must be registered, since they'd be read back as the unnamed type.
+//
+// RegisterValue panics if id or the type has already been registered, or if
+// the type isn't comparable.
+func RegisterValue(id uint8, value interface{}, marshal ValueMarshaler, unmarshal ValueUnmarshaler) {
+	if id < MinCustomValueID {
+		panic(fmt.Sprintf("markov: value type id %d is reserved", id))
+	}
+
+	t := reflect.TypeOf(value)
+	if t == nil || !t.Comparable() {
+		panic(fmt.Sprintf("markov: value type %T is not comparable (use a string or array instead of a slice)", value))
+	}
+
+	customValuesMutex.Lock()
+	defer customValuesMutex.Unlock()
+
+	if customValueIDs[id] != nil {
+		panic(fmt.Sprintf("markov: value type id %d registered twice", id))
+	}
+
+	if _, ok := customValueTypes[t]; ok {
+		panic(fmt.Sprintf("markov: value type %v registered twice", t))
+	}
+
+	codec := &valueCodec{
+		id:        id,
+		marshal:   marshal,
+		unmarshal: unmarshal,
+	}
+	customValueIDs[id] = codec
+	customValueTypes[t] = codec
+}
+
+// RegisterBinaryValue registers a type that implements
+// encoding.BinaryMarshaler, and whose pointer implements
+// encoding.BinaryUnmarshaler. See RegisterValue.
+func RegisterBinaryValue(id uint8, value interface{}) {
+	t := reflect.TypeOf(value)
+
+	if _, ok := value.(encoding.BinaryMarshaler); !ok {
+		panic(fmt.Sprintf("markov: %T does not implement encoding.BinaryMarshaler", value))
+	}
+
+	unmarshalerType := reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	if !reflect.PtrTo(t).Implements(unmarshalerType) {
+		panic(fmt.Sprintf("markov: *%T does not implement encoding.BinaryUnmarshaler", value))
+	}
+
+	marshal := func(v interface{}) ([]byte, error) {
+		return v.(encoding.BinaryMarshaler).MarshalBinary()
+	}
+
+	unmarshal := func(buf []byte) (interface{}, error) {
+		ptr := reflect.New(t)
+		err := ptr.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(buf)
+		if err != nil {
+			return nil, err
+		}
+		return ptr.Elem().Interface(), nil
+	}
+
+	RegisterValue(id, value, marshal, unmarshal)
+}
+
+// customCodec returns the codec registered for t, or nil if there isn't one.
+func customCodec(t reflect.Type) *valueCodec {
+	customValuesMutex.RLock()
+	defer customValuesMutex.RUnlock()
+
+	return customValueTypes[t]
+}
+
+func marshalCustomValue(value interface{}) ([]byte, error) {
+	codec := customCodec(reflect.TypeOf(value))
+	if codec == nil {
+		return nil, fmt.Errorf("unsupported type: %T", value)
+	}
+
+	buf, err := codec.marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{codec.id}, buf...), nil
+}
+
+func unmarshalCustomValue(buf []byte) (interface{}, error) {
+	customValuesMutex.RLock()
+	codec := customValueIDs[buf[0]]
+	customValuesMutex.RUnlock()
+
+	if codec == nil {
+		return nil, fmt.Errorf("unsupported type id %d", buf[0])
+	}
+
+	return codec.unmarshal(buf[1:])
+}
@@ -0,0 +1,245 @@
+package markov
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+type testEvent struct {
+	Name  string
+	Count int
+}
+
+type testBinaryValue struct {
+	a, b uint16
+}
+
+func (v testBinaryValue) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint16(buf, v.a)
+	binary.BigEndian.PutUint16(buf[2:], v.b)
+	return buf, nil
+}
+
+func (v *testBinaryValue) UnmarshalBinary(buf []byte) error {
+	if len(buf) != 4 {
+		return errors.New("invalid length")
+	}
+	v.a = binary.BigEndian.Uint16(buf)
+	v.b = binary.BigEndian.Uint16(buf[2:])
+	return nil
+}
+
+type testIP [4]int32
+
+// testPair is a named array that isn't registered.
+type testPair [2]string
+
+func init() {
+	RegisterValue(MinCustomValueID, testEvent{},
+		func(v interface{}) ([]byte, error) {
+			e := v.(testEvent)
+			buf := make([]byte, binary.MaxVarintLen64+len(e.Name))
+			n := binary.PutVarint(buf, int64(e.Count))
+			n += copy(buf[n:], e.Name)
+			return buf[:n], nil
+		},
+		func(buf []byte) (interface{}, error) {
+			count, n := binary.Varint(buf)
+			if n <= 0 {
+				return nil, errors.New("invalid event")
+			}
+			return testEvent{Name: string(buf[n:]), Count: int(count)}, nil
+		},
+	)
+
+	RegisterBinaryValue(MinCustomValueID+1, testBinaryValue{})
+
+	RegisterValue(MinCustomValueID+2, testIP{},
+		func(v interface{}) ([]byte, error) {
+			ip := v.(testIP)
+			buf := make([]byte, 16)
+			for i, n := range ip {
+				binary.BigEndian.PutUint32(buf[i*4:], uint32(n))
+			}
+			return buf, nil
+		},
+		func(buf []byte) (interface{}, error) {
+			if len(buf) != 16 {
+				return nil, errors.New("invalid ip")
+			}
+			var ip testIP
+			for i := range ip {
+				ip[i] = int32(binary.BigEndian.Uint32(buf[i*4:]))
+			}
+			return ip, nil
+		},
+	)
+}
+
+func TestCustomValues(t *testing.T) {
+	cases := []interface{}{
+		testEvent{Name: "click", Count: 1},
+		testEvent{Name: "", Count: 100},
+		testBinaryValue{a: 1, b: 2},
+		testIP{1, 2, 3, 4},
+		[2]testIP{{1, 2, 3, 4}, {5, 6, 7, 8}},
+		Tuple(testIP{1, 2, 3, 4}, "a"),
+	}
+
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	writer, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	for _, v := range cases {
+		_, err := writer.Add(v)
+		if err != nil {
+			t.Fatalf("%v: got Add error %v", v, err)
+		}
+	}
+
+	reader, err := ReadDiskChain(f)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	for _, v := range cases {
+		id, err := reader.Find(v)
+		if err != nil {
+			t.Fatalf("%v: got Find error %v", v, err)
+		}
+
+		actual, err := reader.Get(id)
+		if err != nil {
+			t.Fatalf("%v: got Get error %v", v, err)
+		}
+
+		if actual != v {
+			t.Errorf("got %v, want %v", actual, v)
+		}
+	}
+
+	_, err = marshalValue(struct{}{})
+	if err == nil {
+		t.Error("got nil error for an unregistered type")
+	}
+
+	for _, v := range []interface{}{testPair{"a", "b"}, [2]testPair{}} {
+		_, err = marshalValue(v)
+		if err == nil {
+			t.Errorf("%T: got nil error for an unregistered named array", v)
+		}
+
+		_, err = writer.Add(v)
+		if err == nil {
+			t.Errorf("%T: got nil Add error for an unregistered named array", v)
+		}
+	}
+
+	_, err = unmarshalValue([]byte{MinCustomValueID + 100})
+	if err == nil {
+		t.Error("got nil error for an unregistered type id")
+	}
+}
+
+func TestRegisterValuePanics(t *testing.T) {
+	cases := map[string]func(){
+		"reserved id": func() {
+			RegisterBinaryValue(MinCustomValueID-1, testBinaryValue{})
+		},
+		"duplicate id": func() {
+			RegisterBinaryValue(MinCustomValueID, testBinaryValue{})
+		},
+		"duplicate type": func() {
+			RegisterBinaryValue(MinCustomValueID+50, testBinaryValue{})
+		},
+		"not comparable": func() {
+			RegisterValue(MinCustomValueID+50, []byte{}, nil, nil)
+		},
+		"not a BinaryMarshaler": func() {
+			RegisterBinaryValue(MinCustomValueID+50, testEvent{})
+		},
+	}
+
+	for name, fn := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestByteSliceValues(t *testing.T) {
+	f, cleanup := tempFile(t)
+	defer cleanup()
+
+	disk, err := NewDiskChainWriter(f)
+	if err != nil {
+		t.Fatalf("NewDiskChainWriter failed: %v", err)
+	}
+
+	chains := map[string]ReadWriteChain{
+		"memory":  NewMemoryChain(0),
+		"sharded": NewShardedChain(4),
+		"disk":    disk,
+	}
+
+	values := []interface{}{
+		[]byte("abc"),
+		Tuple("a", []byte("b")),
+	}
+
+	for name, chain := range chains {
+		for _, value := range values {
+			_, err := chain.Add(value)
+			if err != ErrNotComparable {
+				t.Errorf("%s: Add(%#v): got error %v, want %v", name, value, err, ErrNotComparable)
+			}
+
+			_, err = chain.Find(value)
+			if err != ErrNotComparable {
+				t.Errorf("%s: Find(%#v): got error %v, want %v", name, value, err, ErrNotComparable)
+			}
+		}
+	}
+
+	_, err = marshalValue([]byte("abc"))
+	if err != ErrNotComparable {
+		t.Errorf("marshalValue: got error %v, want %v", err, ErrNotComparable)
+	}
+
+	// Bytes with a fixed length can be stored as an array.
+	hash := [4]byte{0xde, 0xad, 0xbe, 0xef}
+	_, err = disk.Add(hash)
+	if err != nil {
+		t.Fatalf("Add(%v) failed: %v", hash, err)
+	}
+
+	reader, err := ReadDiskChain(f)
+	if err != nil {
+		t.Fatalf("ReadDiskChain failed: %v", err)
+	}
+
+	id, err := reader.Find(hash)
+	if err != nil {
+		t.Fatalf("Find(%v) failed: %v", hash, err)
+	}
+
+	value, err := reader.Get(id)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	if value != hash {
+		t.Errorf("got %#v, want %#v", value, hash)
+	}
+}
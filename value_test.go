@@ -3,6 +3,7 @@ package markov
 import (
 	"math"
 	"testing"
+	"time"
 )
 
 func TestMarshalValue(t *testing.T) {
@@ -15,8 +16,17 @@ func TestMarshalValue(t *testing.T) {
 		0, 1, -1, 1 << 32, 1<<63 - 1, ^(1<<63 - 1) + 1,
 		uint32(0), uint32(1), uint32(1<<32 - 1),
 		int32(0), int32(1), int32(-1), int32(1<<31 - 1), int32(^(1<<31 - 1) + 1),
+		uint16(0), uint16(1), uint16(1<<16 - 1),
+		int16(0), int16(1), int16(-1), int16(1<<15 - 1), int16(-1 << 15),
+		byte(0), byte(1), byte(255),
+		int8(0), int8(1), int8(-1), int8(127), int8(-128),
 		float32(0), float32(1), float32(-1), float32(math.MaxFloat32), float32(math.SmallestNonzeroFloat32),
 		0.0, 1.0, -1.0, math.MaxFloat64, math.SmallestNonzeroFloat64,
+		true, false,
+		time.Time{}, time.Date(2018, 6, 1, 12, 30, 0, 5, time.UTC),
+		[4]byte{1, 2, 3, 255}, [16]byte{}, [2]int8{-1, 1}, [2]uint16{1, 2},
+		[1]string{"a"}, [2]string{"a b", ""}, [3]int{1, -2, 3}, [2][2]rune{{'a', 'b'}, {'c', 'd'}},
+		Tuple("a"), Tuple("a", 1, 'x', true), Tuple(Tuple("a", "b"), [2]string{"c", "d"}),
 	}
 
 	for _, v1 := range cases {
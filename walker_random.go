@@ -7,18 +7,66 @@ var _ Walker = &randomWalker{}
 type randomWalker struct {
 	chain Chain
 	last  int
+
+	// sampler is nil if the chain's Samplers aren't used.
+	sampler SamplerChain
+
+	// rng is nil to use the default Source.
+	rng *rand.Rand
 }
 
 // RandomWalker traverses a chain. Items are chosen randomly, but each
 // possible item is weighted by it's probability.
+//
+// If the chain implements SamplerChain (e.g. DiskChain), and keeps it's
+// Samplers, they're used to choose items. A Sampler doesn't choose the same
+// item as searching the links for the same random number, so walks of these
+// chains differ from earlier versions of this package even with the same seed.
 func RandomWalker(chain Chain, startID int) Walker {
-	return &randomWalker{
+	w := &randomWalker{
 		chain: chain,
 		last:  startID,
 	}
+
+	if sc, ok := chain.(SamplerChain); ok && keepsSamplers(sc) {
+		w.sampler = sc
+	}
+
+	return w
+}
+
+// RandomWalkerWithRand is like RandomWalker, but random numbers are taken
+// from rng, so a walk can be repeated by seeding it. rng isn't safe for
+// concurrent use, so each goroutine needs it's own.
+func RandomWalkerWithRand(chain Chain, startID int, rng *rand.Rand) Walker {
+	w := RandomWalker(chain, startID).(*randomWalker)
+	w.rng = rng
+	return w
+}
+
+// float64 returns a random number in [0.0,1.0).
+func (w *randomWalker) float64() float64 {
+	if w.rng == nil {
+		return rand.Float64()
+	}
+	return w.rng.Float64()
+}
+
+// keepsSamplers reports whether sc keeps it's Samplers between calls. If it
+// doesn't, building a Sampler for each step is slower than searching the
+// links.
+func keepsSamplers(sc SamplerChain) bool {
+	if dc, ok := sc.(*DiskChain); ok {
+		return dc.cache != nil
+	}
+	return true
 }
 
 func (w *randomWalker) Next() (interface{}, error) {
+	if w.sampler != nil {
+		return w.sample(w.sampler)
+	}
+
 	links, err := w.chain.Links(w.last)
 	if err != nil {
 		return 0, err
@@ -28,7 +76,7 @@ func (w *randomWalker) Next() (interface{}, error) {
 		return 0, ErrBrokenChain
 	}
 
-	index := rand.Float64()
+	index := w.float64()
 	var passed float64
 
 	for _, link := range links {
@@ -41,3 +89,17 @@ func (w *randomWalker) Next() (interface{}, error) {
 
 	panic("Next() failed")
 }
+
+func (w *randomWalker) sample(sc SamplerChain) (interface{}, error) {
+	sampler, err := sc.Sampler(w.last)
+	if err != nil {
+		return 0, err
+	}
+
+	if sampler.Len() == 0 {
+		return 0, ErrBrokenChain
+	}
+
+	w.last = sampler.Sample(w.float64())
+	return w.chain.Get(w.last)
+}
@@ -2,6 +2,8 @@ package markov
 
 import (
 	"math"
+	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -61,3 +63,30 @@ func TestRandomWalkerWalk(t *testing.T) {
 func fuzzyEquals(a, b int, tolerance float64) bool {
 	return math.Abs((float64(a)/float64(b))-1) < tolerance
 }
+
+func TestRandomWalkerWithRand(t *testing.T) {
+	chain := &MemoryChain{}
+	Feed(chain, split(testText))
+
+	walk := func(seed int64) []interface{} {
+		walker := RandomWalkerWithRand(chain, 0, rand.New(rand.NewSource(seed)))
+
+		values := make([]interface{}, 100)
+		for i := range values {
+			var err error
+			values[i], err = walker.Next()
+			if err != nil {
+				t.Fatalf("got error: %v", err)
+			}
+		}
+		return values
+	}
+
+	if a, b := walk(1), walk(1); !reflect.DeepEqual(a, b) {
+		t.Errorf("walks with the same seed differ:\n%v\n%v", a, b)
+	}
+
+	if a, b := walk(1), walk(2); reflect.DeepEqual(a, b) {
+		t.Errorf("walks with different seeds are the same: %v", a)
+	}
+}